@@ -0,0 +1,225 @@
+// Command feedbench measures feed query latency against a database seeded
+// with synthetic users, posts and votes, so that changes to the feed
+// queries can be compared as vote volume grows.
+//
+//  DATABASE_URL=postgres://... go run ./cmd/feedbench -seed -posts 20000 -votes-per-post 50
+//  DATABASE_URL=postgres://... go run ./cmd/feedbench -iterations 500
+//  DATABASE_URL=postgres://... go run ./cmd/feedbench -cleanup
+//
+// Seeded accounts are named bench1, bench2, ... with @bench.invalid
+// addresses and cannot log in. Run it against a scratch database with the
+// migrations applied.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"jabber_v3/apps/api/internal/store"
+)
+
+const (
+  benchPrefix = "bench"
+  benchDomain = "@bench.invalid"
+)
+
+func main() {
+  seed := flag.Bool("seed", false, "insert synthetic users, posts and votes before measuring")
+  cleanup := flag.Bool("cleanup", false, "delete the synthetic data and exit")
+  users := flag.Int("users", 1000, "synthetic users to seed")
+  posts := flag.Int("posts", 20000, "synthetic posts to seed")
+  votesPerPost := flag.Int("votes-per-post", 50, "votes to seed per post, at most -users")
+  iterations := flag.Int("iterations", 200, "feed requests per scenario")
+  pages := flag.Int("pages", 1, "pages to follow per request")
+  limit := flag.Int("limit", 25, "posts per page")
+  compare := flag.Bool("compare", false, "also time a feed that aggregates post_votes on every read")
+  flag.Parse()
+
+  dsn := os.Getenv("DATABASE_URL")
+  if dsn == "" {
+    log.Fatal("DATABASE_URL is required")
+  }
+  db, err := sql.Open("pgx", dsn)
+  if err != nil {
+    log.Fatalf("db open failed: %v", err)
+  }
+  defer db.Close()
+  ctx := context.Background()
+  if err := db.PingContext(ctx); err != nil {
+    log.Fatalf("db ping failed: %v", err)
+  }
+
+  if *cleanup {
+    result, err := db.ExecContext(ctx, "delete from users where email like $1", "%"+benchDomain)
+    if err != nil {
+      log.Fatalf("cleanup failed: %v", err)
+    }
+    removed, _ := result.RowsAffected()
+    log.Printf("removed %d synthetic users with their posts and votes", removed)
+    return
+  }
+  if *seed {
+    if *votesPerPost > *users {
+      log.Fatal("-votes-per-post cannot exceed -users")
+    }
+    if err := seedData(ctx, db, *users, *posts, *votesPerPost); err != nil {
+      log.Fatalf("seeding failed: %v", err)
+    }
+  }
+
+  var postCount, voteCount int
+  if err := db.QueryRowContext(ctx, "select (select count(*) from posts), (select count(*) from post_votes)").Scan(&postCount, &voteCount); err != nil {
+    log.Fatalf("counting failed: %v", err)
+  }
+  fmt.Printf("%d posts, %d votes; %d iterations of %d page(s) of %d\n\n", postCount, voteCount, *iterations, *pages, *limit)
+
+  var viewerID string
+  err = db.QueryRowContext(ctx, "select id from users where username = $1", benchPrefix+"1").Scan(&viewerID)
+  if err != nil && err != sql.ErrNoRows {
+    log.Fatalf("viewer lookup failed: %v", err)
+  }
+
+  appStore := store.New(db)
+  fmt.Printf("%-28s %10s %10s %10s\n", "scenario", "p50", "p95", "p99")
+  for _, sortMode := range []string{store.FeedSortNew, store.FeedSortTop, store.FeedSortHot} {
+    for _, viewer := range []*string{nil, &viewerID} {
+      if viewer != nil && viewerID == "" {
+        continue
+      }
+      name := sortMode + " (anonymous)"
+      if viewer != nil {
+        name = sortMode + " (signed in)"
+      }
+      durations, err := measure(*iterations, func() error {
+        return readFeed(ctx, appStore, sortMode, viewer, *limit, *pages)
+      })
+      if err != nil {
+        log.Fatalf("%s: %v", name, err)
+      }
+      report(name, durations)
+    }
+  }
+
+  if *compare {
+    durations, err := measure(*iterations, func() error {
+      return readAggregatedFeed(ctx, db, *limit)
+    })
+    if err != nil {
+      log.Fatalf("aggregated top: %v", err)
+    }
+    report("top (aggregated, first page)", durations)
+  }
+}
+
+func seedData(ctx context.Context, db *sql.DB, users int, posts int, votesPerPost int) error {
+  started := time.Now()
+  steps := []struct {
+    name  string
+    query string
+    args  []any
+  }{
+    {"users", `
+      insert into users (email, username, password_hash, email_verified_at)
+      select $1 || i || $3, $1 || i, '', now()
+      from generate_series(1, $2) i
+      on conflict do nothing`, []any{benchPrefix, users, benchDomain}},
+    {"posts", `
+      insert into posts (user_id, title, body, created_at)
+      select u.id, 'Bench post ' || i, 'Synthetic post for feed benchmarks.', now() - i * interval '1 minute'
+      from generate_series(1, $2) i
+      join users u on u.username = $1 || (1 + i % $3)`, []any{benchPrefix, posts, users}},
+    {"votes", `
+      insert into post_votes (post_id, user_id, value)
+      select p.id, u.id, case when random() < 0.7 then 1 else -1 end
+      from posts p
+      join users a on a.id = p.user_id and a.email like '%' || $4
+      cross join generate_series(1, $2) g
+      join users u on u.username = $1 || (1 + (abs(hashtext(p.id::text)::bigint) + g) % $3)
+      on conflict do nothing`, []any{benchPrefix, votesPerPost, users, benchDomain}},
+  }
+  for _, step := range steps {
+    stepStarted := time.Now()
+    result, err := db.ExecContext(ctx, step.query, step.args...)
+    if err != nil {
+      return fmt.Errorf("%s: %w", step.name, err)
+    }
+    inserted, _ := result.RowsAffected()
+    log.Printf("seeded %d %s in %s", inserted, step.name, time.Since(stepStarted).Round(time.Millisecond))
+  }
+  if _, err := db.ExecContext(ctx, "analyze users, posts, post_votes"); err != nil {
+    return err
+  }
+  log.Printf("seeding took %s", time.Since(started).Round(time.Millisecond))
+  return nil
+}
+
+func readFeed(ctx context.Context, appStore *store.Store, sortMode string, viewerID *string, limit int, pages int) error {
+  opts := store.FeedOptions{Sort: sortMode, Limit: limit, ViewerID: viewerID}
+  for page := 0; page < pages; page++ {
+    posts, err := appStore.Posts.ListFeed(ctx, opts)
+    if err != nil {
+      return err
+    }
+    if len(posts) < limit {
+      return nil
+    }
+    last := posts[len(posts)-1]
+    opts.After = &store.FeedCursor{ID: last.ID, CreatedAt: last.CreatedAt, Score: last.Score, HotRank: last.HotRank}
+  }
+  return nil
+}
+
+// readAggregatedFeed is the top feed as it would be without the counts on
+// posts, for comparison.
+func readAggregatedFeed(ctx context.Context, db *sql.DB, limit int) error {
+  rows, err := db.QueryContext(ctx, `
+    select p.id, coalesce(sum(v.value), 0) as score
+    from posts p
+    left join post_votes v on v.post_id = p.id
+    group by p.id
+    order by score desc, p.created_at desc, p.id desc
+    limit $1`, limit)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+  for rows.Next() {
+    var id string
+    var score int
+    if err := rows.Scan(&id, &score); err != nil {
+      return err
+    }
+  }
+  return rows.Err()
+}
+
+func measure(iterations int, run func() error) ([]time.Duration, error) {
+  durations := make([]time.Duration, 0, iterations)
+  for i := 0; i < iterations; i++ {
+    started := time.Now()
+    if err := run(); err != nil {
+      return nil, err
+    }
+    durations = append(durations, time.Since(started))
+  }
+  sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+  return durations, nil
+}
+
+func report(name string, durations []time.Duration) {
+  if len(durations) == 0 {
+    return
+  }
+  percentile := func(p float64) time.Duration {
+    return durations[int(p*float64(len(durations)-1))].Round(time.Microsecond)
+  }
+  fmt.Printf("%-28s %10s %10s %10s\n", name, percentile(0.50), percentile(0.95), percentile(0.99))
+}
@@ -0,0 +1,44 @@
+// Command oidc-fake runs the in-process test identity provider as a
+// standalone server so OIDC login can be tried locally without a real
+// provider. It signs everyone in as the same user.
+//
+//  OIDC_PROVIDERS=fake
+//  OIDC_FAKE_ISSUER=http://localhost:9999
+//  OIDC_FAKE_CLIENT_ID=foorum
+//  OIDC_FAKE_CLIENT_SECRET=secret
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"jabber_v3/apps/api/internal/auth/oidc/oidctest"
+)
+
+func main() {
+  addr := flag.String("addr", "localhost:9999", "listen address")
+  clientID := flag.String("client-id", "foorum", "accepted client ID")
+  clientSecret := flag.String("client-secret", "secret", "accepted client secret")
+  subject := flag.String("sub", "fake-user", "subject to sign in as")
+  email := flag.String("email", "fake@example.com", "email to sign in as")
+  username := flag.String("username", "fakeuser", "preferred_username to sign in as")
+  flag.Parse()
+
+  provider, err := oidctest.New("http://"+*addr, *clientID, *clientSecret)
+  if err != nil {
+    log.Fatalf("provider init failed: %v", err)
+  }
+  provider.SetUser(oidctest.User{
+    Subject:           *subject,
+    Email:             *email,
+    EmailVerified:     true,
+    Name:              *username,
+    PreferredUsername: *username,
+  })
+
+  log.Printf("** fake oidc provider on http://%s **", *addr)
+  if err := http.ListenAndServe(*addr, provider); err != nil {
+    log.Fatalf("server error: %v", err)
+  }
+}
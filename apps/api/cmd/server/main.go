@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -15,13 +16,24 @@ import (
 	"github.com/pressly/goose/v3"
 
 	"jabber_v3/apps/api/internal/auth"
+	"jabber_v3/apps/api/internal/auth/oidc"
+	"jabber_v3/apps/api/internal/auth/throttle"
 	"jabber_v3/apps/api/internal/config"
+	"jabber_v3/apps/api/internal/http/handlers"
 	"jabber_v3/apps/api/internal/http/routes"
+	"jabber_v3/apps/api/internal/mail"
 	"jabber_v3/apps/api/internal/store"
 )
 
 func main() {
   cfg := config.Load()
+  if err := cfg.Validate(); err != nil {
+    log.Fatalf("invalid config: %v", err)
+  }
+  jwtKeys, err := newJWTKeySet(cfg)
+  if err != nil {
+    log.Fatalf("jwt keys: %v", err)
+  }
 
   db, err := sql.Open("pgx", cfg.DatabaseURL)
   if err != nil {
@@ -45,16 +57,50 @@ func main() {
   }
 
   appStore := store.New(db)
-  jwtManager := auth.JWTManager{Secret: []byte(cfg.JWTSecret), TTL: 24 * time.Hour}
+  jwtManager := auth.JWTManager{Keys: jwtKeys, TTL: 15 * time.Minute}
+
+  passwordPolicy, err := newPasswordPolicy(cfg)
+  if err != nil {
+    log.Fatalf("password policy: %v", err)
+  }
+  passwords := auth.PasswordHasher{Params: auth.Argon2Params{
+    Memory:      uint32(cfg.Argon2MemoryKiB),
+    Iterations:  uint32(cfg.Argon2Iterations),
+    Parallelism: uint8(cfg.Argon2Parallelism),
+  }}
+  handlerConfig := handlers.Config{
+    AppURL:               cfg.AppURL,
+    RequireVerifiedEmail: cfg.RequireVerifiedEmail,
+    OIDC:                 make(map[string]*oidc.Client),
+    Passwords:            passwords,
+    PasswordPolicy:       passwordPolicy,
+    LoginGuard:           throttle.NewGuard(newThrottleBackend(cfg, appStore), throttle.DefaultPolicy),
+    TrustedProxyHops:     cfg.TrustedProxyHops,
+  }
+  for _, provider := range cfg.OIDCProviders {
+    handlerConfig.OIDC[provider.Name] = oidc.NewClient(oidc.Config{
+      Name:         provider.Name,
+      Issuer:       provider.Issuer,
+      ClientID:     provider.ClientID,
+      ClientSecret: provider.ClientSecret,
+      RedirectURL:  provider.RedirectURL,
+      Scopes:       provider.Scopes,
+    }, nil)
+  }
 
   httpServer := &http.Server{
     Addr:         ":" + cfg.Port,
-    Handler:      routes.NewRouter(appStore, jwtManager, cfg.CorsOrigins),
+    Handler:      routes.NewRouter(appStore, jwtManager, newMailer(cfg), handlerConfig, cfg.CorsOrigins),
     ReadTimeout:  5 * time.Second,
     WriteTimeout: 10 * time.Second,
     IdleTimeout:  60 * time.Second,
   }
 
+  purgeCtx, stopPurge := context.WithCancel(context.Background())
+  defer stopPurge()
+  go runPurger(purgeCtx, appStore, purgeInterval)
+  go runKarmaReconciler(purgeCtx, appStore)
+
   go func() {
     log.Printf("** server listening on %s **", httpServer.Addr)
     if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -73,6 +119,166 @@ func main() {
   }
 }
 
+const (
+  purgeInterval  = time.Hour
+  purgeBatchSize = 100
+  // Karma is reconciled daily at this hour (UTC), when traffic is lowest.
+  karmaReconcileHour  = 3
+  karmaReconcileBatch = 1000
+)
+
+// runPurger deletes accounts whose grace period is over and drops expired
+// data exports, once per interval until ctx is cancelled.
+func runPurger(ctx context.Context, appStore *store.Store, interval time.Duration) {
+  ticker := time.NewTicker(interval)
+  defer ticker.Stop()
+  for {
+    purgeAccounts(ctx, appStore)
+    if removed, err := appStore.Exports.PurgeExpiredExports(ctx); err != nil {
+      log.Printf("export purge failed: %v", err)
+    } else if removed > 0 {
+      log.Printf("purged %d expired exports", removed)
+    }
+
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+func purgeAccounts(ctx context.Context, appStore *store.Store) {
+  for {
+    ids, err := appStore.Users.ListDueDeletions(ctx, time.Now(), purgeBatchSize)
+    if err != nil {
+      log.Printf("listing due deletions failed: %v", err)
+      return
+    }
+    purged := 0
+    for _, id := range ids {
+      if err := appStore.Users.PurgeAccount(ctx, id); err != nil {
+        if !errors.Is(err, store.ErrNotFound) {
+          log.Printf("purging account %s failed: %v", id, err)
+        }
+        continue
+      }
+      purged++
+    }
+    if purged > 0 {
+      log.Printf("purged %d deleted accounts", purged)
+    }
+    // Stop when a batch made no progress so that a failing account can't
+    // keep the loop spinning.
+    if len(ids) < purgeBatchSize || purged == 0 {
+      return
+    }
+  }
+}
+
+// runKarmaReconciler recomputes karma from the votes once a night to undo
+// any drift in the counts kept by the vote triggers.
+func runKarmaReconciler(ctx context.Context, appStore *store.Store) {
+  for {
+    timer := time.NewTimer(time.Until(nextDailyRun(time.Now(), karmaReconcileHour)))
+    select {
+    case <-ctx.Done():
+      timer.Stop()
+      return
+    case <-timer.C:
+    }
+
+    started := time.Now()
+    fixed, err := appStore.Users.ReconcileKarma(ctx, karmaReconcileBatch)
+    if err != nil {
+      log.Printf("karma reconciliation failed: %v", err)
+      continue
+    }
+    log.Printf("karma reconciled in %s, %d users corrected", time.Since(started).Round(time.Millisecond), fixed)
+  }
+}
+
+func nextDailyRun(now time.Time, hour int) time.Time {
+  now = now.UTC()
+  next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+  if !next.After(now) {
+    next = next.AddDate(0, 0, 1)
+  }
+  return next
+}
+
+// newJWTKeySet signs with JWT_SIGNING_KEY_FILE when it is set, and with the
+// JWT_SECRET HMAC secret otherwise.
+func newJWTKeySet(cfg config.Config) (*auth.KeySet, error) {
+  if cfg.JWTSigningKeyFile == "" {
+    if len(cfg.JWTVerifyKeyFiles) > 0 {
+      return nil, errors.New("JWT_VERIFICATION_KEY_FILES requires JWT_SIGNING_KEY_FILE")
+    }
+    return auth.NewHMACKeySet([]byte(cfg.JWTSecret)), nil
+  }
+  signing, err := os.ReadFile(cfg.JWTSigningKeyFile)
+  if err != nil {
+    return nil, err
+  }
+  verification := make([][]byte, 0, len(cfg.JWTVerifyKeyFiles))
+  for _, path := range cfg.JWTVerifyKeyFiles {
+    data, err := os.ReadFile(path)
+    if err != nil {
+      return nil, err
+    }
+    verification = append(verification, data)
+  }
+  return auth.NewKeySet(signing, verification...)
+}
+
+// newPasswordPolicy extends the default policy with the configured lengths,
+// an extra blocklist file and the breached password corpus.
+func newPasswordPolicy(cfg config.Config) (auth.PasswordPolicy, error) {
+  policy := auth.DefaultPasswordPolicy()
+  policy.MinLength = cfg.PasswordMinLength
+  policy.MaxLength = cfg.PasswordMaxLength
+  if cfg.PasswordBlocklist != "" {
+    file, err := os.Open(cfg.PasswordBlocklist)
+    if err != nil {
+      return auth.PasswordPolicy{}, err
+    }
+    defer file.Close()
+    if err := policy.AddBlocklist(file); err != nil {
+      return auth.PasswordPolicy{}, err
+    }
+  }
+  if cfg.PasswordBreachDir != "" {
+    if _, err := os.Stat(cfg.PasswordBreachDir); err != nil {
+      return auth.PasswordPolicy{}, err
+    }
+    policy.Breaches = &auth.BreachCorpus{Dir: cfg.PasswordBreachDir, MinCount: 1}
+  }
+  return policy, nil
+}
+
+// newThrottleBackend keeps login failures in memory unless
+// LOGIN_THROTTLE_BACKEND=postgres, which shares them between replicas.
+func newThrottleBackend(cfg config.Config, appStore *store.Store) throttle.Backend {
+  if cfg.LoginThrottleBackend == "postgres" {
+    return appStore.LoginAttempts
+  }
+  return throttle.NewMemoryBackend()
+}
+
+// newMailer picks the mail transport from MAIL_DRIVER: "smtp" sends for
+// real, anything else writes messages to MAIL_DIR or the log.
+func newMailer(cfg config.Config) mail.Mailer {
+  if cfg.MailDriver == "smtp" {
+    return mail.SMTPMailer{
+      Addr:     cfg.SMTPAddr,
+      Username: cfg.SMTPUsername,
+      Password: cfg.SMTPPassword,
+      From:     cfg.MailFrom,
+    }
+  }
+  return mail.FileMailer{Dir: cfg.MailDir}
+}
+
 func shouldMigrate(raw string) bool {
   switch strings.ToLower(strings.TrimSpace(raw)) {
   case "1", "true", "yes", "y", "on":
@@ -0,0 +1,21 @@
+-- +goose Up
+create table if not exists comments (
+  id uuid primary key default gen_random_uuid(),
+  post_id uuid not null references posts(id) on delete cascade,
+  parent_id uuid references comments(id) on delete cascade,
+  user_id uuid not null references users(id) on delete cascade,
+  body text not null,
+  created_at timestamptz not null default now()
+);
+
+create index if not exists comments_post_roots_idx
+  on comments (post_id, created_at, id)
+  where parent_id is null;
+
+create index if not exists comments_parent_idx
+  on comments (parent_id, created_at, id);
+
+-- +goose Down
+drop index if exists comments_parent_idx;
+drop index if exists comments_post_roots_idx;
+drop table if exists comments;
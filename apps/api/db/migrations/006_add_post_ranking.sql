@@ -0,0 +1,57 @@
+-- +goose Up
+-- +goose StatementBegin
+create or replace function post_hot_rank(score integer, created_at timestamptz)
+returns double precision as $$
+  select (sign(score) * log(greatest(abs(score), 1)) + extract(epoch from created_at) / 45000)::double precision
+$$ language sql immutable;
+-- +goose StatementEnd
+
+alter table posts
+  add column if not exists score integer not null default 0;
+
+update posts p
+set score = coalesce((select sum(v.value) from post_votes v where v.post_id = p.id), 0);
+
+alter table posts
+  add column if not exists hot_rank double precision
+  generated always as (post_hot_rank(score, created_at)) stored;
+
+-- +goose StatementBegin
+create or replace function post_votes_apply_score()
+returns trigger as $$
+begin
+  if TG_OP = 'INSERT' then
+    update posts set score = score + NEW.value where id = NEW.post_id;
+  elsif TG_OP = 'UPDATE' then
+    update posts set score = score - OLD.value + NEW.value where id = NEW.post_id;
+  elsif TG_OP = 'DELETE' then
+    update posts set score = score - OLD.value where id = OLD.post_id;
+  end if;
+  return null;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+
+drop trigger if exists post_votes_apply_score on post_votes;
+create trigger post_votes_apply_score
+after insert or update or delete on post_votes
+for each row
+execute function post_votes_apply_score();
+
+create index if not exists posts_new_idx on posts (created_at desc, id desc);
+create index if not exists posts_top_idx on posts (score desc, created_at desc, id desc);
+create index if not exists posts_hot_idx on posts (hot_rank desc, id desc);
+
+-- +goose Down
+drop index if exists posts_hot_idx;
+drop index if exists posts_top_idx;
+drop index if exists posts_new_idx;
+drop trigger if exists post_votes_apply_score on post_votes;
+-- +goose StatementBegin
+drop function if exists post_votes_apply_score();
+-- +goose StatementEnd
+alter table posts drop column if exists hot_rank;
+alter table posts drop column if exists score;
+-- +goose StatementBegin
+drop function if exists post_hot_rank(integer, timestamptz);
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+alter table posts
+  add column if not exists edited_at timestamptz,
+  add column if not exists deleted_at timestamptz;
+
+create table if not exists post_revisions (
+  id uuid primary key default gen_random_uuid(),
+  post_id uuid not null references posts(id) on delete cascade,
+  title text not null,
+  body text not null,
+  created_at timestamptz not null default now()
+);
+
+create index if not exists post_revisions_post_idx
+  on post_revisions (post_id, created_at desc);
+
+-- +goose Down
+drop index if exists post_revisions_post_idx;
+drop table if exists post_revisions;
+alter table posts drop column if exists deleted_at;
+alter table posts drop column if exists edited_at;
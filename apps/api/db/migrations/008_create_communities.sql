@@ -0,0 +1,55 @@
+-- +goose Up
+create table if not exists communities (
+  id uuid primary key default gen_random_uuid(),
+  slug text not null,
+  name text not null,
+  description text not null default '',
+  visibility text not null default 'public' check (visibility in ('public', 'restricted', 'private')),
+  owner_id uuid not null references users(id) on delete cascade,
+  created_at timestamptz not null default now(),
+  updated_at timestamptz not null default now(),
+  constraint communities_slug_unique unique (slug)
+);
+
+drop trigger if exists communities_set_updated_at on communities;
+create trigger communities_set_updated_at
+before update on communities
+for each row
+execute function set_updated_at();
+
+create table if not exists community_members (
+  community_id uuid not null references communities(id) on delete cascade,
+  user_id uuid not null references users(id) on delete cascade,
+  role text not null default 'member' check (role in ('owner', 'member')),
+  created_at timestamptz not null default now(),
+  primary key (community_id, user_id)
+);
+
+create index if not exists community_members_user_idx
+  on community_members (user_id);
+
+create table if not exists community_subscriptions (
+  community_id uuid not null references communities(id) on delete cascade,
+  user_id uuid not null references users(id) on delete cascade,
+  created_at timestamptz not null default now(),
+  primary key (user_id, community_id)
+);
+
+alter table posts
+  add column if not exists community_id uuid references communities(id) on delete cascade;
+
+create index if not exists posts_community_new_idx
+  on posts (community_id, created_at desc, id desc);
+
+create index if not exists posts_community_hot_idx
+  on posts (community_id, hot_rank desc, id desc);
+
+-- +goose Down
+drop index if exists posts_community_hot_idx;
+drop index if exists posts_community_new_idx;
+alter table posts drop column if exists community_id;
+drop table if exists community_subscriptions;
+drop index if exists community_members_user_idx;
+drop table if exists community_members;
+drop trigger if exists communities_set_updated_at on communities;
+drop table if exists communities;
@@ -0,0 +1,23 @@
+-- +goose Up
+alter table posts
+  add column if not exists search_vector tsvector
+  generated always as (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(body, '')), 'B')
+  ) stored;
+
+create index if not exists posts_search_idx
+  on posts using gin (search_vector);
+
+alter table comments
+  add column if not exists search_vector tsvector
+  generated always as (to_tsvector('english', coalesce(body, ''))) stored;
+
+create index if not exists comments_search_idx
+  on comments using gin (search_vector);
+
+-- +goose Down
+drop index if exists comments_search_idx;
+alter table comments drop column if exists search_vector;
+drop index if exists posts_search_idx;
+alter table posts drop column if exists search_vector;
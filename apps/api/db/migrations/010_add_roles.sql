@@ -0,0 +1,22 @@
+-- +goose Up
+alter table users
+  add column if not exists role text not null default 'user';
+
+alter table users
+  drop constraint if exists users_role_check;
+alter table users
+  add constraint users_role_check check (role in ('user', 'admin'));
+
+alter table community_members
+  drop constraint if exists community_members_role_check;
+alter table community_members
+  add constraint community_members_role_check check (role in ('owner', 'moderator', 'member'));
+
+-- +goose Down
+update community_members set role = 'member' where role = 'moderator';
+alter table community_members
+  drop constraint if exists community_members_role_check;
+alter table community_members
+  add constraint community_members_role_check check (role in ('owner', 'member'));
+alter table users drop constraint if exists users_role_check;
+alter table users drop column if exists role;
@@ -0,0 +1,70 @@
+-- +goose Up
+alter table posts
+  add column if not exists removed_at timestamptz,
+  add column if not exists locked_at timestamptz,
+  add column if not exists pinned_at timestamptz;
+
+create table if not exists reports (
+  id uuid primary key default gen_random_uuid(),
+  post_id uuid not null references posts(id) on delete cascade,
+  reporter_id uuid not null references users(id) on delete cascade,
+  reason text not null check (reason in ('spam', 'harassment', 'hate', 'violence', 'sexual', 'misinformation', 'self_harm', 'other')),
+  details text not null default '',
+  status text not null default 'open' check (status in ('open', 'resolved', 'dismissed')),
+  created_at timestamptz not null default now(),
+  resolved_at timestamptz,
+  resolved_by uuid references users(id) on delete set null
+);
+
+create unique index if not exists reports_open_unique
+  on reports (post_id, reporter_id)
+  where status = 'open';
+
+create index if not exists reports_open_post_idx
+  on reports (post_id)
+  where status = 'open';
+
+-- moderation_log deliberately has no foreign keys so entries outlive the
+-- users, posts and communities they mention.
+create table if not exists moderation_log (
+  id uuid primary key default gen_random_uuid(),
+  community_id uuid,
+  moderator_id uuid not null,
+  action text not null,
+  target_type text not null,
+  target_id uuid not null,
+  reason text not null default '',
+  created_at timestamptz not null default now()
+);
+
+create index if not exists moderation_log_community_idx
+  on moderation_log (community_id, created_at desc, id desc);
+
+-- +goose StatementBegin
+create or replace function moderation_log_append_only()
+returns trigger as $$
+begin
+  raise exception 'moderation_log is append-only';
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+
+drop trigger if exists moderation_log_append_only on moderation_log;
+create trigger moderation_log_append_only
+before update or delete on moderation_log
+for each row
+execute function moderation_log_append_only();
+
+-- +goose Down
+drop trigger if exists moderation_log_append_only on moderation_log;
+-- +goose StatementBegin
+drop function if exists moderation_log_append_only();
+-- +goose StatementEnd
+drop index if exists moderation_log_community_idx;
+drop table if exists moderation_log;
+drop index if exists reports_open_post_idx;
+drop index if exists reports_open_unique;
+drop table if exists reports;
+alter table posts drop column if exists pinned_at;
+alter table posts drop column if exists locked_at;
+alter table posts drop column if exists removed_at;
@@ -0,0 +1,24 @@
+-- +goose Up
+create table if not exists bans (
+  id uuid primary key default gen_random_uuid(),
+  user_id uuid not null references users(id) on delete cascade,
+  community_id uuid references communities(id) on delete cascade,
+  reason text not null default '',
+  banned_by uuid references users(id) on delete set null,
+  created_at timestamptz not null default now(),
+  expires_at timestamptz,
+  revoked_at timestamptz
+);
+
+create index if not exists bans_active_user_idx
+  on bans (user_id, community_id)
+  where revoked_at is null;
+
+create index if not exists bans_active_community_idx
+  on bans (community_id, created_at desc)
+  where revoked_at is null;
+
+-- +goose Down
+drop index if exists bans_active_community_idx;
+drop index if exists bans_active_user_idx;
+drop table if exists bans;
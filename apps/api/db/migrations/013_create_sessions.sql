@@ -0,0 +1,34 @@
+-- +goose Up
+create table if not exists sessions (
+  id uuid primary key default gen_random_uuid(),
+  user_id uuid not null references users(id) on delete cascade,
+  user_agent text not null default '',
+  ip text not null default '',
+  created_at timestamptz not null default now(),
+  last_seen_at timestamptz not null default now(),
+  expires_at timestamptz not null,
+  revoked_at timestamptz
+);
+
+create index if not exists sessions_active_user_idx
+  on sessions (user_id, last_seen_at desc)
+  where revoked_at is null;
+
+-- Every refresh token ever issued for a session is kept so that replaying a
+-- rotated-out token can be detected and the session shut down.
+create table if not exists refresh_tokens (
+  id uuid primary key default gen_random_uuid(),
+  session_id uuid not null references sessions(id) on delete cascade,
+  token_hash text not null,
+  created_at timestamptz not null default now(),
+  used_at timestamptz,
+  constraint refresh_tokens_hash_unique unique (token_hash)
+);
+
+create index if not exists refresh_tokens_session_idx on refresh_tokens (session_id);
+
+-- +goose Down
+drop index if exists refresh_tokens_session_idx;
+drop table if exists refresh_tokens;
+drop index if exists sessions_active_user_idx;
+drop table if exists sessions;
@@ -0,0 +1,24 @@
+-- +goose Up
+alter table users add column if not exists email_verified_at timestamptz;
+
+-- Single-use tokens mailed to the user. Only a hash of the token is stored.
+create table if not exists account_tokens (
+  id uuid primary key default gen_random_uuid(),
+  user_id uuid not null references users(id) on delete cascade,
+  purpose text not null,
+  token_hash text not null,
+  created_at timestamptz not null default now(),
+  expires_at timestamptz not null,
+  used_at timestamptz,
+  constraint account_tokens_purpose_check check (purpose in ('password_reset', 'email_verification')),
+  constraint account_tokens_hash_unique unique (token_hash)
+);
+
+create index if not exists account_tokens_user_idx
+  on account_tokens (user_id, purpose)
+  where used_at is null;
+
+-- +goose Down
+drop index if exists account_tokens_user_idx;
+drop table if exists account_tokens;
+alter table users drop column if exists email_verified_at;
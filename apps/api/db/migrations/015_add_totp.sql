@@ -0,0 +1,26 @@
+-- +goose Up
+-- totp_secret is set on enrollment and only takes effect once the user has
+-- confirmed a code (totp_enabled_at). totp_last_step stops a code from being
+-- replayed within its validity window.
+alter table users add column if not exists totp_secret text;
+alter table users add column if not exists totp_enabled_at timestamptz;
+alter table users add column if not exists totp_last_step bigint not null default 0;
+
+create table if not exists mfa_recovery_codes (
+  id uuid primary key default gen_random_uuid(),
+  user_id uuid not null references users(id) on delete cascade,
+  code_hash text not null,
+  created_at timestamptz not null default now(),
+  used_at timestamptz
+);
+
+create index if not exists mfa_recovery_codes_user_idx
+  on mfa_recovery_codes (user_id)
+  where used_at is null;
+
+-- +goose Down
+drop index if exists mfa_recovery_codes_user_idx;
+drop table if exists mfa_recovery_codes;
+alter table users drop column if exists totp_last_step;
+alter table users drop column if exists totp_enabled_at;
+alter table users drop column if exists totp_secret;
@@ -0,0 +1,24 @@
+-- +goose Up
+create table if not exists personal_access_tokens (
+  id uuid primary key default gen_random_uuid(),
+  user_id uuid not null references users(id) on delete cascade,
+  name text not null,
+  token_hash text not null,
+  -- token_prefix is the first few characters of the token, kept so users
+  -- can tell their tokens apart.
+  token_prefix text not null,
+  scopes text[] not null,
+  created_at timestamptz not null default now(),
+  last_used_at timestamptz,
+  expires_at timestamptz,
+  revoked_at timestamptz,
+  constraint personal_access_tokens_hash_unique unique (token_hash)
+);
+
+create index if not exists personal_access_tokens_user_idx
+  on personal_access_tokens (user_id, created_at desc)
+  where revoked_at is null;
+
+-- +goose Down
+drop index if exists personal_access_tokens_user_idx;
+drop table if exists personal_access_tokens;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- Accounts created through an identity provider have no password; an empty
+-- password_hash never matches.
+create table if not exists identities (
+  id uuid primary key default gen_random_uuid(),
+  user_id uuid not null references users(id) on delete cascade,
+  provider text not null,
+  subject text not null,
+  email text not null default '',
+  created_at timestamptz not null default now(),
+  last_login_at timestamptz,
+  constraint identities_subject_unique unique (provider, subject),
+  constraint identities_user_provider_unique unique (user_id, provider)
+);
+
+-- Pending OIDC logins. The row is keyed by a hash of the state parameter and
+-- deleted when the provider redirects back.
+create table if not exists oidc_login_states (
+  state_hash text primary key,
+  provider text not null,
+  nonce text not null,
+  code_verifier text not null,
+  link_user_id uuid references users(id) on delete cascade,
+  created_at timestamptz not null default now(),
+  expires_at timestamptz not null
+);
+
+-- +goose Down
+drop table if exists oidc_login_states;
+drop table if exists identities;
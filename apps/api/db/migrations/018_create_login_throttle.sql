@@ -0,0 +1,24 @@
+-- +goose Up
+-- Failed logins and lockouts shared by every API instance when
+-- LOGIN_THROTTLE_BACKEND=postgres. Keys are "account:<id>" or "ip:<address>".
+create table if not exists login_failures (
+  key text not null,
+  failed_at timestamptz not null
+);
+
+create index if not exists login_failures_key_idx
+  on login_failures (key, failed_at);
+
+create index if not exists login_failures_failed_at_idx
+  on login_failures (failed_at);
+
+create table if not exists login_lockouts (
+  key text primary key,
+  locked_until timestamptz not null
+);
+
+-- +goose Down
+drop table if exists login_lockouts;
+drop index if exists login_failures_failed_at_idx;
+drop index if exists login_failures_key_idx;
+drop table if exists login_failures;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- users.updated_at (kept by users_set_updated_at) records the last change
+-- to any account setting; username_changed_at enforces the rename cooldown.
+alter table users add column if not exists username_changed_at timestamptz;
+
+-- An email_change token carries the address it confirms.
+alter table account_tokens add column if not exists new_email text;
+
+alter table account_tokens drop constraint if exists account_tokens_purpose_check;
+alter table account_tokens add constraint account_tokens_purpose_check
+  check (purpose in ('password_reset', 'email_verification', 'email_change'));
+
+-- +goose Down
+delete from account_tokens where purpose = 'email_change';
+alter table account_tokens drop constraint if exists account_tokens_purpose_check;
+alter table account_tokens add constraint account_tokens_purpose_check
+  check (purpose in ('password_reset', 'email_verification'));
+alter table account_tokens drop column if exists new_email;
+alter table users drop column if exists username_changed_at;
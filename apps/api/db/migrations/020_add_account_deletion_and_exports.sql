@@ -0,0 +1,36 @@
+-- +goose Up
+-- delete_after is set while an account waits out its deletion grace period.
+alter table users add column if not exists delete_after timestamptz;
+
+create index if not exists users_delete_after_idx
+  on users (delete_after)
+  where delete_after is not null;
+
+-- Posts and comments of deleted accounts are handed to this placeholder
+-- instead of cascading away, so threads stay intact under a "[deleted]"
+-- author. It has no password, identities or usable email and cannot log in.
+insert into users (id, email, username, password_hash, email_verified_at)
+values ('00000000-0000-0000-0000-000000000000', 'deleted@invalid', '[deleted]', '', now())
+on conflict do nothing;
+
+create table if not exists data_exports (
+  id uuid primary key default gen_random_uuid(),
+  user_id uuid not null references users(id) on delete cascade,
+  status text not null default 'pending',
+  archive bytea,
+  created_at timestamptz not null default now(),
+  completed_at timestamptz,
+  expires_at timestamptz,
+  constraint data_exports_status_check check (status in ('pending', 'ready', 'failed'))
+);
+
+create index if not exists data_exports_user_idx
+  on data_exports (user_id, created_at desc);
+
+-- +goose Down
+drop index if exists data_exports_user_idx;
+drop table if exists data_exports;
+-- Content already handed to the placeholder goes with it.
+delete from users where id = '00000000-0000-0000-0000-000000000000';
+drop index if exists users_delete_after_idx;
+alter table users drop column if exists delete_after;
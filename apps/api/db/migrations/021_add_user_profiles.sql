@@ -0,0 +1,24 @@
+-- +goose Up
+alter table users
+  add column if not exists display_name text not null default '',
+  add column if not exists bio text not null default '',
+  add column if not exists avatar_url text not null default '';
+
+alter table users drop constraint if exists users_profile_length_check;
+alter table users add constraint users_profile_length_check
+  check (char_length(display_name) <= 50 and char_length(bio) <= 500 and char_length(avatar_url) <= 2048);
+
+-- Profile pages list a user's history newest first.
+create index if not exists posts_user_created_idx on posts (user_id, created_at desc, id desc);
+create index if not exists comments_user_created_idx on comments (user_id, created_at desc, id desc);
+create index if not exists post_votes_user_created_idx on post_votes (user_id, created_at desc, post_id desc);
+
+-- +goose Down
+drop index if exists post_votes_user_created_idx;
+drop index if exists comments_user_created_idx;
+drop index if exists posts_user_created_idx;
+alter table users drop constraint if exists users_profile_length_check;
+alter table users
+  drop column if exists avatar_url,
+  drop column if exists bio,
+  drop column if exists display_name;
@@ -0,0 +1,50 @@
+-- +goose Up
+-- Karma is the sum of the votes on a user's content, kept up to date by
+-- post_votes_apply_karma in the same transaction as each vote and
+-- recomputed nightly to correct drift. Comments cannot be voted on yet, so
+-- nothing accrues to comment_karma so far.
+alter table users
+  add column if not exists post_karma integer not null default 0,
+  add column if not exists comment_karma integer not null default 0;
+
+update users u
+set post_karma = coalesce((
+  select sum(v.value)
+  from post_votes v
+  join posts p on p.id = v.post_id
+  where p.user_id = u.id
+), 0);
+
+-- +goose StatementBegin
+create or replace function post_votes_apply_karma()
+returns trigger as $$
+begin
+  if TG_OP = 'INSERT' then
+    update users set post_karma = post_karma + NEW.value
+    where id = (select user_id from posts where id = NEW.post_id);
+  elsif TG_OP = 'UPDATE' then
+    update users set post_karma = post_karma - OLD.value + NEW.value
+    where id = (select user_id from posts where id = NEW.post_id);
+  elsif TG_OP = 'DELETE' then
+    update users set post_karma = post_karma - OLD.value
+    where id = (select user_id from posts where id = OLD.post_id);
+  end if;
+  return null;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+
+drop trigger if exists post_votes_apply_karma on post_votes;
+create trigger post_votes_apply_karma
+after insert or update or delete on post_votes
+for each row
+execute function post_votes_apply_karma();
+
+-- +goose Down
+drop trigger if exists post_votes_apply_karma on post_votes;
+-- +goose StatementBegin
+drop function if exists post_votes_apply_karma();
+-- +goose StatementEnd
+alter table users
+  drop column if exists comment_karma,
+  drop column if exists post_karma;
@@ -0,0 +1,75 @@
+-- +goose Up
+-- upvotes and downvotes are kept next to score by the same trigger, so the
+-- feed never has to aggregate post_votes.
+alter table posts
+  add column if not exists upvotes integer not null default 0,
+  add column if not exists downvotes integer not null default 0;
+
+update posts p
+set upvotes = coalesce(t.upvotes, 0),
+    downvotes = coalesce(t.downvotes, 0),
+    score = coalesce(t.upvotes, 0) - coalesce(t.downvotes, 0)
+from posts x
+left join (
+  select
+    post_id,
+    count(*) filter (where value = 1)::integer as upvotes,
+    count(*) filter (where value = -1)::integer as downvotes
+  from post_votes
+  group by post_id
+) t on t.post_id = x.id
+where p.id = x.id;
+
+alter table posts drop constraint if exists posts_vote_counts_check;
+alter table posts add constraint posts_vote_counts_check
+  check (upvotes >= 0 and downvotes >= 0 and score = upvotes - downvotes);
+
+-- +goose StatementBegin
+create or replace function post_votes_apply_score()
+returns trigger as $$
+begin
+  if TG_OP = 'INSERT' then
+    update posts
+    set score = score + NEW.value,
+        upvotes = upvotes + (NEW.value = 1)::integer,
+        downvotes = downvotes + (NEW.value = -1)::integer
+    where id = NEW.post_id;
+  elsif TG_OP = 'UPDATE' then
+    update posts
+    set score = score - OLD.value + NEW.value,
+        upvotes = upvotes - (OLD.value = 1)::integer + (NEW.value = 1)::integer,
+        downvotes = downvotes - (OLD.value = -1)::integer + (NEW.value = -1)::integer
+    where id = NEW.post_id;
+  elsif TG_OP = 'DELETE' then
+    update posts
+    set score = score - OLD.value,
+        upvotes = upvotes - (OLD.value = 1)::integer,
+        downvotes = downvotes - (OLD.value = -1)::integer
+    where id = OLD.post_id;
+  end if;
+  return null;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+create or replace function post_votes_apply_score()
+returns trigger as $$
+begin
+  if TG_OP = 'INSERT' then
+    update posts set score = score + NEW.value where id = NEW.post_id;
+  elsif TG_OP = 'UPDATE' then
+    update posts set score = score - OLD.value + NEW.value where id = NEW.post_id;
+  elsif TG_OP = 'DELETE' then
+    update posts set score = score - OLD.value where id = OLD.post_id;
+  end if;
+  return null;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+
+alter table posts drop constraint if exists posts_vote_counts_check;
+alter table posts
+  drop column if exists downvotes,
+  drop column if exists upvotes;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- Karma moves with every vote on a user's posts, but it isn't an account
+-- setting, so post_votes_apply_karma and the nightly recompute must not
+-- touch updated_at. Updates that change nothing, or change anything besides
+-- the karma columns, still do.
+drop trigger if exists users_set_updated_at on users;
+create trigger users_set_updated_at
+before update on users
+for each row
+when (
+  (to_jsonb(OLD) - 'post_karma' - 'comment_karma') is distinct from (to_jsonb(NEW) - 'post_karma' - 'comment_karma')
+  or (OLD.post_karma, OLD.comment_karma) = (NEW.post_karma, NEW.comment_karma)
+)
+execute function set_updated_at();
+
+-- +goose Down
+drop trigger if exists users_set_updated_at on users;
+create trigger users_set_updated_at
+before update on users
+for each row
+execute function set_updated_at();
@@ -5,57 +5,83 @@ import (
   "time"
 
   "github.com/golang-jwt/jwt/v5"
-  "golang.org/x/crypto/bcrypt"
 )
 
 type JWTManager struct {
-  Secret []byte
-  TTL    time.Duration
+  Keys *KeySet
+  TTL  time.Duration
 }
 
+// MFAChallengeTTL is how long a user has to enter their second factor
+// after a successful password check.
+const MFAChallengeTTL = 5 * time.Minute
+
+const purposeMFAChallenge = "mfa"
+
 type Claims struct {
-  UserID string `json:"uid"`
+  UserID    string `json:"uid"`
+  SessionID string `json:"sid"`
+  // Purpose is empty for access tokens. Tokens with a purpose are only
+  // accepted by the matching parser.
+  Purpose string `json:"pur,omitempty"`
   jwt.RegisteredClaims
 }
 
-func (m JWTManager) Generate(userID string) (string, error) {
-  now := time.Now()
-  claims := Claims{
-    UserID: userID,
-    RegisteredClaims: jwt.RegisteredClaims{
-      IssuedAt:  jwt.NewNumericDate(now),
-      ExpiresAt: jwt.NewNumericDate(now.Add(m.TTL)),
-    },
-  }
-  token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-  return token.SignedString(m.Secret)
+func (m JWTManager) Generate(userID string, sessionID string) (string, error) {
+  return m.sign(Claims{UserID: userID, SessionID: sessionID}, m.TTL)
+}
+
+// GenerateMFAChallenge issues the short-lived token a password login returns
+// when the account has two-factor authentication enabled.
+func (m JWTManager) GenerateMFAChallenge(userID string) (string, error) {
+  return m.sign(Claims{UserID: userID, Purpose: purposeMFAChallenge}, MFAChallengeTTL)
 }
 
 func (m JWTManager) Parse(tokenString string) (Claims, error) {
-  token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-    if token.Method != jwt.SigningMethodHS256 {
-      return nil, errors.New("unexpected signing method")
-    }
-    return m.Secret, nil
-  })
+  claims, err := m.parse(tokenString)
   if err != nil {
     return Claims{}, err
   }
-  claims, ok := token.Claims.(*Claims)
-  if !ok || !token.Valid {
+  if claims.Purpose != "" || claims.SessionID == "" {
     return Claims{}, errors.New("invalid token")
   }
-  return *claims, nil
+  return claims, nil
 }
 
-func HashPassword(password string) (string, error) {
-  hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// ParseMFAChallenge returns the user ID of a challenge token.
+func (m JWTManager) ParseMFAChallenge(tokenString string) (string, error) {
+  claims, err := m.parse(tokenString)
   if err != nil {
     return "", err
   }
-  return string(hash), nil
+  if claims.Purpose != purposeMFAChallenge {
+    return "", errors.New("invalid token")
+  }
+  return claims.UserID, nil
+}
+
+// JWKS lists the public keys other services can verify our tokens with.
+func (m JWTManager) JWKS() JWKSet {
+  return m.Keys.JWKS()
+}
+
+func (m JWTManager) sign(claims Claims, ttl time.Duration) (string, error) {
+  now := time.Now()
+  claims.RegisteredClaims = jwt.RegisteredClaims{
+    IssuedAt:  jwt.NewNumericDate(now),
+    ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+  }
+  return m.Keys.sign(claims)
 }
 
-func CheckPassword(hash string, password string) error {
-  return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+func (m JWTManager) parse(tokenString string) (Claims, error) {
+  token, err := jwt.ParseWithClaims(tokenString, &Claims{}, m.Keys.keyFunc)
+  if err != nil {
+    return Claims{}, err
+  }
+  claims, ok := token.Claims.(*Claims)
+  if !ok || !token.Valid {
+    return Claims{}, errors.New("invalid token")
+  }
+  return *claims, nil
 }
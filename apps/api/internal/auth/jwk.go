@@ -0,0 +1,172 @@
+package auth
+
+import (
+  "crypto"
+  "crypto/ecdsa"
+  "crypto/ed25519"
+  "crypto/elliptic"
+  "crypto/rsa"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/json"
+  "math/big"
+)
+
+// JWK is a public key in JSON Web Key form (RFC 7517). RSA, P-256 EC and
+// Ed25519 keys are supported.
+type JWK struct {
+  KeyType   string `json:"kty"`
+  KeyID     string `json:"kid"`
+  Use       string `json:"use,omitempty"`
+  Algorithm string `json:"alg,omitempty"`
+  N         string `json:"n,omitempty"`
+  E         string `json:"e,omitempty"`
+  Curve     string `json:"crv,omitempty"`
+  X         string `json:"x,omitempty"`
+  Y         string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+  Keys []JWK `json:"keys"`
+}
+
+// PublicKeys returns the usable signing keys by key ID. Keys that are
+// malformed, of an unsupported type or meant for encryption are skipped.
+func (s JWKSet) PublicKeys() map[string]crypto.PublicKey {
+  keys := make(map[string]crypto.PublicKey, len(s.Keys))
+  for _, jwk := range s.Keys {
+    if jwk.Use != "" && jwk.Use != "sig" {
+      continue
+    }
+    if key, ok := jwk.PublicKey(); ok {
+      keys[jwk.KeyID] = key
+    }
+  }
+  return keys
+}
+
+// PublicKey decodes the key material.
+func (k JWK) PublicKey() (crypto.PublicKey, bool) {
+  switch k.KeyType {
+  case "RSA":
+    n, ok := decodeBigInt(k.N)
+    if !ok {
+      return nil, false
+    }
+    e, ok := decodeBigInt(k.E)
+    if !ok || !e.IsInt64() {
+      return nil, false
+    }
+    return &rsa.PublicKey{N: n, E: int(e.Int64())}, true
+  case "EC":
+    if k.Curve != "P-256" {
+      return nil, false
+    }
+    x, ok := decodeBigInt(k.X)
+    if !ok {
+      return nil, false
+    }
+    y, ok := decodeBigInt(k.Y)
+    if !ok {
+      return nil, false
+    }
+    key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+    if !key.Curve.IsOnCurve(x, y) {
+      return nil, false
+    }
+    return key, true
+  case "OKP":
+    if k.Curve != "Ed25519" {
+      return nil, false
+    }
+    x, err := base64.RawURLEncoding.DecodeString(k.X)
+    if err != nil || len(x) != ed25519.PublicKeySize {
+      return nil, false
+    }
+    return ed25519.PublicKey(x), true
+  default:
+    return nil, false
+  }
+}
+
+// PublicJWK encodes a public key for publication. kid may be empty, in which
+// case the key's thumbprint is used.
+func PublicJWK(kid string, key crypto.PublicKey) (JWK, bool) {
+  var jwk JWK
+  switch k := key.(type) {
+  case *rsa.PublicKey:
+    jwk = JWK{
+      KeyType:   "RSA",
+      Algorithm: "RS256",
+      N:         base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+      E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+    }
+  case *ecdsa.PublicKey:
+    if k.Curve != elliptic.P256() {
+      return JWK{}, false
+    }
+    jwk = JWK{
+      KeyType:   "EC",
+      Algorithm: "ES256",
+      Curve:     "P-256",
+      X:         base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, 32))),
+      Y:         base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, 32))),
+    }
+  case ed25519.PublicKey:
+    jwk = JWK{
+      KeyType:   "OKP",
+      Algorithm: "EdDSA",
+      Curve:     "Ed25519",
+      X:         base64.RawURLEncoding.EncodeToString(k),
+    }
+  default:
+    return JWK{}, false
+  }
+  jwk.Use = "sig"
+  jwk.KeyID = kid
+  if jwk.KeyID == "" {
+    jwk.KeyID = jwk.Thumbprint()
+  }
+  return jwk, true
+}
+
+// Thumbprint is the RFC 7638 SHA-256 thumbprint of the key, used as a
+// stable key ID.
+func (k JWK) Thumbprint() string {
+  var members any
+  switch k.KeyType {
+  case "RSA":
+    members = struct {
+      E   string `json:"e"`
+      Kty string `json:"kty"`
+      N   string `json:"n"`
+    }{k.E, k.KeyType, k.N}
+  case "EC":
+    members = struct {
+      Crv string `json:"crv"`
+      Kty string `json:"kty"`
+      X   string `json:"x"`
+      Y   string `json:"y"`
+    }{k.Curve, k.KeyType, k.X, k.Y}
+  default:
+    members = struct {
+      Crv string `json:"crv"`
+      Kty string `json:"kty"`
+      X   string `json:"x"`
+    }{k.Curve, k.KeyType, k.X}
+  }
+  data, _ := json.Marshal(members)
+  sum := sha256.Sum256(data)
+  return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func decodeBigInt(raw string) (*big.Int, bool) {
+  if raw == "" {
+    return nil, false
+  }
+  data, err := base64.RawURLEncoding.DecodeString(raw)
+  if err != nil {
+    return nil, false
+  }
+  return new(big.Int).SetBytes(data), true
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+  "crypto"
+  "crypto/ed25519"
+  "crypto/rsa"
+  "crypto/x509"
+  "encoding/pem"
+  "errors"
+  "fmt"
+  "sort"
+
+  "github.com/golang-jwt/jwt/v5"
+)
+
+// KeySet holds the key new tokens are signed with and every key a token may
+// be verified with. Asymmetric keys are identified by their RFC 7638
+// thumbprint in the kid header; keeping a retired key in the set during a
+// rotation lets tokens it signed run out their TTL. An HMAC secret has no
+// kid, so tokens without one are only accepted by an HMAC key set.
+type KeySet struct {
+  signer    signingKey
+  verifiers map[string]verificationKey
+}
+
+type signingKey struct {
+  id     string
+  method jwt.SigningMethod
+  key    any
+}
+
+type verificationKey struct {
+  method jwt.SigningMethod
+  key    crypto.PublicKey
+}
+
+// NewHMACKeySet signs and verifies HS256 tokens with a shared secret.
+func NewHMACKeySet(secret []byte) *KeySet {
+  return &KeySet{
+    signer:    signingKey{method: jwt.SigningMethodHS256, key: secret},
+    verifiers: map[string]verificationKey{"": {method: jwt.SigningMethodHS256, key: secret}},
+  }
+}
+
+// NewKeySet signs with a PEM encoded Ed25519 (EdDSA) or RSA (RS256) private
+// key. Tokens are also accepted from the extra PEM encoded public or private
+// keys, which is how a previous signing key stays valid during a rotation.
+func NewKeySet(signingPEM []byte, verificationPEMs ...[]byte) (*KeySet, error) {
+  private, err := parsePrivateKeyPEM(signingPEM)
+  if err != nil {
+    return nil, fmt.Errorf("signing key: %w", err)
+  }
+  public := private.Public()
+  id, method, err := describeKey(public)
+  if err != nil {
+    return nil, fmt.Errorf("signing key: %w", err)
+  }
+
+  set := &KeySet{
+    signer:    signingKey{id: id, method: method, key: private},
+    verifiers: map[string]verificationKey{id: {method: method, key: public}},
+  }
+  for i, data := range verificationPEMs {
+    public, err := parsePublicKeyPEM(data)
+    if err != nil {
+      return nil, fmt.Errorf("verification key %d: %w", i+1, err)
+    }
+    id, method, err := describeKey(public)
+    if err != nil {
+      return nil, fmt.Errorf("verification key %d: %w", i+1, err)
+    }
+    set.verifiers[id] = verificationKey{method: method, key: public}
+  }
+  return set, nil
+}
+
+// JWKS lists the public verification keys, current signing key first. It
+// is empty for an HMAC key set, whose secret must never be published.
+func (s *KeySet) JWKS() JWKSet {
+  ids := make([]string, 0, len(s.verifiers))
+  for id := range s.verifiers {
+    if id != "" && id != s.signer.id {
+      ids = append(ids, id)
+    }
+  }
+  sort.Strings(ids)
+  if s.signer.id != "" {
+    ids = append([]string{s.signer.id}, ids...)
+  }
+
+  set := JWKSet{Keys: make([]JWK, 0, len(ids))}
+  for _, id := range ids {
+    if jwk, ok := PublicJWK(id, s.verifiers[id].key); ok {
+      set.Keys = append(set.Keys, jwk)
+    }
+  }
+  return set
+}
+
+func (s *KeySet) sign(claims jwt.Claims) (string, error) {
+  token := jwt.NewWithClaims(s.signer.method, claims)
+  if s.signer.id != "" {
+    token.Header["kid"] = s.signer.id
+  }
+  return token.SignedString(s.signer.key)
+}
+
+func (s *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+  id, _ := token.Header["kid"].(string)
+  key, ok := s.verifiers[id]
+  if !ok {
+    return nil, errors.New("unknown signing key")
+  }
+  if token.Method.Alg() != key.method.Alg() {
+    return nil, errors.New("unexpected signing method")
+  }
+  return key.key, nil
+}
+
+// describeKey returns the kid and JWT algorithm for a supported public key.
+func describeKey(key crypto.PublicKey) (string, jwt.SigningMethod, error) {
+  var method jwt.SigningMethod
+  switch k := key.(type) {
+  case ed25519.PublicKey:
+    method = jwt.SigningMethodEdDSA
+  case *rsa.PublicKey:
+    if k.N.BitLen() < 2048 {
+      return "", nil, errors.New("RSA keys must be at least 2048 bits")
+    }
+    method = jwt.SigningMethodRS256
+  default:
+    return "", nil, fmt.Errorf("unsupported key type %T", key)
+  }
+  jwk, _ := PublicJWK("", key)
+  return jwk.Thumbprint(), method, nil
+}
+
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+  block, _ := pem.Decode(data)
+  if block == nil {
+    return nil, errors.New("no PEM data found")
+  }
+  switch block.Type {
+  case "PRIVATE KEY":
+    key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+    if err != nil {
+      return nil, err
+    }
+    signer, ok := key.(crypto.Signer)
+    if !ok {
+      return nil, fmt.Errorf("unsupported key type %T", key)
+    }
+    return signer, nil
+  case "RSA PRIVATE KEY":
+    return x509.ParsePKCS1PrivateKey(block.Bytes)
+  default:
+    return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+  }
+}
+
+// parsePublicKeyPEM also accepts a private key, so a retired signing key
+// file can be kept as a verification key without extracting its public half.
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+  block, _ := pem.Decode(data)
+  if block == nil {
+    return nil, errors.New("no PEM data found")
+  }
+  switch block.Type {
+  case "PUBLIC KEY":
+    return x509.ParsePKIXPublicKey(block.Bytes)
+  case "RSA PUBLIC KEY":
+    return x509.ParsePKCS1PublicKey(block.Bytes)
+  default:
+    private, err := parsePrivateKeyPEM(data)
+    if err != nil {
+      return nil, err
+    }
+    return private.Public(), nil
+  }
+}
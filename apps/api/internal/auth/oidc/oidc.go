@@ -0,0 +1,323 @@
+// Package oidc implements the relying-party side of OpenID Connect login:
+// discovery, the authorization code flow with PKCE, and ID token
+// verification against the provider's published keys.
+package oidc
+
+import (
+  "context"
+  "crypto"
+  "crypto/rand"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "net/http"
+  "net/url"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/golang-jwt/jwt/v5"
+
+  "jabber_v3/apps/api/internal/auth"
+)
+
+var (
+  ErrUnknownKey     = errors.New("oidc: id token signed with unknown key")
+  ErrInvalidIDToken = errors.New("oidc: invalid id token")
+  ErrNonceMismatch  = errors.New("oidc: nonce mismatch")
+)
+
+// keysRefreshInterval bounds how often an unknown key ID triggers a JWKS
+// refetch, so a forged kid cannot be used to hammer the provider.
+const keysRefreshInterval = time.Minute
+
+// clockSkew is tolerated when checking ID token times.
+const clockSkew = time.Minute
+
+type Config struct {
+  // Name identifies the provider in URLs and the identities table.
+  Name         string
+  Issuer       string
+  ClientID     string
+  ClientSecret string
+  RedirectURL  string
+  // Scopes requested in addition to "openid".
+  Scopes []string
+}
+
+// Claims are the ID token claims used to sign a user in.
+type Claims struct {
+  Subject           string
+  Email             string
+  EmailVerified     bool
+  Name              string
+  PreferredUsername string
+}
+
+type discoveryDocument struct {
+  Issuer                string `json:"issuer"`
+  AuthorizationEndpoint string `json:"authorization_endpoint"`
+  TokenEndpoint         string `json:"token_endpoint"`
+  JWKSURI               string `json:"jwks_uri"`
+}
+
+// Client talks to one provider. Discovery and keys are fetched lazily and
+// cached; it is safe for concurrent use.
+type Client struct {
+  cfg  Config
+  http *http.Client
+
+  mu            sync.Mutex
+  discovery     *discoveryDocument
+  keys          map[string]crypto.PublicKey
+  keysFetchedAt time.Time
+}
+
+func NewClient(cfg Config, httpClient *http.Client) *Client {
+  if httpClient == nil {
+    httpClient = &http.Client{Timeout: 10 * time.Second}
+  }
+  return &Client{cfg: cfg, http: httpClient}
+}
+
+func (c *Client) Name() string {
+  return c.cfg.Name
+}
+
+// AuthCodeURL returns the provider URL to send the browser to. state and
+// nonce are echoed back and must be checked by the caller; verifier is the
+// PKCE code verifier from NewVerifier.
+func (c *Client) AuthCodeURL(ctx context.Context, state string, nonce string, verifier string) (string, error) {
+  doc, err := c.discover(ctx)
+  if err != nil {
+    return "", err
+  }
+
+  scopes := append([]string{"openid"}, c.cfg.Scopes...)
+  query := url.Values{}
+  query.Set("response_type", "code")
+  query.Set("client_id", c.cfg.ClientID)
+  query.Set("redirect_uri", c.cfg.RedirectURL)
+  query.Set("scope", strings.Join(scopes, " "))
+  query.Set("state", state)
+  query.Set("nonce", nonce)
+  query.Set("code_challenge", codeChallenge(verifier))
+  query.Set("code_challenge_method", "S256")
+
+  separator := "?"
+  if strings.Contains(doc.AuthorizationEndpoint, "?") {
+    separator = "&"
+  }
+  return doc.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of
+// the ID token, which must carry nonce.
+func (c *Client) Exchange(ctx context.Context, code string, verifier string, nonce string) (Claims, error) {
+  doc, err := c.discover(ctx)
+  if err != nil {
+    return Claims{}, err
+  }
+
+  form := url.Values{}
+  form.Set("grant_type", "authorization_code")
+  form.Set("code", code)
+  form.Set("redirect_uri", c.cfg.RedirectURL)
+  form.Set("code_verifier", verifier)
+  if c.cfg.ClientSecret == "" {
+    form.Set("client_id", c.cfg.ClientID)
+  }
+
+  req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+  if err != nil {
+    return Claims{}, err
+  }
+  req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+  req.Header.Set("Accept", "application/json")
+  if c.cfg.ClientSecret != "" {
+    req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+  }
+
+  var token struct {
+    IDToken string `json:"id_token"`
+  }
+  if err := c.doJSON(req, &token); err != nil {
+    return Claims{}, fmt.Errorf("oidc: token exchange: %w", err)
+  }
+  if token.IDToken == "" {
+    return Claims{}, fmt.Errorf("oidc: token response has no id_token")
+  }
+
+  return c.verifyIDToken(ctx, doc, token.IDToken, nonce)
+}
+
+type idTokenClaims struct {
+  Nonce             string   `json:"nonce"`
+  AuthorizedParty   string   `json:"azp"`
+  Email             string   `json:"email"`
+  EmailVerified     flexBool `json:"email_verified"`
+  Name              string   `json:"name"`
+  PreferredUsername string   `json:"preferred_username"`
+  jwt.RegisteredClaims
+}
+
+func (c *Client) verifyIDToken(ctx context.Context, doc *discoveryDocument, raw string, nonce string) (Claims, error) {
+  var claims idTokenClaims
+  _, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+    kid, _ := token.Header["kid"].(string)
+    return c.key(ctx, doc, kid)
+  },
+    jwt.WithValidMethods([]string{"RS256", "ES256"}),
+    jwt.WithIssuer(doc.Issuer),
+    jwt.WithAudience(c.cfg.ClientID),
+    jwt.WithExpirationRequired(),
+    jwt.WithIssuedAt(),
+    jwt.WithLeeway(clockSkew),
+  )
+  if err != nil {
+    if errors.Is(err, ErrUnknownKey) {
+      return Claims{}, ErrUnknownKey
+    }
+    return Claims{}, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+  }
+
+  if len(claims.Audience) > 1 && claims.AuthorizedParty != c.cfg.ClientID {
+    return Claims{}, fmt.Errorf("%w: azp does not match client", ErrInvalidIDToken)
+  }
+  if claims.Subject == "" {
+    return Claims{}, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+  }
+  if claims.Nonce == "" || claims.Nonce != nonce {
+    return Claims{}, ErrNonceMismatch
+  }
+
+  return Claims{
+    Subject:           claims.Subject,
+    Email:             claims.Email,
+    EmailVerified:     bool(claims.EmailVerified),
+    Name:              claims.Name,
+    PreferredUsername: claims.PreferredUsername,
+  }, nil
+}
+
+func (c *Client) discover(ctx context.Context) (*discoveryDocument, error) {
+  c.mu.Lock()
+  doc := c.discovery
+  c.mu.Unlock()
+  if doc != nil {
+    return doc, nil
+  }
+
+  endpoint := strings.TrimRight(c.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+  req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+  if err != nil {
+    return nil, err
+  }
+
+  var fetched discoveryDocument
+  if err := c.doJSON(req, &fetched); err != nil {
+    return nil, fmt.Errorf("oidc: discovery: %w", err)
+  }
+  if fetched.Issuer != c.cfg.Issuer {
+    return nil, fmt.Errorf("oidc: discovery issuer %q does not match %q", fetched.Issuer, c.cfg.Issuer)
+  }
+  if fetched.AuthorizationEndpoint == "" || fetched.TokenEndpoint == "" || fetched.JWKSURI == "" {
+    return nil, fmt.Errorf("oidc: discovery document is incomplete")
+  }
+
+  c.mu.Lock()
+  c.discovery = &fetched
+  c.mu.Unlock()
+  return &fetched, nil
+}
+
+// key returns the verification key for kid, refetching the JWKS when the
+// key is unknown, e.g. after the provider rotated its keys.
+func (c *Client) key(ctx context.Context, doc *discoveryDocument, kid string) (crypto.PublicKey, error) {
+  c.mu.Lock()
+  key, ok := c.keys[kid]
+  stale := time.Since(c.keysFetchedAt) > keysRefreshInterval
+  c.mu.Unlock()
+  if ok {
+    return key, nil
+  }
+  if !stale {
+    return nil, ErrUnknownKey
+  }
+
+  req, err := http.NewRequestWithContext(ctx, http.MethodGet, doc.JWKSURI, nil)
+  if err != nil {
+    return nil, err
+  }
+  var set auth.JWKSet
+  if err := c.doJSON(req, &set); err != nil {
+    return nil, fmt.Errorf("oidc: jwks: %w", err)
+  }
+  keys := set.PublicKeys()
+
+  c.mu.Lock()
+  c.keys = keys
+  c.keysFetchedAt = time.Now()
+  c.mu.Unlock()
+
+  key, ok = keys[kid]
+  if !ok {
+    return nil, ErrUnknownKey
+  }
+  return key, nil
+}
+
+func (c *Client) doJSON(req *http.Request, out any) error {
+  res, err := c.http.Do(req)
+  if err != nil {
+    return err
+  }
+  defer res.Body.Close()
+
+  body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+  if err != nil {
+    return err
+  }
+  if res.StatusCode != http.StatusOK {
+    return fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+  }
+  return json.Unmarshal(body, out)
+}
+
+// NewRandom returns a URL-safe random string for state, nonce or the PKCE
+// verifier (43 characters, within RFC 7636's 43-128).
+func NewRandom() (string, error) {
+  buf := make([]byte, 32)
+  if _, err := rand.Read(buf); err != nil {
+    return "", err
+  }
+  return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func codeChallenge(verifier string) string {
+  sum := sha256.Sum256([]byte(verifier))
+  return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// flexBool accepts both true and "true"; some providers send
+// email_verified as a string.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+  var value any
+  if err := json.Unmarshal(data, &value); err != nil {
+    return err
+  }
+  switch v := value.(type) {
+  case bool:
+    *b = flexBool(v)
+  case string:
+    *b = flexBool(v == "true")
+  default:
+    *b = false
+  }
+  return nil
+}
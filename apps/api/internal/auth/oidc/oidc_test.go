@@ -0,0 +1,171 @@
+package oidc_test
+
+import (
+  "context"
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "testing"
+
+  "jabber_v3/apps/api/internal/auth/oidc"
+  "jabber_v3/apps/api/internal/auth/oidc/oidctest"
+)
+
+const redirectURL = "http://app.test/auth/oidc/fake/callback"
+
+func startProvider(t *testing.T) (*oidctest.Provider, *oidc.Client) {
+  t.Helper()
+  provider, server, err := oidctest.Start("client", "secret")
+  if err != nil {
+    t.Fatalf("start provider: %v", err)
+  }
+  t.Cleanup(server.Close)
+  return provider, oidc.NewClient(provider.Config("fake", redirectURL), server.Client())
+}
+
+// authorize follows the authorization URL like a browser would and returns
+// the query the provider redirected back with.
+func authorize(t *testing.T, authURL string) url.Values {
+  t.Helper()
+  client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+    return http.ErrUseLastResponse
+  }}
+  res, err := client.Get(authURL)
+  if err != nil {
+    t.Fatalf("authorize: %v", err)
+  }
+  defer res.Body.Close()
+  if res.StatusCode != http.StatusFound {
+    t.Fatalf("authorize: status %d", res.StatusCode)
+  }
+  location, err := url.Parse(res.Header.Get("Location"))
+  if err != nil {
+    t.Fatalf("authorize: %v", err)
+  }
+  return location.Query()
+}
+
+func TestLoginFlow(t *testing.T) {
+  provider, client := startProvider(t)
+  provider.SetUser(oidctest.User{Subject: "sub-1", Email: "ada@example.com", EmailVerified: true, PreferredUsername: "ada"})
+  ctx := context.Background()
+
+  authURL, err := client.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-0123456789012345678901234567890123")
+  if err != nil {
+    t.Fatalf("AuthCodeURL: %v", err)
+  }
+  callback := authorize(t, authURL)
+  if callback.Get("state") != "state-1" {
+    t.Fatalf("state = %q, want state-1", callback.Get("state"))
+  }
+
+  claims, err := client.Exchange(ctx, callback.Get("code"), "verifier-0123456789012345678901234567890123", "nonce-1")
+  if err != nil {
+    t.Fatalf("Exchange: %v", err)
+  }
+  want := oidc.Claims{Subject: "sub-1", Email: "ada@example.com", EmailVerified: true, PreferredUsername: "ada"}
+  if claims != want {
+    t.Fatalf("claims = %+v, want %+v", claims, want)
+  }
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+  provider, server, err := oidctest.Start("client", "secret")
+  if err != nil {
+    t.Fatalf("start provider: %v", err)
+  }
+  defer server.Close()
+  cfg := provider.Config("fake", redirectURL)
+  cfg.Issuer = provider.Issuer + "/"
+
+  _, err = oidc.NewClient(cfg, server.Client()).AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+  if err == nil {
+    t.Fatal("AuthCodeURL accepted a discovery document for another issuer")
+  }
+}
+
+func TestDiscoveryUnavailable(t *testing.T) {
+  server := httptest.NewServer(http.NotFoundHandler())
+  defer server.Close()
+  client := oidc.NewClient(oidc.Config{Name: "fake", Issuer: server.URL, ClientID: "client", RedirectURL: redirectURL}, server.Client())
+
+  if _, err := client.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+    t.Fatal("AuthCodeURL succeeded without a discovery document")
+  }
+}
+
+func TestAuthCodeURLSendsPKCEChallenge(t *testing.T) {
+  _, client := startProvider(t)
+
+  authURL, err := client.AuthCodeURL(context.Background(), "state", "nonce", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+  if err != nil {
+    t.Fatalf("AuthCodeURL: %v", err)
+  }
+  parsed, err := url.Parse(authURL)
+  if err != nil {
+    t.Fatalf("parse: %v", err)
+  }
+  query := parsed.Query()
+  // The challenge for the verifier in RFC 7636, appendix B.
+  if got := query.Get("code_challenge"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+    t.Errorf("code_challenge = %q", got)
+  }
+  if got := query.Get("code_challenge_method"); got != "S256" {
+    t.Errorf("code_challenge_method = %q", got)
+  }
+  if query.Get("nonce") != "nonce" || query.Get("state") != "state" {
+    t.Errorf("state or nonce missing from %s", authURL)
+  }
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+  _, client := startProvider(t)
+  ctx := context.Background()
+
+  authURL, err := client.AuthCodeURL(ctx, "state", "nonce", "the-right-verifier-0123456789012345678901234")
+  if err != nil {
+    t.Fatalf("AuthCodeURL: %v", err)
+  }
+  callback := authorize(t, authURL)
+
+  if _, err := client.Exchange(ctx, callback.Get("code"), "a-wrong-verifier-0123456789012345678901234567", "nonce"); err == nil {
+    t.Fatal("Exchange accepted a code with the wrong PKCE verifier")
+  }
+}
+
+func TestExchangeRejectsReusedCode(t *testing.T) {
+  _, client := startProvider(t)
+  ctx := context.Background()
+  verifier := "verifier-0123456789012345678901234567890123"
+
+  authURL, err := client.AuthCodeURL(ctx, "state", "nonce", verifier)
+  if err != nil {
+    t.Fatalf("AuthCodeURL: %v", err)
+  }
+  code := authorize(t, authURL).Get("code")
+
+  if _, err := client.Exchange(ctx, code, verifier, "nonce"); err != nil {
+    t.Fatalf("first Exchange: %v", err)
+  }
+  if _, err := client.Exchange(ctx, code, verifier, "nonce"); err == nil {
+    t.Fatal("Exchange accepted a code twice")
+  }
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+  _, client := startProvider(t)
+  ctx := context.Background()
+  verifier := "verifier-0123456789012345678901234567890123"
+
+  authURL, err := client.AuthCodeURL(ctx, "state", "nonce-sent", verifier)
+  if err != nil {
+    t.Fatalf("AuthCodeURL: %v", err)
+  }
+  callback := authorize(t, authURL)
+
+  _, err = client.Exchange(ctx, callback.Get("code"), verifier, "nonce-expected")
+  if !errors.Is(err, oidc.ErrNonceMismatch) {
+    t.Fatalf("Exchange error = %v, want ErrNonceMismatch", err)
+  }
+}
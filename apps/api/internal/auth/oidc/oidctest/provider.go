@@ -0,0 +1,265 @@
+// Package oidctest is an in-process OpenID Connect provider for exercising
+// the login flow without a real identity provider. It implements just
+// enough of the spec: discovery, JWKS, an authorization endpoint that
+// approves immediately as the configured user, and a token endpoint that
+// enforces PKCE.
+package oidctest
+
+import (
+  "crypto/rand"
+  "crypto/rsa"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "sync"
+  "time"
+
+  "github.com/golang-jwt/jwt/v5"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/auth/oidc"
+)
+
+const keyID = "oidctest-1"
+
+// User is who the provider signs in as.
+type User struct {
+  Subject           string
+  Email             string
+  EmailVerified     bool
+  Name              string
+  PreferredUsername string
+}
+
+type authRequest struct {
+  clientID      string
+  redirectURI   string
+  nonce         string
+  codeChallenge string
+  user          User
+}
+
+type Provider struct {
+  Issuer       string
+  ClientID     string
+  ClientSecret string
+
+  key *rsa.PrivateKey
+  mux *http.ServeMux
+
+  mu    sync.Mutex
+  user  User
+  codes map[string]authRequest
+}
+
+// New returns a provider that will be reachable at issuer. Serve it with
+// http.ListenAndServe or use Start for a test server.
+func New(issuer string, clientID string, clientSecret string) (*Provider, error) {
+  key, err := rsa.GenerateKey(rand.Reader, 2048)
+  if err != nil {
+    return nil, err
+  }
+
+  p := &Provider{
+    Issuer:       issuer,
+    ClientID:     clientID,
+    ClientSecret: clientSecret,
+    key:          key,
+    mux:          http.NewServeMux(),
+    codes:        make(map[string]authRequest),
+    user: User{
+      Subject:           "oidctest-user",
+      Email:             "oidctest@example.com",
+      EmailVerified:     true,
+      Name:              "OIDC Test",
+      PreferredUsername: "oidctest",
+    },
+  }
+  p.mux.HandleFunc("GET /.well-known/openid-configuration", p.handleDiscovery)
+  p.mux.HandleFunc("GET /jwks", p.handleJWKS)
+  p.mux.HandleFunc("GET /authorize", p.handleAuthorize)
+  p.mux.HandleFunc("POST /token", p.handleToken)
+  return p, nil
+}
+
+// Start runs a provider on a local test server. Close the server when done.
+func Start(clientID string, clientSecret string) (*Provider, *httptest.Server, error) {
+  server := httptest.NewUnstartedServer(nil)
+  server.Start()
+  p, err := New(server.URL, clientID, clientSecret)
+  if err != nil {
+    server.Close()
+    return nil, nil, err
+  }
+  server.Config.Handler = p
+  return p, server, nil
+}
+
+// Config returns a relying-party configuration for this provider.
+func (p *Provider) Config(name string, redirectURL string) oidc.Config {
+  return oidc.Config{
+    Name:         name,
+    Issuer:       p.Issuer,
+    ClientID:     p.ClientID,
+    ClientSecret: p.ClientSecret,
+    RedirectURL:  redirectURL,
+    Scopes:       []string{"email", "profile"},
+  }
+}
+
+// SetUser changes who subsequent logins sign in as.
+func (p *Provider) SetUser(user User) {
+  p.mu.Lock()
+  defer p.mu.Unlock()
+  p.user = user
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  p.mux.ServeHTTP(w, r)
+}
+
+func (p *Provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+  writeJSON(w, http.StatusOK, map[string]any{
+    "issuer":                                p.Issuer,
+    "authorization_endpoint":                p.Issuer + "/authorize",
+    "token_endpoint":                        p.Issuer + "/token",
+    "jwks_uri":                              p.Issuer + "/jwks",
+    "response_types_supported":              []string{"code"},
+    "subject_types_supported":               []string{"public"},
+    "id_token_signing_alg_values_supported": []string{"RS256"},
+    "code_challenge_methods_supported":      []string{"S256"},
+  })
+}
+
+func (p *Provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+  jwk, _ := auth.PublicJWK(keyID, &p.key.PublicKey)
+  writeJSON(w, http.StatusOK, auth.JWKSet{Keys: []auth.JWK{jwk}})
+}
+
+// handleAuthorize approves every valid request as the current user and
+// redirects straight back with a code.
+func (p *Provider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+  query := r.URL.Query()
+  redirectURI, err := url.Parse(query.Get("redirect_uri"))
+  if err != nil || redirectURI.Scheme == "" {
+    http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+    return
+  }
+  if query.Get("client_id") != p.ClientID || query.Get("response_type") != "code" {
+    http.Error(w, "invalid request", http.StatusBadRequest)
+    return
+  }
+  if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+    http.Error(w, "pkce required", http.StatusBadRequest)
+    return
+  }
+
+  code := randomString()
+  p.mu.Lock()
+  p.codes[code] = authRequest{
+    clientID:      p.ClientID,
+    redirectURI:   redirectURI.String(),
+    nonce:         query.Get("nonce"),
+    codeChallenge: query.Get("code_challenge"),
+    user:          p.user,
+  }
+  p.mu.Unlock()
+
+  back := redirectURI.Query()
+  back.Set("code", code)
+  back.Set("state", query.Get("state"))
+  redirectURI.RawQuery = back.Encode()
+  http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+  if err := r.ParseForm(); err != nil {
+    tokenError(w, "invalid_request")
+    return
+  }
+
+  clientID, clientSecret, ok := r.BasicAuth()
+  if ok {
+    clientID, _ = url.QueryUnescape(clientID)
+    clientSecret, _ = url.QueryUnescape(clientSecret)
+  } else {
+    clientID = r.PostForm.Get("client_id")
+  }
+  if clientID != p.ClientID || clientSecret != p.ClientSecret {
+    tokenError(w, "invalid_client")
+    return
+  }
+  if r.PostForm.Get("grant_type") != "authorization_code" {
+    tokenError(w, "unsupported_grant_type")
+    return
+  }
+
+  code := r.PostForm.Get("code")
+  p.mu.Lock()
+  req, found := p.codes[code]
+  delete(p.codes, code)
+  p.mu.Unlock()
+  if !found || req.redirectURI != r.PostForm.Get("redirect_uri") {
+    tokenError(w, "invalid_grant")
+    return
+  }
+
+  sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+  if base64.RawURLEncoding.EncodeToString(sum[:]) != req.codeChallenge {
+    tokenError(w, "invalid_grant")
+    return
+  }
+
+  idToken, err := p.signIDToken(req)
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+    return
+  }
+
+  writeJSON(w, http.StatusOK, map[string]any{
+    "access_token": randomString(),
+    "token_type":   "Bearer",
+    "expires_in":   3600,
+    "id_token":     idToken,
+  })
+}
+
+func (p *Provider) signIDToken(req authRequest) (string, error) {
+  now := time.Now()
+  claims := jwt.MapClaims{
+    "iss":                p.Issuer,
+    "sub":                req.user.Subject,
+    "aud":                req.clientID,
+    "iat":                now.Unix(),
+    "exp":                now.Add(5 * time.Minute).Unix(),
+    "nonce":              req.nonce,
+    "email":              req.user.Email,
+    "email_verified":     req.user.EmailVerified,
+    "name":               req.user.Name,
+    "preferred_username": req.user.PreferredUsername,
+  }
+  token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+  token.Header["kid"] = keyID
+  return token.SignedString(p.key)
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+  writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+  w.Header().Set("Content-Type", "application/json")
+  w.WriteHeader(status)
+  _ = json.NewEncoder(w).Encode(payload)
+}
+
+func randomString() string {
+  value, err := oidc.NewRandom()
+  if err != nil {
+    panic(err)
+  }
+  return value
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+  "crypto/rand"
+  "crypto/subtle"
+  "encoding/base64"
+  "errors"
+  "fmt"
+  "strings"
+
+  "golang.org/x/crypto/argon2"
+  "golang.org/x/crypto/bcrypt"
+)
+
+var (
+  ErrPasswordMismatch = errors.New("password mismatch")
+  ErrUnknownHash      = errors.New("unknown password hash format")
+)
+
+// Argon2Params are the argon2id cost settings. Memory is in KiB.
+type Argon2Params struct {
+  Memory      uint32
+  Iterations  uint32
+  Parallelism uint8
+}
+
+// DefaultArgon2Params is the OWASP recommended minimum: 19 MiB, two passes,
+// one lane.
+var DefaultArgon2Params = Argon2Params{Memory: 19 * 1024, Iterations: 2, Parallelism: 1}
+
+const (
+  argon2SaltLen = 16
+  argon2KeyLen  = 32
+)
+
+// PasswordHasher hashes new passwords with argon2id and verifies those as
+// well as legacy bcrypt hashes. Argon2id hashes are stored in the PHC string
+// format, $argon2id$v=19$m=<KiB>,t=<passes>,p=<lanes>$<salt>$<key>, so each
+// one records the parameters it was made with.
+type PasswordHasher struct {
+  Params Argon2Params
+}
+
+func (h PasswordHasher) Hash(password string) (string, error) {
+  salt := make([]byte, argon2SaltLen)
+  if _, err := rand.Read(salt); err != nil {
+    return "", err
+  }
+  p := h.Params
+  key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLen)
+  return fmt.Sprintf(
+    "$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+    argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+    base64.RawStdEncoding.EncodeToString(salt),
+    base64.RawStdEncoding.EncodeToString(key),
+  ), nil
+}
+
+// Verify checks a password against a stored hash. needsRehash reports that
+// the password matched but the hash is bcrypt or uses other parameters than
+// h, so it should be replaced with a fresh Hash. Accounts without a
+// password have an empty hash, which never matches.
+func (h PasswordHasher) Verify(encoded string, password string) (needsRehash bool, err error) {
+  switch {
+  case encoded == "":
+    return false, ErrPasswordMismatch
+  case strings.HasPrefix(encoded, "$argon2id$"):
+    params, salt, key, err := decodeArgon2(encoded)
+    if err != nil {
+      return false, err
+    }
+    candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+    if subtle.ConstantTimeCompare(candidate, key) != 1 {
+      return false, ErrPasswordMismatch
+    }
+    return params != h.Params || len(salt) != argon2SaltLen || len(key) != argon2KeyLen, nil
+  case strings.HasPrefix(encoded, "$2"):
+    err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+    if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+      return false, ErrPasswordMismatch
+    }
+    if err != nil {
+      return false, err
+    }
+    return true, nil
+  default:
+    return false, ErrUnknownHash
+  }
+}
+
+func decodeArgon2(encoded string) (Argon2Params, []byte, []byte, error) {
+  parts := strings.Split(encoded, "$")
+  if len(parts) != 6 {
+    return Argon2Params{}, nil, nil, ErrUnknownHash
+  }
+  var version int
+  if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+    return Argon2Params{}, nil, nil, ErrUnknownHash
+  }
+  var params Argon2Params
+  if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+    return Argon2Params{}, nil, nil, ErrUnknownHash
+  }
+  salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+  if err != nil {
+    return Argon2Params{}, nil, nil, ErrUnknownHash
+  }
+  key, err := base64.RawStdEncoding.DecodeString(parts[5])
+  if err != nil || len(key) == 0 {
+    return Argon2Params{}, nil, nil, ErrUnknownHash
+  }
+  return params, salt, key, nil
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+  "bufio"
+  "crypto/sha1"
+  _ "embed"
+  "encoding/hex"
+  "errors"
+  "io"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "unicode"
+  "unicode/utf8"
+)
+
+// Password policy violations, reported to clients per field.
+const (
+  PasswordTooShort = "too_short"
+  PasswordTooLong  = "too_long"
+  PasswordCommon   = "too_common"
+  PasswordSimilar  = "too_similar"
+  PasswordBreached = "breached"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// PasswordPolicy decides which new passwords are acceptable. Lengths count
+// characters, not bytes.
+type PasswordPolicy struct {
+  MinLength int
+  MaxLength int
+  // Blocklist holds lowercased passwords that are refused outright.
+  Blocklist map[string]struct{}
+  // Breaches is consulted when set.
+  Breaches *BreachCorpus
+}
+
+// DefaultPasswordPolicy refuses passwords shorter than 8 or longer than 256
+// characters and the built-in list of common passwords.
+func DefaultPasswordPolicy() PasswordPolicy {
+  policy := PasswordPolicy{MinLength: 8, MaxLength: 256, Blocklist: make(map[string]struct{})}
+  _ = policy.AddBlocklist(strings.NewReader(commonPasswords))
+  return policy
+}
+
+// AddBlocklist adds one password per line. Blank lines and lines starting
+// with # are skipped.
+func (p *PasswordPolicy) AddBlocklist(r io.Reader) error {
+  scanner := bufio.NewScanner(r)
+  for scanner.Scan() {
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+    p.Blocklist[strings.ToLower(line)] = struct{}{}
+  }
+  return scanner.Err()
+}
+
+// Check returns the policy violations of password, or nil when it is
+// acceptable. related holds things the password must not resemble, such
+// as the username and email address. A failing breach lookup is returned
+// as an error alongside the other violations so the caller can decide
+// whether to fail open.
+func (p PasswordPolicy) Check(password string, related ...string) ([]string, error) {
+  var problems []string
+  length := utf8.RuneCountInString(password)
+  if length < p.MinLength {
+    problems = append(problems, PasswordTooShort)
+  }
+  if p.MaxLength > 0 && length > p.MaxLength {
+    // Nothing else is worth checking on an oversized password.
+    return append(problems, PasswordTooLong), nil
+  }
+  if _, ok := p.Blocklist[strings.ToLower(password)]; ok {
+    problems = append(problems, PasswordCommon)
+  }
+  if resemblesAny(password, related) {
+    problems = append(problems, PasswordSimilar)
+  }
+  if p.Breaches != nil {
+    breached, err := p.Breaches.Contains(password)
+    if err != nil {
+      return problems, err
+    }
+    if breached {
+      problems = append(problems, PasswordBreached)
+    }
+  }
+  return problems, nil
+}
+
+// minSimilarLen keeps very short usernames from ruling out every password
+// that happens to contain them.
+const minSimilarLen = 4
+
+// resemblesAny reports whether the password, ignoring case and punctuation,
+// contains or is contained in one of the related values. For an email
+// address the local part is compared.
+func resemblesAny(password string, related []string) bool {
+  normalized := alphanumeric(password)
+  if normalized == "" {
+    return false
+  }
+  for _, value := range related {
+    if at := strings.LastIndex(value, "@"); at > 0 {
+      value = value[:at]
+    }
+    value = alphanumeric(value)
+    if len(value) < minSimilarLen {
+      continue
+    }
+    if strings.Contains(normalized, value) || (len(normalized) >= minSimilarLen && strings.Contains(value, normalized)) {
+      return true
+    }
+  }
+  return false
+}
+
+func alphanumeric(value string) string {
+  return strings.Map(func(r rune) rune {
+    if unicode.IsLetter(r) || unicode.IsDigit(r) {
+      return unicode.ToLower(r)
+    }
+    return -1
+  }, value)
+}
+
+// BreachCorpus checks passwords against a local copy of a breached password
+// corpus in the Pwned Passwords range format: one file per five hex digit
+// SHA-1 prefix (for example 21BD1.txt), each line holding the remaining 35
+// hex digits and a count as SUFFIX:COUNT. Like the online k-anonymity API,
+// a lookup only needs the range for the password's prefix.
+type BreachCorpus struct {
+  Dir string
+  // MinCount ignores passwords seen fewer times than this.
+  MinCount int
+}
+
+// Contains reports whether the password is in the corpus. A missing range
+// file is treated as an empty range, so a partial corpus still works.
+func (c *BreachCorpus) Contains(password string) (bool, error) {
+  sum := sha1.Sum([]byte(password))
+  digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+  prefix, suffix := digest[:5], digest[5:]
+
+  file, err := os.Open(filepath.Join(c.Dir, prefix+".txt"))
+  if errors.Is(err, os.ErrNotExist) {
+    return false, nil
+  }
+  if err != nil {
+    return false, err
+  }
+  defer file.Close()
+
+  scanner := bufio.NewScanner(file)
+  for scanner.Scan() {
+    candidate, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+    if !strings.EqualFold(candidate, suffix) {
+      continue
+    }
+    seen, err := strconv.Atoi(strings.TrimSpace(count))
+    if err != nil {
+      seen = 1
+    }
+    return seen >= c.MinCount, nil
+  }
+  return false, scanner.Err()
+}
@@ -0,0 +1,44 @@
+package auth
+
+const (
+  RoleUser  = "user"
+  RoleAdmin = "admin"
+)
+
+type Permission string
+
+const (
+  // PermModerate covers acting on reports and removing, approving,
+  // locking or pinning content.
+  PermModerate Permission = "moderate"
+  // PermManageMembers covers adding approved members to a community.
+  PermManageMembers Permission = "manage_members"
+  // PermManageModerators covers appointing and removing moderators.
+  PermManageModerators Permission = "manage_moderators"
+  // PermManageUsers covers site-wide actions such as changing roles.
+  PermManageUsers Permission = "manage_users"
+)
+
+var communityPermissions = map[string][]Permission{
+  "owner":     {PermModerate, PermManageMembers, PermManageModerators},
+  "moderator": {PermModerate, PermManageMembers},
+}
+
+// Can reports whether a user holds perm given their site role and their
+// role in the community being acted on (empty outside of a community).
+// Site admins hold every permission.
+func Can(siteRole string, communityRole string, perm Permission) bool {
+  if siteRole == RoleAdmin {
+    return true
+  }
+  for _, granted := range communityPermissions[communityRole] {
+    if granted == perm {
+      return true
+    }
+  }
+  return false
+}
+
+func ValidRole(role string) bool {
+  return role == RoleUser || role == RoleAdmin
+}
@@ -0,0 +1,42 @@
+package auth
+
+import "strings"
+
+// Scope limits what a personal access token may do. Sessions started with
+// a password are not scoped.
+type Scope string
+
+const (
+  // ScopeRead allows every read-only (GET) request.
+  ScopeRead          Scope = "read"
+  ScopePostsWrite    Scope = "posts:write"
+  ScopeCommentsWrite Scope = "comments:write"
+  ScopeVotesWrite    Scope = "votes:write"
+)
+
+// AccessTokenPrefix marks personal access tokens so that they can be told
+// apart from JWTs without parsing, and spotted by secret scanners.
+const AccessTokenPrefix = "fpat_"
+
+func ValidScope(scope string) bool {
+  switch Scope(scope) {
+  case ScopeRead, ScopePostsWrite, ScopeCommentsWrite, ScopeVotesWrite:
+    return true
+  default:
+    return false
+  }
+}
+
+// NewAccessToken returns a personal access token and its hash.
+func NewAccessToken() (string, string, error) {
+  random, _, err := NewToken()
+  if err != nil {
+    return "", "", err
+  }
+  token := AccessTokenPrefix + random
+  return token, HashToken(token), nil
+}
+
+func IsAccessToken(token string) bool {
+  return strings.HasPrefix(token, AccessTokenPrefix)
+}
@@ -0,0 +1,90 @@
+package throttle
+
+import (
+  "context"
+  "sync"
+  "time"
+)
+
+// MemoryBackend keeps everything in process. It suits a single API
+// instance; replicas behind a load balancer each count on their own.
+type MemoryBackend struct {
+  mu       sync.Mutex
+  failures map[string][]time.Time
+  locks    map[string]time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+  return &MemoryBackend{
+    failures: make(map[string][]time.Time),
+    locks:    make(map[string]time.Time),
+  }
+}
+
+func (b *MemoryBackend) RecordFailure(ctx context.Context, key string, at time.Time) error {
+  b.mu.Lock()
+  defer b.mu.Unlock()
+  b.failures[key] = append(b.failures[key], at)
+  return nil
+}
+
+func (b *MemoryBackend) Failures(ctx context.Context, key string, since time.Time) (Window, error) {
+  b.mu.Lock()
+  defer b.mu.Unlock()
+
+  times := b.failures[key]
+  // Times are appended in order, so everything before the first recent one
+  // has left the window for good.
+  start := 0
+  for start < len(times) && !times[start].After(since) {
+    start++
+  }
+  times = times[start:]
+  if len(times) == 0 {
+    delete(b.failures, key)
+    return Window{}, nil
+  }
+  b.failures[key] = times
+  return Window{Count: len(times), Oldest: times[0], Newest: times[len(times)-1]}, nil
+}
+
+func (b *MemoryBackend) ClearFailures(ctx context.Context, key string) error {
+  b.mu.Lock()
+  defer b.mu.Unlock()
+  delete(b.failures, key)
+  return nil
+}
+
+func (b *MemoryBackend) Lock(ctx context.Context, key string, until time.Time) error {
+  b.mu.Lock()
+  defer b.mu.Unlock()
+  b.locks[key] = until
+  return nil
+}
+
+func (b *MemoryBackend) LockedUntil(ctx context.Context, key string, now time.Time) (time.Time, error) {
+  b.mu.Lock()
+  defer b.mu.Unlock()
+  until, ok := b.locks[key]
+  if !ok || !until.After(now) {
+    delete(b.locks, key)
+    return time.Time{}, nil
+  }
+  return until, nil
+}
+
+func (b *MemoryBackend) Prune(ctx context.Context, before time.Time) error {
+  b.mu.Lock()
+  defer b.mu.Unlock()
+  for key, times := range b.failures {
+    if len(times) == 0 || !times[len(times)-1].After(before) {
+      delete(b.failures, key)
+    }
+  }
+  for key, until := range b.locks {
+    if !until.After(before) {
+      delete(b.locks, key)
+    }
+  }
+  return nil
+}
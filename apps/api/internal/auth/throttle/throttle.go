@@ -0,0 +1,195 @@
+// Package throttle slows down password guessing. Failed attempts are
+// counted in sliding windows per account and per client IP; after a few
+// failures each further attempt must wait an exponentially growing delay,
+// and too many failures lock the account for a while.
+package throttle
+
+import (
+  "context"
+  "log"
+  "sync/atomic"
+  "time"
+)
+
+// Backend stores failure logs and lockouts. Keys are opaque strings.
+type Backend interface {
+  RecordFailure(ctx context.Context, key string, at time.Time) error
+  Failures(ctx context.Context, key string, since time.Time) (Window, error)
+  ClearFailures(ctx context.Context, key string) error
+  Lock(ctx context.Context, key string, until time.Time) error
+  // LockedUntil returns the end of the key's lockout, or the zero time when
+  // it is not locked at now.
+  LockedUntil(ctx context.Context, key string, now time.Time) (time.Time, error)
+  // Prune drops failures and lockouts that ended before the given time.
+  Prune(ctx context.Context, before time.Time) error
+}
+
+// Window summarizes the failures recorded for a key since some time.
+type Window struct {
+  Count  int
+  Oldest time.Time
+  Newest time.Time
+}
+
+type Policy struct {
+  // Window is how far back failures are counted.
+  Window time.Duration
+  // FreeAttempts is how many failures an account gets before delays start.
+  FreeAttempts int
+  // BaseDelay is the wait after the first delayed failure; it doubles with
+  // each failure after that, up to MaxDelay.
+  BaseDelay time.Duration
+  MaxDelay  time.Duration
+  // MaxFailures within Window locks the account for LockoutDuration.
+  MaxFailures     int
+  LockoutDuration time.Duration
+  // MaxIPFailures within Window blocks the IP until its oldest failure
+  // leaves the window. It is set high so that shared addresses keep working.
+  MaxIPFailures int
+}
+
+var DefaultPolicy = Policy{
+  Window:          15 * time.Minute,
+  FreeAttempts:    3,
+  BaseDelay:       time.Second,
+  MaxDelay:        30 * time.Second,
+  MaxFailures:     10,
+  LockoutDuration: 15 * time.Minute,
+  MaxIPFailures:   100,
+}
+
+// Decision is the outcome of Check. A zero Decision allows the attempt.
+type Decision struct {
+  RetryAfter time.Duration
+  // Locked is set when the account is locked out, as opposed to merely
+  // having to wait out a delay.
+  Locked bool
+}
+
+func (d Decision) Allowed() bool {
+  return d.RetryAfter <= 0
+}
+
+// pruneEvery is how many recorded failures pass between prunes of stale
+// backend entries.
+const pruneEvery = 500
+
+// Guard applies a Policy. Check and Fail are separate calls, so a burst of
+// concurrent attempts can get past a delay before their failures are
+// recorded; each of them still counts towards the lockout.
+type Guard struct {
+  backend  Backend
+  policy   Policy
+  now      func() time.Time
+  failures atomic.Uint64
+}
+
+func NewGuard(backend Backend, policy Policy) *Guard {
+  return &Guard{backend: backend, policy: policy, now: time.Now}
+}
+
+// Check reports whether a login attempt for the account from ip may go
+// ahead. account identifies the target, typically a user ID.
+func (g *Guard) Check(ctx context.Context, account string, ip string) (Decision, error) {
+  now := g.now()
+  lockedUntil, err := g.backend.LockedUntil(ctx, accountKey(account), now)
+  if err != nil {
+    return Decision{}, err
+  }
+  if lockedUntil.After(now) {
+    return Decision{RetryAfter: lockedUntil.Sub(now), Locked: true}, nil
+  }
+
+  since := now.Add(-g.policy.Window)
+  if ip != "" && g.policy.MaxIPFailures > 0 {
+    window, err := g.backend.Failures(ctx, ipKey(ip), since)
+    if err != nil {
+      return Decision{}, err
+    }
+    if window.Count >= g.policy.MaxIPFailures {
+      return Decision{RetryAfter: window.Oldest.Add(g.policy.Window).Sub(now)}, nil
+    }
+  }
+
+  window, err := g.backend.Failures(ctx, accountKey(account), since)
+  if err != nil {
+    return Decision{}, err
+  }
+  if delay := g.policy.delay(window.Count); delay > 0 {
+    if wait := window.Newest.Add(delay).Sub(now); wait > 0 {
+      return Decision{RetryAfter: wait}, nil
+    }
+  }
+  return Decision{}, nil
+}
+
+// Fail records a failed attempt and reports whether it locked the account.
+func (g *Guard) Fail(ctx context.Context, account string, ip string) (bool, error) {
+  now := g.now()
+  if ip != "" {
+    if err := g.backend.RecordFailure(ctx, ipKey(ip), now); err != nil {
+      return false, err
+    }
+  }
+  if err := g.backend.RecordFailure(ctx, accountKey(account), now); err != nil {
+    return false, err
+  }
+  if g.failures.Add(1)%pruneEvery == 0 {
+    go g.prune(now)
+  }
+
+  if g.policy.MaxFailures <= 0 {
+    return false, nil
+  }
+  window, err := g.backend.Failures(ctx, accountKey(account), now.Add(-g.policy.Window))
+  if err != nil {
+    return false, err
+  }
+  if window.Count < g.policy.MaxFailures {
+    return false, nil
+  }
+  if err := g.backend.Lock(ctx, accountKey(account), now.Add(g.policy.LockoutDuration)); err != nil {
+    return false, err
+  }
+  // The lockout replaces the failures that caused it, so the account
+  // starts over once it ends.
+  return true, g.backend.ClearFailures(ctx, accountKey(account))
+}
+
+// Succeed forgets the account's failures after a successful login. The
+// IP's failures are kept so that one valid account cannot be used to reset
+// the per-IP limit.
+func (g *Guard) Succeed(ctx context.Context, account string) error {
+  return g.backend.ClearFailures(ctx, accountKey(account))
+}
+
+func (g *Guard) prune(now time.Time) {
+  ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+  defer cancel()
+  if err := g.backend.Prune(ctx, now.Add(-g.policy.Window)); err != nil {
+    log.Printf("login throttle prune failed: %v", err)
+  }
+}
+
+// delay is the wait required after the given number of failures.
+func (p Policy) delay(failures int) time.Duration {
+  if failures < p.FreeAttempts || p.BaseDelay <= 0 {
+    return 0
+  }
+  delay := p.BaseDelay
+  for i := p.FreeAttempts; i < failures && delay < p.MaxDelay; i++ {
+    delay *= 2
+  }
+  if p.MaxDelay > 0 && delay > p.MaxDelay {
+    delay = p.MaxDelay
+  }
+  return delay
+}
+
+func accountKey(account string) string {
+  return "account:" + account
+}
+
+func ipKey(ip string) string {
+  return "ip:" + ip
+}
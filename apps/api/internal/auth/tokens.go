@@ -0,0 +1,31 @@
+package auth
+
+import (
+  "crypto/rand"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/hex"
+  "time"
+)
+
+// RefreshTokenTTL is how long a session stays signed in without being used.
+// Every refresh extends it.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// NewToken returns a random opaque token and the hash to store in its
+// place. Only the hash is ever persisted.
+func NewToken() (string, string, error) {
+  buf := make([]byte, 32)
+  if _, err := rand.Read(buf); err != nil {
+    return "", "", err
+  }
+  token := base64.RawURLEncoding.EncodeToString(buf)
+  return token, HashToken(token), nil
+}
+
+// HashToken hashes an opaque token for lookup. The tokens are random, so a
+// fast unsalted hash is enough.
+func HashToken(token string) string {
+  sum := sha256.Sum256([]byte(token))
+  return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+  "crypto/hmac"
+  "crypto/rand"
+  "crypto/sha1"
+  "crypto/subtle"
+  "encoding/base32"
+  "encoding/binary"
+  "fmt"
+  "net/url"
+  "strings"
+  "time"
+)
+
+// TOTP parameters from RFC 6238 as understood by common authenticator apps:
+// HMAC-SHA1, six digits, 30 second steps.
+const (
+  totpDigits = 6
+  totpPeriod = 30
+  // totpSkew accepts codes one step either side of now to allow for clock
+  // drift between the server and the phone.
+  totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random 160-bit secret, base32 encoded.
+func NewTOTPSecret() (string, error) {
+  buf := make([]byte, 20)
+  if _, err := rand.Read(buf); err != nil {
+    return "", err
+  }
+  return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPURI builds the otpauth:// URI that authenticator apps scan.
+func TOTPURI(issuer string, account string, secret string) string {
+  query := url.Values{}
+  query.Set("secret", secret)
+  query.Set("issuer", issuer)
+  query.Set("algorithm", "SHA1")
+  query.Set("digits", fmt.Sprint(totpDigits))
+  query.Set("period", fmt.Sprint(totpPeriod))
+  label := url.PathEscape(issuer + ":" + account)
+  return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// ValidateTOTP checks code against secret at time now and returns the time
+// step it matched, so callers can refuse to accept the same step twice.
+func ValidateTOTP(secret string, code string, now time.Time) (int64, bool) {
+  code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+  if len(code) != totpDigits {
+    return 0, false
+  }
+  key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+  if err != nil {
+    return 0, false
+  }
+
+  current := now.Unix() / totpPeriod
+  for step := current - totpSkew; step <= current+totpSkew; step++ {
+    if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+      return step, true
+    }
+  }
+  return 0, false
+}
+
+func totpCode(key []byte, step int64) string {
+  var msg [8]byte
+  binary.BigEndian.PutUint64(msg[:], uint64(step))
+  mac := hmac.New(sha1.New, key)
+  mac.Write(msg[:])
+  sum := mac.Sum(nil)
+
+  offset := sum[len(sum)-1] & 0x0f
+  value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+  return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// NewRecoveryCodes returns count single-use codes formatted for reading
+// aloud, e.g. "k3f9-x2q7-m8pd", along with their hashes.
+func NewRecoveryCodes(count int) ([]string, []string, error) {
+  const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+  codes := make([]string, 0, count)
+  hashes := make([]string, 0, count)
+  buf := make([]byte, 12)
+  for i := 0; i < count; i++ {
+    if _, err := rand.Read(buf); err != nil {
+      return nil, nil, err
+    }
+    var b strings.Builder
+    for j, c := range buf {
+      if j > 0 && j%4 == 0 {
+        b.WriteByte('-')
+      }
+      b.WriteByte(alphabet[int(c)%len(alphabet)])
+    }
+    code := b.String()
+    codes = append(codes, code)
+    hashes = append(hashes, HashRecoveryCode(code))
+  }
+  return codes, hashes, nil
+}
+
+// HashRecoveryCode normalises a recovery code as typed by the user and
+// hashes it for lookup.
+func HashRecoveryCode(code string) string {
+  code = strings.ToLower(strings.TrimSpace(code))
+  code = strings.ReplaceAll(code, " ", "")
+  if !strings.Contains(code, "-") && len(code) == 12 {
+    code = code[0:4] + "-" + code[4:8] + "-" + code[8:12]
+  }
+  return HashToken(code)
+}
@@ -0,0 +1,29 @@
+package cursor
+
+import (
+  "encoding/base64"
+  "encoding/json"
+  "errors"
+)
+
+var ErrInvalid = errors.New("invalid cursor")
+
+// Encode turns a keyset position into an opaque token for clients.
+func Encode(position any) (string, error) {
+  data, err := json.Marshal(position)
+  if err != nil {
+    return "", err
+  }
+  return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func Decode(token string, position any) error {
+  data, err := base64.RawURLEncoding.DecodeString(token)
+  if err != nil {
+    return ErrInvalid
+  }
+  if err := json.Unmarshal(data, position); err != nil {
+    return ErrInvalid
+  }
+  return nil
+}
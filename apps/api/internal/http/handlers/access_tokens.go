@@ -0,0 +1,141 @@
+package handlers
+
+import (
+  "encoding/json"
+  "errors"
+  "net/http"
+  "slices"
+  "strings"
+  "time"
+
+  "github.com/go-chi/chi/v5"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+const (
+  maxAccessTokenNameLen = 100
+  // accessTokenPrefixLen covers auth.AccessTokenPrefix plus a few random
+  // characters, enough to recognise a token without weakening it.
+  accessTokenPrefixLen = 12
+)
+
+func (h *Handler) HandleCreateAccessToken(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  var req types.CreateAccessTokenRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  name := strings.TrimSpace(req.Name)
+  if name == "" || len(name) > maxAccessTokenNameLen {
+    response.WriteError(w, http.StatusBadRequest, "invalid_name")
+    return
+  }
+
+  scopes := make([]string, 0, len(req.Scopes))
+  for _, scope := range req.Scopes {
+    scope = strings.TrimSpace(scope)
+    if !auth.ValidScope(scope) {
+      response.WriteError(w, http.StatusBadRequest, "invalid_scope")
+      return
+    }
+    if !slices.Contains(scopes, scope) {
+      scopes = append(scopes, scope)
+    }
+  }
+  if len(scopes) == 0 {
+    response.WriteError(w, http.StatusBadRequest, "invalid_scope")
+    return
+  }
+  if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_expiry")
+    return
+  }
+
+  token, hash, err := auth.NewAccessToken()
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "token_failed")
+    return
+  }
+
+  created, err := h.store.AccessTokens.CreateToken(r.Context(), user.ID, name, hash, token[:accessTokenPrefixLen], scopes, req.ExpiresAt)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "create_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusCreated, types.CreatedAccessTokenResponse{
+    AccessTokenView: accessTokenView(created),
+    Token:           token,
+  })
+}
+
+func (h *Handler) HandleListAccessTokens(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  tokens, err := h.store.AccessTokens.ListTokens(r.Context(), user.ID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  views := make([]types.AccessTokenView, 0, len(tokens))
+  for _, token := range tokens {
+    views = append(views, accessTokenView(token))
+  }
+
+  response.WriteJSON(w, http.StatusOK, views)
+}
+
+func (h *Handler) HandleRevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  tokenID := strings.TrimSpace(chi.URLParam(r, "tokenID"))
+  if !isUUID(tokenID) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_token")
+    return
+  }
+
+  if err := h.store.AccessTokens.RevokeToken(r.Context(), user.ID, tokenID); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "token_not_found")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "revoke_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func accessTokenView(token models.PersonalAccessToken) types.AccessTokenView {
+  return types.AccessTokenView{
+    ID:         token.ID,
+    Name:       token.Name,
+    Prefix:     token.Prefix,
+    Scopes:     token.Scopes,
+    CreatedAt:  token.CreatedAt,
+    LastUsedAt: token.LastUsedAt,
+    ExpiresAt:  token.ExpiresAt,
+  }
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "log"
+  "net/http"
+  "net/url"
+  "strings"
+  "time"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/mail"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+const (
+  passwordResetTTL     = time.Hour
+  emailVerificationTTL = 48 * time.Hour
+  mailSendTimeout      = 30 * time.Second
+)
+
+// HandleForgotPassword mails a reset link. It answers the same way whether
+// or not the address belongs to an account.
+func (h *Handler) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+  var req types.ForgotPasswordRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  email := normalizeEmail(req.Email)
+  if email == "" {
+    response.WriteError(w, http.StatusBadRequest, "invalid_email")
+    return
+  }
+
+  user, err := h.store.Users.GetUserByEmail(r.Context(), email)
+  if err != nil && !errors.Is(err, store.ErrNotFound) {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  if err == nil {
+    token, err := h.createAccountToken(r.Context(), user.ID, store.TokenPasswordReset, passwordResetTTL)
+    if err != nil {
+      response.WriteError(w, http.StatusInternalServerError, "token_failed")
+      return
+    }
+    h.sendMail(mail.Message{
+      To:      user.Email,
+      Subject: "Reset your password",
+      Body: fmt.Sprintf(
+        "Someone asked to reset the password for %s.\n\nOpen this link within an hour to choose a new one:\n%s\n\nIf it wasn't you, ignore this email.",
+        user.Username,
+        h.appLink("/reset-password", token),
+      ),
+    })
+  }
+
+  response.WriteJSON(w, http.StatusAccepted, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+  var req types.ResetPasswordRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  token := strings.TrimSpace(req.Token)
+  if token == "" {
+    response.WriteError(w, http.StatusBadRequest, "invalid_token")
+    return
+  }
+
+  // The token is looked up first so the password can be checked against
+  // the account it belongs to; it is only redeemed by ResetPassword.
+  userID, err := h.store.AccountTokens.GetTokenUserID(r.Context(), store.TokenPasswordReset, auth.HashToken(token))
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusBadRequest, "invalid_token")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "reset_failed")
+    return
+  }
+  user, err := h.store.Users.GetUserByID(r.Context(), userID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "reset_failed")
+    return
+  }
+  if problems := h.checkPasswordPolicy(req.Password, user.Username, user.Email); len(problems) > 0 {
+    response.WriteFieldErrors(w, map[string][]string{"password": problems})
+    return
+  }
+
+  hash, err := h.cfg.Passwords.Hash(req.Password)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "hash_failed")
+    return
+  }
+
+  if err := h.store.AccountTokens.ResetPassword(r.Context(), auth.HashToken(token), hash); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusBadRequest, "invalid_token")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "reset_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+  var req types.VerifyEmailRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  token := strings.TrimSpace(req.Token)
+  if token == "" {
+    response.WriteError(w, http.StatusBadRequest, "invalid_token")
+    return
+  }
+
+  if err := h.store.AccountTokens.VerifyEmail(r.Context(), auth.HashToken(token)); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusBadRequest, "invalid_token")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "verify_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) HandleResendVerification(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+  if user.EmailVerified {
+    response.WriteError(w, http.StatusConflict, "already_verified")
+    return
+  }
+
+  record, err := h.store.Users.GetUserByID(r.Context(), user.ID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  h.sendVerificationEmail(record)
+  response.WriteJSON(w, http.StatusAccepted, map[string]string{"status": "ok"})
+}
+
+// sendVerificationEmail mails a confirmation link. Failures are logged
+// rather than surfaced; the user can ask for another link.
+func (h *Handler) sendVerificationEmail(user models.User) {
+  ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+  defer cancel()
+
+  token, err := h.createAccountToken(ctx, user.ID, store.TokenEmailVerification, emailVerificationTTL)
+  if err != nil {
+    log.Printf("verification token failed for %s: %v", user.ID, err)
+    return
+  }
+  h.sendMail(mail.Message{
+    To:      user.Email,
+    Subject: "Confirm your email address",
+    Body: fmt.Sprintf(
+      "Welcome, %s!\n\nConfirm your email address by opening this link:\n%s\n",
+      user.Username,
+      h.appLink("/verify-email", token),
+    ),
+  })
+}
+
+func (h *Handler) createAccountToken(ctx context.Context, userID string, purpose string, ttl time.Duration) (string, error) {
+  token, hash, err := auth.NewToken()
+  if err != nil {
+    return "", err
+  }
+  if err := h.store.AccountTokens.CreateToken(ctx, userID, purpose, hash, time.Now().Add(ttl)); err != nil {
+    return "", err
+  }
+  return token, nil
+}
+
+// sendMail delivers in the background so that response timing does not
+// reveal whether an address is registered.
+func (h *Handler) sendMail(msg mail.Message) {
+  go func() {
+    ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+    defer cancel()
+    if err := h.mailer.Send(ctx, msg); err != nil {
+      log.Printf("mail to %s failed: %v", msg.To, err)
+    }
+  }()
+}
+
+func (h *Handler) appLink(path string, token string) string {
+  return strings.TrimRight(h.cfg.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+  "encoding/json"
+  "errors"
+  "net/http"
+  "strings"
+
+  "github.com/go-chi/chi/v5"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/store"
+)
+
+func (h *Handler) HandleSetUserRole(w http.ResponseWriter, r *http.Request) {
+  var req types.SetRoleRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  role := strings.ToLower(strings.TrimSpace(req.Role))
+  if !auth.ValidRole(role) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_role")
+    return
+  }
+
+  target, err := h.store.Users.GetUserByUsername(r.Context(), normalizeUsername(chi.URLParam(r, "username")))
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "user_not_found")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  if err := h.store.Users.SetRole(r.Context(), target.ID, role); err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "update_failed")
+    return
+  }
+
+  target.Role = role
+  response.WriteJSON(w, http.StatusOK, userView(target, accountAudience(r, target.ID)))
+}
@@ -4,25 +4,63 @@ import (
   "context"
   "encoding/json"
   "errors"
+  "log"
   "net/http"
   "strings"
 
   "github.com/jackc/pgx/v5/pgconn"
 
   "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/auth/oidc"
+  "jabber_v3/apps/api/internal/auth/throttle"
   "jabber_v3/apps/api/internal/http/response"
   "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/mail"
   "jabber_v3/apps/api/internal/models"
   "jabber_v3/apps/api/internal/store"
 )
 
 type Handler struct {
-  store *store.Store
-  jwt   auth.JWTManager
+  store  *store.Store
+  jwt    auth.JWTManager
+  mailer mail.Mailer
+  cfg    Config
 }
 
-func New(store *store.Store, jwt auth.JWTManager) *Handler {
-  return &Handler{store: store, jwt: jwt}
+// Config holds the deployment settings handlers depend on.
+type Config struct {
+  // AppURL is the web client's base URL, used for links in emails.
+  AppURL string
+  // RequireVerifiedEmail blocks posting and commenting until the user has
+  // confirmed their address.
+  RequireVerifiedEmail bool
+  // OIDC holds the configured identity providers by name.
+  OIDC map[string]*oidc.Client
+  // Passwords hashes new passwords. Its zero value uses
+  // auth.DefaultArgon2Params.
+  Passwords auth.PasswordHasher
+  // PasswordPolicy decides which new passwords are accepted. Its zero value
+  // uses auth.DefaultPasswordPolicy.
+  PasswordPolicy auth.PasswordPolicy
+  // LoginGuard throttles password and two-factor guesses. It defaults to an
+  // in-memory guard with throttle.DefaultPolicy.
+  LoginGuard *throttle.Guard
+  // TrustedProxyHops is how many reverse proxies in front of the API add
+  // to X-Forwarded-For. Zero trusts no forwarding headers.
+  TrustedProxyHops int
+}
+
+func New(store *store.Store, jwt auth.JWTManager, mailer mail.Mailer, cfg Config) *Handler {
+  if cfg.Passwords.Params == (auth.Argon2Params{}) {
+    cfg.Passwords.Params = auth.DefaultArgon2Params
+  }
+  if cfg.PasswordPolicy.Blocklist == nil {
+    cfg.PasswordPolicy = auth.DefaultPasswordPolicy()
+  }
+  if cfg.LoginGuard == nil {
+    cfg.LoginGuard = throttle.NewGuard(throttle.NewMemoryBackend(), throttle.DefaultPolicy)
+  }
+  return &Handler{store: store, jwt: jwt, mailer: mailer, cfg: cfg}
 }
 
 func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
@@ -34,12 +72,24 @@ func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 
   email := normalizeEmail(req.Email)
   username := normalizeUsername(req.Username)
-  if email == "" || username == "" || len(req.Password) < 8 {
-    response.WriteError(w, http.StatusBadRequest, "invalid_credentials")
+  fields := make(map[string][]string)
+  if email == "" {
+    fields["email"] = []string{"required"}
+  } else if !strings.Contains(email, "@") {
+    fields["email"] = []string{"invalid"}
+  }
+  if problems := validateUsername(username); len(problems) > 0 {
+    fields["username"] = problems
+  }
+  if problems := h.checkPasswordPolicy(req.Password, username, email); len(problems) > 0 {
+    fields["password"] = problems
+  }
+  if len(fields) > 0 {
+    response.WriteFieldErrors(w, fields)
     return
   }
 
-  hash, err := auth.HashPassword(req.Password)
+  hash, err := h.cfg.Passwords.Hash(req.Password)
   if err != nil {
     response.WriteError(w, http.StatusInternalServerError, "hash_failed")
     return
@@ -60,16 +110,8 @@ func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
     return
   }
 
-  token, err := h.jwt.Generate(user.ID)
-  if err != nil {
-    response.WriteError(w, http.StatusInternalServerError, "token_failed")
-    return
-  }
-
-  response.WriteJSON(w, http.StatusCreated, types.AuthResponse{
-    Token: token,
-    User: types.UserView{ID: user.ID, Email: user.Email, Username: user.Username, CreatedAt: user.CreatedAt},
-  })
+  h.sendVerificationEmail(user)
+  h.startSession(w, r, user, http.StatusCreated)
 }
 
 func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
@@ -88,31 +130,71 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
     return
   }
 
+  var found *models.User
   user, err := h.lookupUser(r.Context(), identifier)
-  if err != nil {
-    if errors.Is(err, store.ErrNotFound) {
-      response.WriteError(w, http.StatusUnauthorized, "invalid_login")
-      return
-    }
+  switch {
+  case err == nil:
+    found = &user
+  case !errors.Is(err, store.ErrNotFound):
     response.WriteError(w, http.StatusInternalServerError, "login_failed")
     return
   }
 
-  if err := auth.CheckPassword(user.PasswordHash, req.Password); err != nil {
+  account := loginAccount(found, identifier)
+  if !h.checkLoginThrottle(w, r, account) {
+    return
+  }
+  if found == nil {
+    h.recordLoginFailure(r, account, nil)
     response.WriteError(w, http.StatusUnauthorized, "invalid_login")
     return
   }
-
-  token, err := h.jwt.Generate(user.ID)
+  needsRehash, err := h.cfg.Passwords.Verify(user.PasswordHash, req.Password)
   if err != nil {
-    response.WriteError(w, http.StatusInternalServerError, "token_failed")
+    if !errors.Is(err, auth.ErrPasswordMismatch) {
+      log.Printf("password check failed for %s: %v", user.ID, err)
+    }
+    h.recordLoginFailure(r, account, found)
+    response.WriteError(w, http.StatusUnauthorized, "invalid_login")
     return
   }
+  if needsRehash {
+    h.rehashPassword(r.Context(), user, req.Password)
+  }
+
+  // With two factors the counter is only reset once the second one is
+  // right too; the account key is shared with HandleVerifyMFA, so clearing
+  // it here would let anyone who knows the password guess codes forever.
+  if user.TOTPEnabledAt != nil {
+    h.writeMFAChallenge(w, user)
+    return
+  }
+
+  h.recordLoginSuccess(r, account)
+  h.startSession(w, r, user, http.StatusOK)
+}
+
+// checkPasswordPolicy returns the policy violations of a new password. A
+// broken breach corpus is logged and skipped rather than blocking sign-ups.
+func (h *Handler) checkPasswordPolicy(password string, related ...string) []string {
+  problems, err := h.cfg.PasswordPolicy.Check(password, related...)
+  if err != nil {
+    log.Printf("breached password check failed: %v", err)
+  }
+  return problems
+}
 
-  response.WriteJSON(w, http.StatusOK, types.AuthResponse{
-    Token: token,
-    User: types.UserView{ID: user.ID, Email: user.Email, Username: user.Username, CreatedAt: user.CreatedAt},
-  })
+// rehashPassword upgrades a bcrypt or outdated argon2id hash while the
+// plaintext is at hand. Failures only mean the upgrade waits for the next
+// login.
+func (h *Handler) rehashPassword(ctx context.Context, user models.User, password string) {
+  hash, err := h.cfg.Passwords.Hash(password)
+  if err == nil {
+    err = h.store.Users.ReplacePasswordHash(ctx, user.ID, user.PasswordHash, hash)
+  }
+  if err != nil {
+    log.Printf("password rehash failed for %s: %v", user.ID, err)
+  }
 }
 
 func normalizeEmail(email string) string {
@@ -131,3 +213,10 @@ func (h *Handler) lookupUser(ctx context.Context, identifier string) (models.Use
   }
   return h.store.Users.GetUserByUsername(ctx, normalizeUsername(identifier))
 }
+
+// HandleJWKS publishes the public keys access tokens are signed with so
+// other services can verify them. It is empty while signing with HS256.
+func (h *Handler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+  w.Header().Set("Cache-Control", "public, max-age=300")
+  response.WriteJSON(w, http.StatusOK, h.jwt.JWKS())
+}
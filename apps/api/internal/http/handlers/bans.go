@@ -0,0 +1,160 @@
+package handlers
+
+import (
+  "encoding/json"
+  "errors"
+  "net/http"
+  "strings"
+  "time"
+
+  "github.com/go-chi/chi/v5"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+const maxBanReasonLen = 500
+
+func (h *Handler) HandleCreateSiteBan(w http.ResponseWriter, r *http.Request) {
+  h.createBan(w, r, nil)
+}
+
+func (h *Handler) HandleListSiteBans(w http.ResponseWriter, r *http.Request) {
+  h.writeBans(w, r, nil)
+}
+
+func (h *Handler) HandleRevokeSiteBan(w http.ResponseWriter, r *http.Request) {
+  h.revokeBan(w, r, nil)
+}
+
+func (h *Handler) HandleCreateCommunityBan(w http.ResponseWriter, r *http.Request) {
+  community, ok := h.loadVisibleCommunity(w, r)
+  if !ok {
+    return
+  }
+  h.createBan(w, r, &community.Community)
+}
+
+func (h *Handler) HandleListCommunityBans(w http.ResponseWriter, r *http.Request) {
+  community, ok := h.loadVisibleCommunity(w, r)
+  if !ok {
+    return
+  }
+  h.writeBans(w, r, &community.ID)
+}
+
+func (h *Handler) HandleRevokeCommunityBan(w http.ResponseWriter, r *http.Request) {
+  community, ok := h.loadVisibleCommunity(w, r)
+  if !ok {
+    return
+  }
+  h.revokeBan(w, r, &community.ID)
+}
+
+// createBan bans a user site-wide, or from community when it is set.
+func (h *Handler) createBan(w http.ResponseWriter, r *http.Request, community *models.Community) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  var req types.CreateBanRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  reason := strings.TrimSpace(req.Reason)
+  if len(reason) > maxBanReasonLen {
+    response.WriteError(w, http.StatusBadRequest, "invalid_reason")
+    return
+  }
+  if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_expiry")
+    return
+  }
+
+  target, err := h.store.Users.GetUserByUsername(r.Context(), normalizeUsername(req.Username))
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "user_not_found")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  if target.ID == user.ID || target.Role == auth.RoleAdmin || (community != nil && target.ID == community.OwnerID) {
+    response.WriteError(w, http.StatusForbidden, "cannot_ban_user")
+    return
+  }
+
+  var communityID *string
+  if community != nil {
+    communityID = &community.ID
+  }
+
+  ban, err := h.store.Bans.CreateBan(r.Context(), target.ID, communityID, reason, user.ID, req.ExpiresAt)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "ban_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusCreated, banView(ban))
+}
+
+func (h *Handler) writeBans(w http.ResponseWriter, r *http.Request, communityID *string) {
+  bans, err := h.store.Bans.ListActiveBans(r.Context(), communityID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  views := make([]types.BanView, 0, len(bans))
+  for _, ban := range bans {
+    views = append(views, banView(ban))
+  }
+
+  response.WriteJSON(w, http.StatusOK, views)
+}
+
+func (h *Handler) revokeBan(w http.ResponseWriter, r *http.Request, communityID *string) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  banID := strings.TrimSpace(chi.URLParam(r, "banID"))
+  if !isUUID(banID) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_ban")
+    return
+  }
+
+  if err := h.store.Bans.RevokeBan(r.Context(), banID, communityID, user.ID); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "ban_not_found")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "revoke_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func banView(ban models.Ban) types.BanView {
+  return types.BanView{
+    ID:          ban.ID,
+    UserID:      ban.UserID,
+    CommunityID: ban.CommunityID,
+    Reason:      ban.Reason,
+    BannedBy:    ban.BannedBy,
+    CreatedAt:   ban.CreatedAt,
+    ExpiresAt:   ban.ExpiresAt,
+  }
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+  "encoding/json"
+  "errors"
+  "net/http"
+  "strconv"
+  "strings"
+
+  "github.com/go-chi/chi/v5"
+
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+const (
+  defaultCommentDepth = 5
+  maxCommentDepth     = 10
+  defaultCommentLimit = 50
+  maxCommentLimit     = 200
+)
+
+func (h *Handler) HandleCreateComment(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+  if !h.checkVerifiedEmail(w, user) {
+    return
+  }
+
+  record, err := h.store.Users.GetUserByID(r.Context(), user.ID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  post, ok := h.loadVisiblePost(w, r)
+  if !ok {
+    return
+  }
+  if post.DeletedAt != nil || post.RemovedAt != nil {
+    response.WriteError(w, http.StatusNotFound, "post_not_found")
+    return
+  }
+  if post.LockedAt != nil {
+    response.WriteError(w, http.StatusForbidden, "post_locked")
+    return
+  }
+  if !h.checkCommunityBan(w, r, record.ID, post.CommunityID) {
+    return
+  }
+
+  var req types.CreateCommentRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  body := strings.TrimSpace(req.Body)
+  if body == "" {
+    response.WriteError(w, http.StatusBadRequest, "invalid_comment")
+    return
+  }
+
+  var parentID *string
+  if req.ParentID != nil && strings.TrimSpace(*req.ParentID) != "" {
+    if !isUUID(strings.TrimSpace(*req.ParentID)) {
+      response.WriteError(w, http.StatusBadRequest, "invalid_parent")
+      return
+    }
+    parent, err := h.store.Comments.GetCommentByID(r.Context(), strings.TrimSpace(*req.ParentID))
+    if err != nil {
+      if errors.Is(err, store.ErrNotFound) {
+        response.WriteError(w, http.StatusBadRequest, "invalid_parent")
+        return
+      }
+      response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+      return
+    }
+    if parent.PostID != post.ID {
+      response.WriteError(w, http.StatusBadRequest, "invalid_parent")
+      return
+    }
+    parentID = &parent.ID
+  }
+
+  comment, err := h.store.Comments.CreateComment(r.Context(), post.ID, parentID, record.ID, body)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "create_failed")
+    return
+  }
+
+  viewer, err := h.loadViewerAudience(r)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  response.WriteJSON(w, http.StatusCreated, types.Redact(types.CommentView{
+    ID:        comment.ID,
+    PostID:    comment.PostID,
+    ParentID:  comment.ParentID,
+    Body:      comment.Body,
+    CreatedAt: comment.CreatedAt,
+    Author:    types.AuthorView{ID: record.ID, Username: record.Username},
+    Replies:   []*types.CommentView{},
+  }, viewer.of(record.ID, post.CommunityID)))
+}
+
+func (h *Handler) HandleListComments(w http.ResponseWriter, r *http.Request) {
+  query := r.URL.Query()
+  depth, ok := intQueryParam(query.Get("depth"), defaultCommentDepth, maxCommentDepth)
+  if !ok {
+    response.WriteError(w, http.StatusBadRequest, "invalid_depth")
+    return
+  }
+  limit, ok := intQueryParam(query.Get("limit"), defaultCommentLimit, maxCommentLimit)
+  if !ok || limit == 0 {
+    response.WriteError(w, http.StatusBadRequest, "invalid_limit")
+    return
+  }
+  var after *string
+  if raw := strings.TrimSpace(query.Get("after")); raw != "" {
+    if !isUUID(raw) {
+      response.WriteError(w, http.StatusBadRequest, "invalid_cursor")
+      return
+    }
+    after = &raw
+  }
+
+  post, ok := h.loadVisiblePost(w, r)
+  if !ok {
+    return
+  }
+  // The cursor is the last top-level comment of the previous page; anything
+  // else would page from an arbitrary point or come back empty.
+  if after != nil {
+    cursor, err := h.store.Comments.GetCommentByID(r.Context(), *after)
+    if err != nil && !errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+      return
+    }
+    if err != nil || cursor.PostID != post.ID || cursor.ParentID != nil {
+      response.WriteError(w, http.StatusBadRequest, "invalid_cursor")
+      return
+    }
+  }
+
+  rows, err := h.store.Comments.ListThread(r.Context(), post.ID, nil, depth, limit, after)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  viewer, err := h.loadViewerAudience(r)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  roots := buildCommentTree(rows, viewer, post.CommunityID)
+  var nextCursor *string
+  if len(roots) == limit {
+    nextCursor = &roots[len(roots)-1].ID
+  }
+
+  response.WriteJSON(w, http.StatusOK, types.CommentThreadResponse{Comments: roots, NextCursor: nextCursor})
+}
+
+func (h *Handler) HandleGetCommentThread(w http.ResponseWriter, r *http.Request) {
+  commentID := strings.TrimSpace(chi.URLParam(r, "commentID"))
+  if !isUUID(commentID) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_comment")
+    return
+  }
+
+  depth, ok := intQueryParam(r.URL.Query().Get("depth"), defaultCommentDepth, maxCommentDepth)
+  if !ok {
+    response.WriteError(w, http.StatusBadRequest, "invalid_depth")
+    return
+  }
+
+  post, ok := h.loadVisiblePost(w, r)
+  if !ok {
+    return
+  }
+
+  rows, err := h.store.Comments.ListThread(r.Context(), post.ID, &commentID, depth, 0, nil)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  viewer, err := h.loadViewerAudience(r)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  roots := buildCommentTree(rows, viewer, post.CommunityID)
+  if len(roots) == 0 {
+    response.WriteError(w, http.StatusNotFound, "comment_not_found")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, roots[0])
+}
+
+// buildCommentTree expects rows ordered by depth so that every parent is
+// seen before its replies. Each comment is rendered for the viewer's
+// audience in the post's community.
+func buildCommentTree(rows []models.CommentWithAuthor, viewer viewerAudience, communityID *string) []*types.CommentView {
+  roots := make([]*types.CommentView, 0)
+  byID := make(map[string]*types.CommentView, len(rows))
+  for _, row := range rows {
+    view := types.Redact(&types.CommentView{
+      ID:        row.ID,
+      PostID:    row.PostID,
+      ParentID:  row.ParentID,
+      Body:      row.Body,
+      CreatedAt: row.CreatedAt,
+      Author: types.AuthorView{
+        ID:       row.UserID,
+        Username: row.AuthorUsername,
+      },
+      ReplyCount: row.ReplyCount,
+      Replies:    []*types.CommentView{},
+    }, viewer.of(row.UserID, communityID))
+    byID[row.ID] = view
+
+    if row.Depth == 0 || row.ParentID == nil {
+      roots = append(roots, view)
+      continue
+    }
+    if parent, ok := byID[*row.ParentID]; ok {
+      parent.Replies = append(parent.Replies, view)
+    }
+  }
+
+  for _, view := range byID {
+    view.HasMore = view.ReplyCount > len(view.Replies)
+  }
+  return roots
+}
+
+func intQueryParam(raw string, fallback int, max int) (int, bool) {
+  raw = strings.TrimSpace(raw)
+  if raw == "" {
+    return fallback, true
+  }
+  value, err := strconv.Atoi(raw)
+  if err != nil || value < 0 {
+    return 0, false
+  }
+  if value > max {
+    value = max
+  }
+  return value, true
+}
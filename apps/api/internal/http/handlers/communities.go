@@ -0,0 +1,347 @@
+package handlers
+
+import (
+  "encoding/json"
+  "errors"
+  "net/http"
+  "regexp"
+  "strings"
+
+  "github.com/go-chi/chi/v5"
+  "github.com/jackc/pgx/v5/pgconn"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+const (
+  defaultCommunityLimit = 50
+  maxCommunityLimit     = 100
+  maxCommunityNameLen   = 100
+  maxCommunityDescLen   = 1000
+)
+
+var communitySlugPattern = regexp.MustCompile(`^[a-z0-9_]{3,32}$`)
+
+func (h *Handler) HandleCreateCommunity(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  var req types.CreateCommunityRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  slug := strings.ToLower(strings.TrimSpace(req.Slug))
+  name := strings.TrimSpace(req.Name)
+  description := strings.TrimSpace(req.Description)
+  visibility := strings.ToLower(strings.TrimSpace(req.Visibility))
+  if visibility == "" {
+    visibility = models.CommunityPublic
+  }
+  if !communitySlugPattern.MatchString(slug) || name == "" || len(name) > maxCommunityNameLen || len(description) > maxCommunityDescLen {
+    response.WriteError(w, http.StatusBadRequest, "invalid_community")
+    return
+  }
+  switch visibility {
+  case models.CommunityPublic, models.CommunityRestricted, models.CommunityPrivate:
+  default:
+    response.WriteError(w, http.StatusBadRequest, "invalid_visibility")
+    return
+  }
+
+  community, err := h.store.Communities.CreateCommunity(r.Context(), slug, name, description, visibility, user.ID)
+  if err != nil {
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+      response.WriteError(w, http.StatusConflict, "slug_taken")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "create_failed")
+    return
+  }
+
+  owner := models.CommunityRoleOwner
+  response.WriteJSON(w, http.StatusCreated, communityView(models.CommunityWithStats{
+    Community:    community,
+    MemberCount:  1,
+    ViewerRole:   &owner,
+    IsSubscribed: true,
+  }))
+}
+
+func (h *Handler) HandleListCommunities(w http.ResponseWriter, r *http.Request) {
+  query := r.URL.Query()
+  limit, ok := intQueryParam(query.Get("limit"), defaultCommunityLimit, maxCommunityLimit)
+  if !ok || limit == 0 {
+    response.WriteError(w, http.StatusBadRequest, "invalid_limit")
+    return
+  }
+  var after *string
+  if raw := strings.TrimSpace(query.Get("after")); raw != "" {
+    after = &raw
+  }
+
+  communities, err := h.store.Communities.ListCommunities(r.Context(), viewerIDFromContext(r), limit+1, after)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  var nextCursor *string
+  if len(communities) > limit {
+    communities = communities[:limit]
+    nextCursor = &communities[len(communities)-1].Slug
+  }
+
+  views := make([]types.CommunityView, 0, len(communities))
+  for _, community := range communities {
+    views = append(views, communityView(community))
+  }
+
+  response.WriteJSON(w, http.StatusOK, types.CommunityListResponse{Communities: views, NextCursor: nextCursor})
+}
+
+func (h *Handler) HandleGetCommunity(w http.ResponseWriter, r *http.Request) {
+  community, ok := h.loadVisibleCommunity(w, r)
+  if !ok {
+    return
+  }
+  response.WriteJSON(w, http.StatusOK, communityView(community))
+}
+
+func (h *Handler) HandleJoinCommunity(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  community, ok := h.loadVisibleCommunity(w, r)
+  if !ok {
+    return
+  }
+  if !h.checkCommunityBan(w, r, user.ID, &community.ID) {
+    return
+  }
+
+  // Public communities admit anyone. Restricted ones can be followed by
+  // anyone, but posting needs a membership granted by the owner.
+  if community.Visibility == models.CommunityPublic && community.ViewerRole == nil {
+    if err := h.store.Communities.AddMember(r.Context(), community.ID, user.ID); err != nil {
+      response.WriteError(w, http.StatusInternalServerError, "join_failed")
+      return
+    }
+  }
+  if err := h.store.Communities.Subscribe(r.Context(), community.ID, user.ID); err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "join_failed")
+    return
+  }
+
+  updated, err := h.store.Communities.GetCommunityWithStats(r.Context(), community.Slug, &user.ID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  response.WriteJSON(w, http.StatusOK, communityView(updated))
+}
+
+func (h *Handler) HandleLeaveCommunity(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  community, ok := h.loadVisibleCommunity(w, r)
+  if !ok {
+    return
+  }
+  if community.OwnerID == user.ID {
+    response.WriteError(w, http.StatusBadRequest, "owner_cannot_leave")
+    return
+  }
+
+  if err := h.store.Communities.Leave(r.Context(), community.ID, user.ID); err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "leave_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) HandleAddCommunityMember(w http.ResponseWriter, r *http.Request) {
+  community, ok := h.loadVisibleCommunity(w, r)
+  if !ok {
+    return
+  }
+
+  var req types.AddCommunityMemberRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  member, err := h.store.Users.GetUserByUsername(r.Context(), normalizeUsername(req.Username))
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "user_not_found")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  if err := h.store.Communities.AddMember(r.Context(), community.ID, member.ID); err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "add_member_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) HandleListModerators(w http.ResponseWriter, r *http.Request) {
+  community, ok := h.loadVisibleCommunity(w, r)
+  if !ok {
+    return
+  }
+
+  members, err := h.store.Communities.ListModerators(r.Context(), community.ID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  views := make([]types.CommunityMemberView, 0, len(members))
+  for _, member := range members {
+    views = append(views, types.CommunityMemberView{
+      UserID:   member.UserID,
+      Username: member.Username,
+      Role:     member.Role,
+      Since:    member.CreatedAt,
+    })
+  }
+
+  response.WriteJSON(w, http.StatusOK, views)
+}
+
+func (h *Handler) HandleAddModerator(w http.ResponseWriter, r *http.Request) {
+  community, target, ok := h.loadModeratorTarget(w, r)
+  if !ok {
+    return
+  }
+
+  if err := h.store.Communities.SetMemberRole(r.Context(), community.ID, target.ID, models.CommunityRoleModerator); err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "update_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleRemoveModerator demotes a moderator to a plain member. It never
+// adds anyone to the community.
+func (h *Handler) HandleRemoveModerator(w http.ResponseWriter, r *http.Request) {
+  community, target, ok := h.loadModeratorTarget(w, r)
+  if !ok {
+    return
+  }
+
+  if err := h.store.Communities.DemoteModerator(r.Context(), community.ID, target.ID); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "moderator_not_found")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "update_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// loadModeratorTarget resolves the {slug} and {username} route params of
+// the moderator routes, writing the error response itself when that fails.
+func (h *Handler) loadModeratorTarget(w http.ResponseWriter, r *http.Request) (models.CommunityWithStats, models.User, bool) {
+  community, ok := h.loadVisibleCommunity(w, r)
+  if !ok {
+    return models.CommunityWithStats{}, models.User{}, false
+  }
+
+  target, err := h.store.Users.GetUserByUsername(r.Context(), normalizeUsername(chi.URLParam(r, "username")))
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "user_not_found")
+      return models.CommunityWithStats{}, models.User{}, false
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return models.CommunityWithStats{}, models.User{}, false
+  }
+  if target.ID == community.OwnerID {
+    response.WriteError(w, http.StatusBadRequest, "owner_role_fixed")
+    return models.CommunityWithStats{}, models.User{}, false
+  }
+  return community, target, true
+}
+
+// loadVisibleCommunity resolves the {slug} route param for the current
+// viewer. Private communities look nonexistent to non-members.
+func (h *Handler) loadVisibleCommunity(w http.ResponseWriter, r *http.Request) (models.CommunityWithStats, bool) {
+  slug := strings.ToLower(strings.TrimSpace(chi.URLParam(r, "slug")))
+  if slug == "" {
+    response.WriteError(w, http.StatusBadRequest, "invalid_community")
+    return models.CommunityWithStats{}, false
+  }
+
+  community, err := h.store.Communities.GetCommunityWithStats(r.Context(), slug, viewerIDFromContext(r))
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "community_not_found")
+      return models.CommunityWithStats{}, false
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return models.CommunityWithStats{}, false
+  }
+  if community.Visibility == models.CommunityPrivate && community.ViewerRole == nil && !isSiteAdmin(r) {
+    response.WriteError(w, http.StatusNotFound, "community_not_found")
+    return models.CommunityWithStats{}, false
+  }
+  return community, true
+}
+
+func communityView(community models.CommunityWithStats) types.CommunityView {
+  return types.CommunityView{
+    ID:           community.ID,
+    Slug:         community.Slug,
+    Name:         community.Name,
+    Description:  community.Description,
+    Visibility:   community.Visibility,
+    OwnerID:      community.OwnerID,
+    CreatedAt:    community.CreatedAt,
+    MemberCount:  community.MemberCount,
+    ViewerRole:   community.ViewerRole,
+    IsMember:     community.ViewerRole != nil,
+    IsSubscribed: community.IsSubscribed,
+  }
+}
+
+// isSiteAdmin only sees the role once RequireRole or RequirePermission has
+// resolved it for the request.
+func isSiteAdmin(r *http.Request) bool {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  return ok && user.Role == auth.RoleAdmin
+}
+
+func viewerIDFromContext(r *http.Request) *string {
+  if user, ok := requestctx.AuthUserFromContext(r.Context()); ok {
+    return &user.ID
+  }
+  return nil
+}
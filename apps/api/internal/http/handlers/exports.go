@@ -0,0 +1,238 @@
+package handlers
+
+import (
+  "archive/zip"
+  "bytes"
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "log"
+  "net/http"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/go-chi/chi/v5"
+
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/mail"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+const (
+  exportBuildTimeout = 5 * time.Minute
+  exportRetention    = 7 * 24 * time.Hour
+  // A new export request returns the previous export while it is still
+  // building or was finished recently, so the endpoint can't be used to
+  // keep the server busy.
+  exportPendingReuse = time.Hour
+  exportReadyReuse   = 24 * time.Hour
+)
+
+// HandleCreateExport starts building an archive of everything the user has
+// written. The build runs in the background; clients poll the returned
+// export and download it once it is ready.
+func (h *Handler) HandleCreateExport(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  latest, err := h.store.Exports.GetLatestExport(r.Context(), user.ID)
+  if err != nil && !errors.Is(err, store.ErrNotFound) {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  if err == nil {
+    age := time.Since(latest.CreatedAt)
+    if (latest.Status == models.ExportPending && age < exportPendingReuse) ||
+      (latest.Status == models.ExportReady && age < exportReadyReuse) {
+      response.WriteJSON(w, http.StatusAccepted, exportView(latest))
+      return
+    }
+  }
+
+  export, err := h.store.Exports.CreateExport(r.Context(), user.ID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "create_failed")
+    return
+  }
+
+  go h.buildExport(export)
+  response.WriteJSON(w, http.StatusAccepted, exportView(export))
+}
+
+func (h *Handler) HandleGetExport(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  exportID := strings.TrimSpace(chi.URLParam(r, "exportID"))
+  if !isUUID(exportID) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_export")
+    return
+  }
+
+  export, err := h.store.Exports.GetExport(r.Context(), user.ID, exportID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "export_not_found")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, exportView(export))
+}
+
+func (h *Handler) HandleDownloadExport(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  exportID := strings.TrimSpace(chi.URLParam(r, "exportID"))
+  if !isUUID(exportID) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_export")
+    return
+  }
+
+  archive, err := h.store.Exports.GetArchive(r.Context(), user.ID, exportID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "export_not_found")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  w.Header().Set("Content-Type", "application/zip")
+  w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "export-"+exportID+".zip"))
+  w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+  w.Header().Set("Cache-Control", "no-store")
+  w.WriteHeader(http.StatusOK)
+  _, _ = w.Write(archive)
+}
+
+// buildExport writes the archive for a pending export and mails the user
+// when it is ready. It runs detached from the request that started it.
+func (h *Handler) buildExport(export models.DataExport) {
+  ctx, cancel := context.WithTimeout(context.Background(), exportBuildTimeout)
+  defer cancel()
+
+  user, archive, err := h.writeExportArchive(ctx, export.UserID)
+  if err == nil {
+    err = h.store.Exports.CompleteExport(ctx, export.ID, archive, time.Now().Add(exportRetention))
+  }
+  if err != nil {
+    log.Printf("export %s failed: %v", export.ID, err)
+    if err := h.store.Exports.FailExport(ctx, export.ID); err != nil {
+      log.Printf("marking export %s failed: %v", export.ID, err)
+    }
+    return
+  }
+
+  h.sendMail(mail.Message{
+    To:      user.Email,
+    Subject: "Your data export is ready",
+    Body: fmt.Sprintf(
+      "Hi %s,\n\nThe copy of your data you asked for is ready. Download it from your account settings within %d days.\n",
+      user.Username,
+      int(exportRetention.Hours()/24),
+    ),
+  })
+}
+
+func (h *Handler) writeExportArchive(ctx context.Context, userID string) (models.User, []byte, error) {
+  user, err := h.store.Users.GetUserByID(ctx, userID)
+  if err != nil {
+    return models.User{}, nil, err
+  }
+  posts, err := h.store.Exports.ListAuthoredPosts(ctx, userID)
+  if err != nil {
+    return models.User{}, nil, err
+  }
+  comments, err := h.store.Exports.ListAuthoredComments(ctx, userID)
+  if err != nil {
+    return models.User{}, nil, err
+  }
+  votes, err := h.store.Exports.ListVotes(ctx, userID)
+  if err != nil {
+    return models.User{}, nil, err
+  }
+
+  exportedPosts := make([]types.ExportedPost, 0, len(posts))
+  for _, post := range posts {
+    exportedPosts = append(exportedPosts, types.ExportedPost{
+      ID:          post.ID,
+      CommunityID: post.CommunityID,
+      Title:       post.Title,
+      Body:        post.Body,
+      CreatedAt:   post.CreatedAt,
+      EditedAt:    post.EditedAt,
+      DeletedAt:   post.DeletedAt,
+      RemovedAt:   post.RemovedAt,
+    })
+  }
+  exportedComments := make([]types.ExportedComment, 0, len(comments))
+  for _, comment := range comments {
+    exportedComments = append(exportedComments, types.ExportedComment{
+      ID:        comment.ID,
+      PostID:    comment.PostID,
+      ParentID:  comment.ParentID,
+      Body:      comment.Body,
+      CreatedAt: comment.CreatedAt,
+    })
+  }
+  exportedVotes := make([]types.ExportedVote, 0, len(votes))
+  for _, vote := range votes {
+    exportedVotes = append(exportedVotes, types.ExportedVote(vote))
+  }
+
+  var buf bytes.Buffer
+  archive := zip.NewWriter(&buf)
+  files := []struct {
+    name string
+    data any
+  }{
+    {"profile.json", userView(user, types.AudienceSelf)},
+    {"posts.json", exportedPosts},
+    {"comments.json", exportedComments},
+    {"votes.json", exportedVotes},
+  }
+  for _, file := range files {
+    entry, err := archive.Create(file.name)
+    if err != nil {
+      return models.User{}, nil, err
+    }
+    encoder := json.NewEncoder(entry)
+    encoder.SetIndent("", "  ")
+    if err := encoder.Encode(file.data); err != nil {
+      return models.User{}, nil, err
+    }
+  }
+  if err := archive.Close(); err != nil {
+    return models.User{}, nil, err
+  }
+  return user, buf.Bytes(), nil
+}
+
+func exportView(export models.DataExport) types.ExportView {
+  return types.ExportView{
+    ID:          export.ID,
+    Status:      export.Status,
+    CreatedAt:   export.CreatedAt,
+    CompletedAt: export.CompletedAt,
+    ExpiresAt:   export.ExpiresAt,
+  }
+}
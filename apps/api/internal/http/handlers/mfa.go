@@ -0,0 +1,309 @@
+package handlers
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "net/http"
+  "strings"
+  "time"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+const (
+  totpIssuer        = "Foorum"
+  recoveryCodeCount = 10
+)
+
+// writeMFAChallenge answers a successful password check for an account
+// with two-factor authentication enabled.
+func (h *Handler) writeMFAChallenge(w http.ResponseWriter, user models.User) {
+  expiresAt := time.Now().Add(auth.MFAChallengeTTL)
+  challenge, err := h.jwt.GenerateMFAChallenge(user.ID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "token_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, types.MFAChallengeResponse{
+    MFARequired:    true,
+    ChallengeToken: challenge,
+    ExpiresAt:      expiresAt,
+  })
+}
+
+// HandleVerifyMFA completes a two-step login with either an authenticator
+// code or a recovery code.
+func (h *Handler) HandleVerifyMFA(w http.ResponseWriter, r *http.Request) {
+  var req types.MFAVerifyRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  userID, err := h.jwt.ParseMFAChallenge(strings.TrimSpace(req.ChallengeToken))
+  if err != nil {
+    response.WriteError(w, http.StatusUnauthorized, "invalid_challenge")
+    return
+  }
+  // Code guesses count towards the same limits as password guesses.
+  if !h.checkLoginThrottle(w, r, userID) {
+    return
+  }
+
+  var ok bool
+  switch {
+  case strings.TrimSpace(req.Code) != "":
+    ok, err = h.checkTOTPCode(r.Context(), userID, req.Code)
+  case strings.TrimSpace(req.RecoveryCode) != "":
+    err = h.store.MFA.UseRecoveryCode(r.Context(), userID, auth.HashRecoveryCode(req.RecoveryCode))
+    ok = err == nil
+    if errors.Is(err, store.ErrNotFound) {
+      err = nil
+    }
+  default:
+    response.WriteError(w, http.StatusBadRequest, "invalid_code")
+    return
+  }
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "verify_failed")
+    return
+  }
+  if !ok {
+    var owner *models.User
+    if record, err := h.store.Users.GetUserByID(r.Context(), userID); err == nil {
+      owner = &record
+    }
+    h.recordLoginFailure(r, userID, owner)
+    response.WriteError(w, http.StatusUnauthorized, "invalid_code")
+    return
+  }
+  h.recordLoginSuccess(r, userID)
+
+  user, err := h.store.Users.GetUserByID(r.Context(), userID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusUnauthorized, "invalid_challenge")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  h.startSession(w, r, user, http.StatusOK)
+}
+
+// HandleSetupTOTP starts enrollment. The secret has no effect until it is
+// confirmed with a code.
+func (h *Handler) HandleSetupTOTP(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  record, err := h.store.Users.GetUserByID(r.Context(), user.ID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  secret, err := auth.NewTOTPSecret()
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "secret_failed")
+    return
+  }
+
+  if err := h.store.MFA.SetPendingTOTP(r.Context(), record.ID, secret); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusConflict, "two_factor_enabled")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "setup_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, types.TOTPSetupResponse{
+    Secret: secret,
+    URI:    auth.TOTPURI(totpIssuer, record.Username, secret),
+  })
+}
+
+// HandleConfirmTOTP enables two-factor authentication and returns the
+// recovery codes. They are shown once and only stored hashed.
+func (h *Handler) HandleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  var req types.TOTPCodeRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  totp, err := h.store.MFA.GetTOTP(r.Context(), user.ID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  if totp.EnabledAt != nil {
+    response.WriteError(w, http.StatusConflict, "two_factor_enabled")
+    return
+  }
+  if totp.Secret == "" {
+    response.WriteError(w, http.StatusBadRequest, "totp_not_setup")
+    return
+  }
+
+  step, valid := auth.ValidateTOTP(totp.Secret, req.Code, time.Now())
+  if !valid {
+    response.WriteError(w, http.StatusBadRequest, "invalid_code")
+    return
+  }
+
+  codes, hashes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "setup_failed")
+    return
+  }
+
+  if err := h.store.MFA.EnableTOTP(r.Context(), user.ID, step, hashes); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusConflict, "two_factor_enabled")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "setup_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, types.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// HandleDisableTOTP turns two-factor authentication off. It asks for both
+// the password and a current code so a stolen session alone is not enough.
+func (h *Handler) HandleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  var req types.DisableTOTPRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  record, err := h.store.Users.GetUserByID(r.Context(), user.ID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  if record.TOTPEnabledAt == nil {
+    response.WriteError(w, http.StatusConflict, "two_factor_disabled")
+    return
+  }
+  if _, err := h.cfg.Passwords.Verify(record.PasswordHash, req.Password); err != nil {
+    response.WriteError(w, http.StatusUnauthorized, "invalid_password")
+    return
+  }
+
+  valid, err := h.checkTOTPCode(r.Context(), record.ID, req.Code)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "verify_failed")
+    return
+  }
+  if !valid {
+    response.WriteError(w, http.StatusUnauthorized, "invalid_code")
+    return
+  }
+
+  if err := h.store.MFA.DisableTOTP(r.Context(), record.ID); err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "disable_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleRegenerateRecoveryCodes replaces every recovery code, used or not.
+func (h *Handler) HandleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  var req types.TOTPCodeRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  valid, err := h.checkTOTPCode(r.Context(), user.ID, req.Code)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "verify_failed")
+    return
+  }
+  if !valid {
+    response.WriteError(w, http.StatusUnauthorized, "invalid_code")
+    return
+  }
+
+  codes, hashes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "regenerate_failed")
+    return
+  }
+  if err := h.store.MFA.ReplaceRecoveryCodes(r.Context(), user.ID, hashes); err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "regenerate_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, types.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// checkTOTPCode validates a code against the user's enabled secret and
+// burns its time step so the same code cannot be used twice.
+func (h *Handler) checkTOTPCode(ctx context.Context, userID string, code string) (bool, error) {
+  totp, err := h.store.MFA.GetTOTP(ctx, userID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      return false, nil
+    }
+    return false, err
+  }
+  if totp.EnabledAt == nil {
+    return false, nil
+  }
+
+  step, valid := auth.ValidateTOTP(totp.Secret, code, time.Now())
+  if !valid || step <= totp.LastStep {
+    return false, nil
+  }
+
+  if err := h.store.MFA.UseTOTPStep(ctx, userID, step); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      return false, nil
+    }
+    return false, err
+  }
+  return true, nil
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+  "encoding/json"
+  "errors"
+  "net/http"
+  "strings"
+  "time"
+
+  "github.com/jackc/pgx/v5/pgconn"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/http/cursor"
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
+)
+
+const (
+  defaultModerationLimit = 50
+  maxModerationLimit     = 200
+  maxReportDetailsLen    = 1000
+  maxModerationReasonLen = 500
+)
+
+type moderationLogPosition struct {
+  ID        string    `json:"id"`
+  CreatedAt time.Time `json:"t"`
+}
+
+func (h *Handler) HandleReportPost(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  post, ok := h.loadVisiblePost(w, r)
+  if !ok {
+    return
+  }
+  if post.DeletedAt != nil || post.RemovedAt != nil {
+    response.WriteError(w, http.StatusNotFound, "post_not_found")
+    return
+  }
+
+  var req types.ReportRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  reason := strings.ToLower(strings.TrimSpace(req.Reason))
+  details := strings.TrimSpace(req.Details)
+  if !validReportReason(reason) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_reason")
+    return
+  }
+  if len(details) > maxReportDetailsLen {
+    response.WriteError(w, http.StatusBadRequest, "invalid_details")
+    return
+  }
+
+  report, err := h.store.Moderation.CreateReport(r.Context(), post.ID, user.ID, reason, details)
+  if err != nil {
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+      response.WriteError(w, http.StatusConflict, "already_reported")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "report_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusCreated, types.ReportView{
+    ID:        report.ID,
+    PostID:    report.PostID,
+    Reason:    report.Reason,
+    Details:   report.Details,
+    Status:    report.Status,
+    CreatedAt: report.CreatedAt,
+  })
+}
+
+func (h *Handler) HandleModeratePost(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  post, ok := h.loadVisiblePost(w, r)
+  if !ok {
+    return
+  }
+  if post.DeletedAt != nil {
+    response.WriteError(w, http.StatusNotFound, "post_not_found")
+    return
+  }
+
+  allowed, err := h.authorize(r.Context(), user.ID, post.CommunityID, auth.PermModerate)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  if !allowed {
+    response.WriteError(w, http.StatusForbidden, "forbidden")
+    return
+  }
+
+  var req types.ModerateRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  action := strings.ToLower(strings.TrimSpace(req.Action))
+  reason := strings.TrimSpace(req.Reason)
+  switch action {
+  case models.ModActionRemove, models.ModActionApprove, models.ModActionLock, models.ModActionUnlock,
+    models.ModActionPin, models.ModActionUnpin, models.ModActionDismiss:
+  default:
+    response.WriteError(w, http.StatusBadRequest, "invalid_action")
+    return
+  }
+  if len(reason) > maxModerationReasonLen {
+    response.WriteError(w, http.StatusBadRequest, "invalid_reason")
+    return
+  }
+
+  entry, err := h.store.Moderation.ModeratePost(r.Context(), post.Post, user.ID, action, reason)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "moderation_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, moderationLogEntryView(entry))
+}
+
+func (h *Handler) HandleCommunityReportQueue(w http.ResponseWriter, r *http.Request) {
+  community, ok := h.loadVisibleCommunity(w, r)
+  if !ok {
+    return
+  }
+  h.writeReportQueue(w, r, &community.ID)
+}
+
+func (h *Handler) HandleSiteReportQueue(w http.ResponseWriter, r *http.Request) {
+  h.writeReportQueue(w, r, nil)
+}
+
+func (h *Handler) HandleCommunityModerationLog(w http.ResponseWriter, r *http.Request) {
+  community, ok := h.loadVisibleCommunity(w, r)
+  if !ok {
+    return
+  }
+  h.writeModerationLog(w, r, &community.ID)
+}
+
+func (h *Handler) HandleSiteModerationLog(w http.ResponseWriter, r *http.Request) {
+  h.writeModerationLog(w, r, nil)
+}
+
+func (h *Handler) writeReportQueue(w http.ResponseWriter, r *http.Request, communityID *string) {
+  limit, ok := intQueryParam(r.URL.Query().Get("limit"), defaultModerationLimit, maxModerationLimit)
+  if !ok || limit == 0 {
+    response.WriteError(w, http.StatusBadRequest, "invalid_limit")
+    return
+  }
+
+  groups, err := h.store.Moderation.ListReportQueue(r.Context(), communityID, limit)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  views := make([]types.ReportGroupView, 0, len(groups))
+  for _, group := range groups {
+    views = append(views, types.ReportGroupView{
+      PostID:          group.PostID,
+      PostTitle:       group.PostTitle,
+      Author:          types.AuthorView{ID: group.AuthorID, Username: group.AuthorUsername},
+      ReportCount:     group.ReportCount,
+      Reasons:         group.Reasons,
+      FirstReportedAt: group.FirstReportedAt,
+      LastReportedAt:  group.LastReportedAt,
+    })
+  }
+
+  response.WriteJSON(w, http.StatusOK, views)
+}
+
+func (h *Handler) writeModerationLog(w http.ResponseWriter, r *http.Request, communityID *string) {
+  query := r.URL.Query()
+  limit, ok := intQueryParam(query.Get("limit"), defaultModerationLimit, maxModerationLimit)
+  if !ok || limit == 0 {
+    response.WriteError(w, http.StatusBadRequest, "invalid_limit")
+    return
+  }
+
+  var before *models.ModerationLogEntry
+  if raw := strings.TrimSpace(query.Get("after")); raw != "" {
+    var pos moderationLogPosition
+    if err := cursor.Decode(raw, &pos); err != nil || !isUUID(pos.ID) {
+      response.WriteError(w, http.StatusBadRequest, "invalid_cursor")
+      return
+    }
+    before = &models.ModerationLogEntry{ID: pos.ID, CreatedAt: pos.CreatedAt}
+  }
+
+  entries, err := h.store.Moderation.ListLog(r.Context(), communityID, limit+1, before)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  var nextCursor *string
+  if len(entries) > limit {
+    entries = entries[:limit]
+    last := entries[len(entries)-1]
+    token, err := cursor.Encode(moderationLogPosition{ID: last.ID, CreatedAt: last.CreatedAt})
+    if err != nil {
+      response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+      return
+    }
+    nextCursor = &token
+  }
+
+  views := make([]types.ModerationLogEntryView, 0, len(entries))
+  for _, entry := range entries {
+    views = append(views, moderationLogEntryView(entry))
+  }
+
+  response.WriteJSON(w, http.StatusOK, types.ModerationLogResponse{Entries: views, NextCursor: nextCursor})
+}
+
+func moderationLogEntryView(entry models.ModerationLogEntry) types.ModerationLogEntryView {
+  return types.ModerationLogEntryView{
+    ID:          entry.ID,
+    CommunityID: entry.CommunityID,
+    ModeratorID: entry.ModeratorID,
+    Action:      entry.Action,
+    TargetType:  entry.TargetType,
+    TargetID:    entry.TargetID,
+    Reason:      entry.Reason,
+    CreatedAt:   entry.CreatedAt,
+  }
+}
+
+func validReportReason(reason string) bool {
+  for _, valid := range models.ReportReasons {
+    if reason == valid {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+  "context"
+  "crypto/subtle"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "log"
+  "math/rand/v2"
+  "net/http"
+  "strings"
+  "time"
+
+  "github.com/go-chi/chi/v5"
+  "github.com/jackc/pgx/v5/pgconn"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/auth/oidc"
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+const (
+  oidcStateTTL        = 10 * time.Minute
+  oidcStateCookie     = "oidc_state"
+  maxUsernameAttempts = 5
+  maxDerivedUsername  = 24
+)
+
+// HandleOIDCStart begins a login through an identity provider and returns
+// the URL to send the browser to.
+func (h *Handler) HandleOIDCStart(w http.ResponseWriter, r *http.Request) {
+  h.startOIDC(w, r, nil)
+}
+
+// HandleLinkIdentityStart is HandleOIDCStart for a signed-in user adding
+// another way to log in.
+func (h *Handler) HandleLinkIdentityStart(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+  h.startOIDC(w, r, &user.ID)
+}
+
+func (h *Handler) startOIDC(w http.ResponseWriter, r *http.Request, linkUserID *string) {
+  client, ok := h.cfg.OIDC[chi.URLParam(r, "provider")]
+  if !ok {
+    response.WriteError(w, http.StatusNotFound, "provider_not_found")
+    return
+  }
+
+  state, errState := oidc.NewRandom()
+  nonce, errNonce := oidc.NewRandom()
+  verifier, errVerifier := oidc.NewRandom()
+  if err := errors.Join(errState, errNonce, errVerifier); err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "oidc_failed")
+    return
+  }
+
+  authURL, err := client.AuthCodeURL(r.Context(), state, nonce, verifier)
+  if err != nil {
+    log.Printf("oidc %s: %v", client.Name(), err)
+    response.WriteError(w, http.StatusBadGateway, "provider_unavailable")
+    return
+  }
+
+  stateHash := auth.HashToken(state)
+  err = h.store.Identities.SaveLoginState(r.Context(), stateHash, models.OIDCLoginState{
+    Provider:     client.Name(),
+    Nonce:        nonce,
+    CodeVerifier: verifier,
+    LinkUserID:   linkUserID,
+  }, time.Now().Add(oidcStateTTL))
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "oidc_failed")
+    return
+  }
+
+  h.setOIDCStateCookie(w, r, stateHash, int(oidcStateTTL.Seconds()))
+  response.WriteJSON(w, http.StatusOK, types.OIDCStartResponse{AuthorizationURL: authURL})
+}
+
+// HandleOIDCCallback finishes a login with the code and state the provider
+// redirected back with.
+func (h *Handler) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+  provider, claims, ok := h.completeOIDC(w, r, nil)
+  if !ok {
+    return
+  }
+
+  userID, err := h.store.Identities.TouchIdentity(r.Context(), provider, claims.Subject)
+  if err == nil {
+    user, err := h.store.Users.GetUserByID(r.Context(), userID)
+    if err != nil {
+      response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+      return
+    }
+    if user.TOTPEnabledAt != nil {
+      h.writeMFAChallenge(w, user)
+      return
+    }
+    h.startSession(w, r, user, http.StatusOK)
+    return
+  }
+  if !errors.Is(err, store.ErrNotFound) {
+    response.WriteError(w, http.StatusInternalServerError, "oidc_failed")
+    return
+  }
+
+  h.registerFromIdentity(w, r, provider, claims)
+}
+
+// HandleLinkIdentityCallback is HandleOIDCCallback for a link started with
+// HandleLinkIdentityStart. It only accepts a state started by the same
+// signed-in user, so nobody can attach their identity to someone else's
+// account or the other way round.
+func (h *Handler) HandleLinkIdentityCallback(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  provider, claims, ok := h.completeOIDC(w, r, &user.ID)
+  if !ok {
+    return
+  }
+  h.linkIdentity(w, r, user.ID, provider, claims)
+}
+
+// completeOIDC checks a callback against the state cookie set by startOIDC,
+// consumes the stored state and redeems the code. linkUserID must match the
+// user the flow was started for, nil for a plain login. It writes the
+// error response itself when that fails.
+func (h *Handler) completeOIDC(w http.ResponseWriter, r *http.Request, linkUserID *string) (string, oidc.Claims, bool) {
+  client, ok := h.cfg.OIDC[chi.URLParam(r, "provider")]
+  if !ok {
+    response.WriteError(w, http.StatusNotFound, "provider_not_found")
+    return "", oidc.Claims{}, false
+  }
+
+  var req types.OIDCCallbackRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return "", oidc.Claims{}, false
+  }
+  if req.Code == "" || req.State == "" {
+    response.WriteError(w, http.StatusBadRequest, "invalid_callback")
+    return "", oidc.Claims{}, false
+  }
+
+  // The state has to come back to the browser that started the flow, or
+  // an attacker could finish their own login in the victim's browser.
+  stateHash := auth.HashToken(req.State)
+  cookie, err := r.Cookie(oidcStateCookie)
+  if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateHash)) != 1 {
+    response.WriteError(w, http.StatusBadRequest, "invalid_state")
+    return "", oidc.Claims{}, false
+  }
+  h.setOIDCStateCookie(w, r, "", -1)
+
+  state, err := h.store.Identities.ConsumeLoginState(r.Context(), stateHash)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusBadRequest, "invalid_state")
+      return "", oidc.Claims{}, false
+    }
+    response.WriteError(w, http.StatusInternalServerError, "oidc_failed")
+    return "", oidc.Claims{}, false
+  }
+  if state.Provider != client.Name() || !sameUserID(state.LinkUserID, linkUserID) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_state")
+    return "", oidc.Claims{}, false
+  }
+
+  claims, err := client.Exchange(r.Context(), req.Code, state.CodeVerifier, state.Nonce)
+  if err != nil {
+    log.Printf("oidc %s: %v", client.Name(), err)
+    response.WriteError(w, http.StatusUnauthorized, "oidc_login_failed")
+    return "", oidc.Claims{}, false
+  }
+  return client.Name(), claims, true
+}
+
+// registerFromIdentity creates an account for a first-time OIDC login. An
+// existing account with the same email is never taken over automatically:
+// its owner has to sign in and link the identity themselves.
+func (h *Handler) registerFromIdentity(w http.ResponseWriter, r *http.Request, provider string, claims oidc.Claims) {
+  email := normalizeEmail(claims.Email)
+  if email == "" {
+    response.WriteError(w, http.StatusBadRequest, "email_required")
+    return
+  }
+
+  _, err := h.store.Users.GetUserByEmail(r.Context(), email)
+  if err == nil {
+    response.WriteError(w, http.StatusConflict, "link_required")
+    return
+  }
+  if !errors.Is(err, store.ErrNotFound) {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  base := usernameFromClaims(claims)
+  for attempt := 0; attempt < maxUsernameAttempts; attempt++ {
+    username := base
+    if attempt > 0 {
+      username = fmt.Sprintf("%s%04d", base, rand.IntN(10000))
+    }
+
+    user, err := h.store.Identities.CreateUserWithIdentity(r.Context(), email, username, claims.EmailVerified, provider, claims.Subject)
+    if err == nil {
+      h.startSession(w, r, user, http.StatusCreated)
+      return
+    }
+
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+      switch pgErr.ConstraintName {
+      case "users_username_unique":
+        continue
+      case "identities_subject_unique":
+        response.WriteError(w, http.StatusConflict, "identity_taken")
+        return
+      default:
+        response.WriteError(w, http.StatusConflict, "link_required")
+        return
+      }
+    }
+    response.WriteError(w, http.StatusInternalServerError, "create_failed")
+    return
+  }
+
+  response.WriteError(w, http.StatusConflict, "username_taken")
+}
+
+func (h *Handler) linkIdentity(w http.ResponseWriter, r *http.Request, userID string, provider string, claims oidc.Claims) {
+  identity, err := h.store.Identities.LinkIdentity(r.Context(), userID, provider, claims.Subject, normalizeEmail(claims.Email))
+  if err != nil {
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+      if pgErr.ConstraintName == "identities_user_provider_unique" {
+        response.WriteError(w, http.StatusConflict, "provider_already_linked")
+        return
+      }
+      response.WriteError(w, http.StatusConflict, "identity_taken")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "link_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, types.LinkedIdentityResponse{Identity: identityView(identity)})
+}
+
+func (h *Handler) HandleListIdentities(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  identities, err := h.store.Identities.ListIdentities(r.Context(), user.ID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  views := make([]types.IdentityView, 0, len(identities))
+  for _, identity := range identities {
+    views = append(views, identityView(identity))
+  }
+
+  response.WriteJSON(w, http.StatusOK, views)
+}
+
+// HandleUnlinkIdentity removes an identity, unless it is the only way left
+// to sign in to a passwordless account.
+func (h *Handler) HandleUnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  identityID := strings.TrimSpace(chi.URLParam(r, "identityID"))
+  if !isUUID(identityID) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_identity")
+    return
+  }
+
+  lastMethod, err := h.isLastLoginMethod(r.Context(), user.ID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  if lastMethod {
+    response.WriteError(w, http.StatusConflict, "last_login_method")
+    return
+  }
+
+  if err := h.store.Identities.DeleteIdentity(r.Context(), user.ID, identityID); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "identity_not_found")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "unlink_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// isLastLoginMethod reports whether the user has no password and at most
+// one linked identity.
+func (h *Handler) isLastLoginMethod(ctx context.Context, userID string) (bool, error) {
+  record, err := h.store.Users.GetUserByID(ctx, userID)
+  if err != nil {
+    return false, err
+  }
+  if record.PasswordHash != "" {
+    return false, nil
+  }
+  identities, err := h.store.Identities.ListIdentities(ctx, userID)
+  if err != nil {
+    return false, err
+  }
+  return len(identities) <= 1, nil
+}
+
+// usernameFromClaims derives a username from the provider's profile,
+// keeping only characters that are safe in URLs and skipping candidates
+// that validateUsername would refuse.
+func usernameFromClaims(claims oidc.Claims) string {
+  candidates := []string{claims.PreferredUsername, strings.Split(claims.Email, "@")[0], claims.Name}
+  for _, candidate := range candidates {
+    var b strings.Builder
+    for _, c := range normalizeUsername(candidate) {
+      if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' || c == '-' || c == '.' {
+        b.WriteRune(c)
+      }
+      if b.Len() == maxDerivedUsername {
+        break
+      }
+    }
+    if validateUsername(b.String()) == nil {
+      return b.String()
+    }
+  }
+  return "user"
+}
+
+func sameUserID(a *string, b *string) bool {
+  if a == nil || b == nil {
+    return a == nil && b == nil
+  }
+  return *a == *b
+}
+
+// setOIDCStateCookie ties a login state to the browser that started it;
+// a negative maxAge clears it. In production the web client is on another
+// site, so over HTTPS the cookie has to be SameSite=None to be sent with
+// its callback request. It is HttpOnly and only holds the state's hash.
+func (h *Handler) setOIDCStateCookie(w http.ResponseWriter, r *http.Request, stateHash string, maxAge int) {
+  secure := h.isSecureRequest(r)
+  sameSite := http.SameSiteLaxMode
+  if secure {
+    sameSite = http.SameSiteNoneMode
+  }
+  http.SetCookie(w, &http.Cookie{
+    Name:     oidcStateCookie,
+    Value:    stateHash,
+    Path:     "/api/v1",
+    MaxAge:   maxAge,
+    HttpOnly: true,
+    Secure:   secure,
+    SameSite: sameSite,
+  })
+}
+
+// isSecureRequest reports whether the client reached the API over HTTPS,
+// directly or through a trusted TLS-terminating proxy.
+func (h *Handler) isSecureRequest(r *http.Request) bool {
+  return r.TLS != nil || (h.cfg.TrustedProxyHops > 0 && r.Header.Get("X-Forwarded-Proto") == "https")
+}
+
+func identityView(identity models.Identity) types.IdentityView {
+  return types.IdentityView{
+    ID:          identity.ID,
+    Provider:    identity.Provider,
+    Email:       identity.Email,
+    CreatedAt:   identity.CreatedAt,
+    LastLoginAt: identity.LastLoginAt,
+  }
+}
@@ -0,0 +1,396 @@
+package handlers_test
+
+import (
+  "bytes"
+  "context"
+  "crypto/rand"
+  "database/sql"
+  "encoding/hex"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "os"
+  "testing"
+  "time"
+
+  _ "github.com/jackc/pgx/v5/stdlib"
+  "github.com/pressly/goose/v3"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/auth/oidc"
+  "jabber_v3/apps/api/internal/auth/oidc/oidctest"
+  "jabber_v3/apps/api/internal/http/handlers"
+  "jabber_v3/apps/api/internal/http/routes"
+  "jabber_v3/apps/api/internal/mail"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+const testRedirectURL = "http://app.test/auth/oidc/fake/callback"
+
+type discardMailer struct{}
+
+func (discardMailer) Send(context.Context, mail.Message) error { return nil }
+
+type oidcEnv struct {
+  router   http.Handler
+  store    *store.Store
+  provider *oidctest.Provider
+  client   *oidc.Client
+}
+
+// newOIDCEnv serves the API against the database in TEST_DATABASE_URL with
+// an in-process provider named "fake". Tests are skipped without one.
+func newOIDCEnv(t *testing.T) *oidcEnv {
+  t.Helper()
+  dsn := os.Getenv("TEST_DATABASE_URL")
+  if dsn == "" {
+    t.Skip("TEST_DATABASE_URL is not set")
+  }
+
+  db, err := sql.Open("pgx", dsn)
+  if err != nil {
+    t.Fatalf("db open: %v", err)
+  }
+  t.Cleanup(func() { db.Close() })
+  goose.SetLogger(goose.NopLogger())
+  if err := goose.SetDialect("postgres"); err != nil {
+    t.Fatalf("goose: %v", err)
+  }
+  if err := goose.Up(db, "../../../db/migrations"); err != nil {
+    t.Fatalf("migrations: %v", err)
+  }
+
+  provider, server, err := oidctest.Start("client", "secret")
+  if err != nil {
+    t.Fatalf("start provider: %v", err)
+  }
+  t.Cleanup(server.Close)
+  client := oidc.NewClient(provider.Config("fake", testRedirectURL), server.Client())
+
+  appStore := store.New(db)
+  jwt := auth.JWTManager{Keys: auth.NewHMACKeySet([]byte("test-secret")), TTL: time.Minute}
+  cfg := handlers.Config{
+    AppURL:    "http://app.test",
+    OIDC:      map[string]*oidc.Client{"fake": client},
+    Passwords: auth.PasswordHasher{Params: auth.Argon2Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 1}},
+  }
+  return &oidcEnv{
+    router:   routes.NewRouter(appStore, jwt, discardMailer{}, cfg, []string{"http://app.test"}),
+    store:    appStore,
+    provider: provider,
+    client:   client,
+  }
+}
+
+// newUser points the provider at a fresh identity so tests don't collide
+// with data left by earlier runs.
+func (e *oidcEnv) newUser(t *testing.T) oidctest.User {
+  t.Helper()
+  suffix := randomHex(t)
+  user := oidctest.User{
+    Subject:           "sub-" + suffix,
+    Email:             "oidc-" + suffix + "@example.com",
+    EmailVerified:     true,
+    PreferredUsername: "oidc" + suffix,
+  }
+  e.provider.SetUser(user)
+  return user
+}
+
+func (e *oidcEnv) do(t *testing.T, method string, path string, token string, body any, cookie *http.Cookie) *httptest.ResponseRecorder {
+  t.Helper()
+  var payload bytes.Buffer
+  if body != nil {
+    if err := json.NewEncoder(&payload).Encode(body); err != nil {
+      t.Fatalf("encode: %v", err)
+    }
+  }
+  req := httptest.NewRequest(method, path, &payload)
+  req.Header.Set("Content-Type", "application/json")
+  if token != "" {
+    req.Header.Set("Authorization", "Bearer "+token)
+  }
+  if cookie != nil {
+    req.AddCookie(cookie)
+  }
+  rec := httptest.NewRecorder()
+  e.router.ServeHTTP(rec, req)
+  return rec
+}
+
+type oidcFlow struct {
+  code   string
+  state  string
+  cookie *http.Cookie
+}
+
+// start begins a flow at path and follows the authorization URL to the
+// provider like the browser would.
+func (e *oidcEnv) start(t *testing.T, path string, token string) oidcFlow {
+  t.Helper()
+  rec := e.do(t, http.MethodPost, path, token, nil, nil)
+  if rec.Code != http.StatusOK {
+    t.Fatalf("start: status %d: %s", rec.Code, rec.Body)
+  }
+  var started struct {
+    AuthorizationURL string `json:"authorizationUrl"`
+  }
+  decode(t, rec, &started)
+
+  var cookie *http.Cookie
+  for _, c := range rec.Result().Cookies() {
+    if c.Name == "oidc_state" {
+      cookie = c
+    }
+  }
+  if cookie == nil || !cookie.HttpOnly || cookie.SameSite == http.SameSiteDefaultMode {
+    t.Fatalf("start: missing HttpOnly SameSite state cookie, got %+v", cookie)
+  }
+
+  callback := authorize(t, started.AuthorizationURL)
+  return oidcFlow{code: callback.Get("code"), state: callback.Get("state"), cookie: cookie}
+}
+
+func (e *oidcEnv) finish(t *testing.T, path string, token string, flow oidcFlow) *httptest.ResponseRecorder {
+  t.Helper()
+  return e.do(t, http.MethodPost, path, token, map[string]string{"code": flow.code, "state": flow.state}, flow.cookie)
+}
+
+func (e *oidcEnv) register(t *testing.T) (string, string) {
+  t.Helper()
+  suffix := randomHex(t)
+  rec := e.do(t, http.MethodPost, "/api/v1/auth/register", "", map[string]string{
+    "email":    "local-" + suffix + "@example.com",
+    "username": "local" + suffix,
+    "password": "correct horse battery " + suffix,
+  }, nil)
+  if rec.Code != http.StatusCreated {
+    t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+  }
+  var res authResponse
+  decode(t, rec, &res)
+  return res.User.ID, res.Token
+}
+
+type authResponse struct {
+  Token string `json:"token"`
+  User  struct {
+    ID    string `json:"id"`
+    Email string `json:"email"`
+  } `json:"user"`
+}
+
+func authorize(t *testing.T, authURL string) url.Values {
+  t.Helper()
+  client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+    return http.ErrUseLastResponse
+  }}
+  res, err := client.Get(authURL)
+  if err != nil {
+    t.Fatalf("authorize: %v", err)
+  }
+  defer res.Body.Close()
+  location, err := url.Parse(res.Header.Get("Location"))
+  if err != nil || res.StatusCode != http.StatusFound {
+    t.Fatalf("authorize: status %d, location %q", res.StatusCode, res.Header.Get("Location"))
+  }
+  return location.Query()
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, out any) {
+  t.Helper()
+  if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+    t.Fatalf("decode %q: %v", rec.Body, err)
+  }
+}
+
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+  t.Helper()
+  var body struct {
+    Error string `json:"error"`
+  }
+  _ = json.Unmarshal(rec.Body.Bytes(), &body)
+  if rec.Code != status || body.Error != code {
+    t.Fatalf("got %d %q, want %d %q: %s", rec.Code, body.Error, status, code, rec.Body)
+  }
+}
+
+func randomHex(t *testing.T) string {
+  t.Helper()
+  buf := make([]byte, 6)
+  if _, err := rand.Read(buf); err != nil {
+    t.Fatalf("rand: %v", err)
+  }
+  return hex.EncodeToString(buf)
+}
+
+const (
+  loginStart    = "/api/v1/auth/oidc/fake/start"
+  loginCallback = "/api/v1/auth/oidc/fake/callback"
+  linkStart     = "/api/v1/me/identities/fake/start"
+  linkCallback  = "/api/v1/me/identities/fake/callback"
+)
+
+func TestOIDCFirstLoginCreatesAccount(t *testing.T) {
+  env := newOIDCEnv(t)
+  user := env.newUser(t)
+
+  rec := env.finish(t, loginCallback, "", env.start(t, loginStart, ""))
+  if rec.Code != http.StatusCreated {
+    t.Fatalf("first login: status %d: %s", rec.Code, rec.Body)
+  }
+  var created authResponse
+  decode(t, rec, &created)
+  if created.Token == "" || created.User.Email != user.Email {
+    t.Fatalf("first login: unexpected response %s", rec.Body)
+  }
+
+  rec = env.finish(t, loginCallback, "", env.start(t, loginStart, ""))
+  if rec.Code != http.StatusOK {
+    t.Fatalf("second login: status %d: %s", rec.Code, rec.Body)
+  }
+  var again authResponse
+  decode(t, rec, &again)
+  if again.User.ID != created.User.ID {
+    t.Fatalf("second login signed in as %s, want %s", again.User.ID, created.User.ID)
+  }
+}
+
+func TestOIDCLoginRefusesExistingEmail(t *testing.T) {
+  env := newOIDCEnv(t)
+  _, token := env.register(t)
+  var me struct {
+    Email string `json:"email"`
+  }
+  decode(t, env.do(t, http.MethodGet, "/api/v1/me", token, nil, nil), &me)
+  env.provider.SetUser(oidctest.User{Subject: "sub-" + randomHex(t), Email: me.Email, EmailVerified: true})
+
+  rec := env.finish(t, loginCallback, "", env.start(t, loginStart, ""))
+  expectError(t, rec, http.StatusConflict, "link_required")
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+  env := newOIDCEnv(t)
+  env.newUser(t)
+
+  flow := env.start(t, loginStart, "")
+  withoutCookie := flow
+  withoutCookie.cookie = nil
+  expectError(t, env.finish(t, loginCallback, "", withoutCookie), http.StatusBadRequest, "invalid_state")
+
+  // A state cookie from another flow, e.g. the attacker's own.
+  other := env.start(t, loginStart, "")
+  mixed := flow
+  mixed.cookie = other.cookie
+  expectError(t, env.finish(t, loginCallback, "", mixed), http.StatusBadRequest, "invalid_state")
+
+  // Rejected callbacks leave the flow usable by its own browser.
+  if rec := env.finish(t, loginCallback, "", flow); rec.Code != http.StatusCreated {
+    t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+  }
+}
+
+func TestOIDCCallbackRejectsReplayedState(t *testing.T) {
+  env := newOIDCEnv(t)
+  env.newUser(t)
+
+  flow := env.start(t, loginStart, "")
+  if rec := env.finish(t, loginCallback, "", flow); rec.Code != http.StatusCreated {
+    t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+  }
+  expectError(t, env.finish(t, loginCallback, "", flow), http.StatusBadRequest, "invalid_state")
+}
+
+func TestOIDCCallbackRejectsExpiredState(t *testing.T) {
+  env := newOIDCEnv(t)
+  env.newUser(t)
+
+  state, verifier, nonce := randomHex(t), randomHex(t)+randomHex(t)+randomHex(t)+randomHex(t), randomHex(t)
+  stateHash := auth.HashToken(state)
+  err := env.store.Identities.SaveLoginState(context.Background(), stateHash, models.OIDCLoginState{
+    Provider:     "fake",
+    Nonce:        nonce,
+    CodeVerifier: verifier,
+  }, time.Now().Add(-time.Minute))
+  if err != nil {
+    t.Fatalf("save state: %v", err)
+  }
+  authURL, err := env.client.AuthCodeURL(context.Background(), state, nonce, verifier)
+  if err != nil {
+    t.Fatalf("AuthCodeURL: %v", err)
+  }
+  callback := authorize(t, authURL)
+
+  flow := oidcFlow{code: callback.Get("code"), state: state, cookie: &http.Cookie{Name: "oidc_state", Value: stateHash}}
+  expectError(t, env.finish(t, loginCallback, "", flow), http.StatusBadRequest, "invalid_state")
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+  env := newOIDCEnv(t)
+  env.newUser(t)
+
+  // The stored state expects one nonce, the provider is sent another.
+  state, verifier := randomHex(t), randomHex(t)+randomHex(t)+randomHex(t)+randomHex(t)
+  stateHash := auth.HashToken(state)
+  err := env.store.Identities.SaveLoginState(context.Background(), stateHash, models.OIDCLoginState{
+    Provider:     "fake",
+    Nonce:        "expected-" + randomHex(t),
+    CodeVerifier: verifier,
+  }, time.Now().Add(time.Minute))
+  if err != nil {
+    t.Fatalf("save state: %v", err)
+  }
+  authURL, err := env.client.AuthCodeURL(context.Background(), state, "injected-"+randomHex(t), verifier)
+  if err != nil {
+    t.Fatalf("AuthCodeURL: %v", err)
+  }
+  callback := authorize(t, authURL)
+
+  flow := oidcFlow{code: callback.Get("code"), state: state, cookie: &http.Cookie{Name: "oidc_state", Value: stateHash}}
+  expectError(t, env.finish(t, loginCallback, "", flow), http.StatusUnauthorized, "oidc_login_failed")
+}
+
+func TestOIDCLinkExistingUser(t *testing.T) {
+  env := newOIDCEnv(t)
+  userID, token := env.register(t)
+  provider := env.newUser(t)
+
+  rec := env.finish(t, linkCallback, token, env.start(t, linkStart, token))
+  if rec.Code != http.StatusOK {
+    t.Fatalf("link: status %d: %s", rec.Code, rec.Body)
+  }
+  var linked struct {
+    Identity struct {
+      Provider string `json:"provider"`
+      Email    string `json:"email"`
+    } `json:"identity"`
+  }
+  decode(t, rec, &linked)
+  if linked.Identity.Provider != "fake" || linked.Identity.Email != provider.Email {
+    t.Fatalf("link: unexpected response %s", rec.Body)
+  }
+
+  rec = env.finish(t, loginCallback, "", env.start(t, loginStart, ""))
+  if rec.Code != http.StatusOK {
+    t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+  }
+  var signedIn authResponse
+  decode(t, rec, &signedIn)
+  if signedIn.User.ID != userID {
+    t.Fatalf("login signed in as %s, want the linked user %s", signedIn.User.ID, userID)
+  }
+}
+
+func TestOIDCLinkCallbackRequiresSameUser(t *testing.T) {
+  env := newOIDCEnv(t)
+  _, attackerToken := env.register(t)
+  _, victimToken := env.register(t)
+  env.newUser(t)
+
+  expectError(t, env.finish(t, linkCallback, "", env.start(t, linkStart, attackerToken)), http.StatusUnauthorized, "unauthorized")
+  expectError(t, env.finish(t, linkCallback, victimToken, env.start(t, linkStart, attackerToken)), http.StatusBadRequest, "invalid_state")
+  expectError(t, env.finish(t, loginCallback, "", env.start(t, linkStart, attackerToken)), http.StatusBadRequest, "invalid_state")
+  expectError(t, env.finish(t, linkCallback, victimToken, env.start(t, loginStart, "")), http.StatusBadRequest, "invalid_state")
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+  "context"
+  "errors"
+  "net/http"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/store"
+)
+
+// authorize is the handler-side counterpart of middleware.RequirePermission
+// for resources whose community is only known after loading them. A nil
+// communityID checks site-wide permissions only.
+func (h *Handler) authorize(ctx context.Context, userID string, communityID *string, perm auth.Permission) (bool, error) {
+  user, err := h.store.Users.GetUserByID(ctx, userID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      return false, nil
+    }
+    return false, err
+  }
+
+  communityRole := ""
+  if communityID != nil {
+    role, err := h.store.Communities.GetMemberRole(ctx, *communityID, userID)
+    if err != nil && !errors.Is(err, store.ErrNotFound) {
+      return false, err
+    }
+    communityRole = role
+  }
+
+  return auth.Can(user.Role, communityRole, perm), nil
+}
+
+// viewerCanModerate reports whether the signed-in viewer, if any, moderates
+// the community, or the site when communityID is nil.
+func (h *Handler) viewerCanModerate(r *http.Request, communityID *string) (bool, error) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    return false, nil
+  }
+  return h.authorize(r.Context(), user.ID, communityID, auth.PermModerate)
+}
+
+// checkVerifiedEmail writes an error and returns false when the deployment
+// requires a verified address to post and the user has not verified theirs.
+func (h *Handler) checkVerifiedEmail(w http.ResponseWriter, user types.AuthUser) bool {
+  if !h.cfg.RequireVerifiedEmail || user.EmailVerified {
+    return true
+  }
+  response.WriteError(w, http.StatusForbidden, "email_unverified")
+  return false
+}
+
+// checkCommunityBan writes the ban response and returns false when userID
+// is banned from the community. Site bans are handled by middleware.Auth.
+func (h *Handler) checkCommunityBan(w http.ResponseWriter, r *http.Request, userID string, communityID *string) bool {
+  if communityID == nil {
+    return true
+  }
+  ban, err := h.store.Bans.GetActiveBan(r.Context(), userID, communityID)
+  if err == nil {
+    response.WriteBanned(w, ban.Reason, ban.ExpiresAt)
+    return false
+  }
+  if !errors.Is(err, store.ErrNotFound) {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return false
+  }
+  return true
+}
@@ -2,14 +2,19 @@ package handlers
 
 import (
   "encoding/json"
+  "errors"
   "net/http"
   "strings"
+  "time"
 
   "github.com/go-chi/chi/v5"
+  "github.com/jackc/pgx/v5/pgconn"
 
+  "jabber_v3/apps/api/internal/http/cursor"
   "jabber_v3/apps/api/internal/http/requestctx"
   "jabber_v3/apps/api/internal/http/response"
   "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
   "jabber_v3/apps/api/internal/store"
 )
 
@@ -19,6 +24,9 @@ func (h *Handler) HandleCreatePost(w http.ResponseWriter, r *http.Request) {
     response.WriteError(w, http.StatusUnauthorized, "unauthorized")
     return
   }
+  if !h.checkVerifiedEmail(w, user) {
+    return
+  }
 
   record, err := h.store.Users.GetUserByID(r.Context(), user.ID)
   if err != nil {
@@ -43,7 +51,34 @@ func (h *Handler) HandleCreatePost(w http.ResponseWriter, r *http.Request) {
     return
   }
 
-  post, err := h.store.Posts.CreatePost(r.Context(), record.ID, title, body)
+  var community *types.CommunitySummary
+  var communityID *string
+  if slug := strings.ToLower(strings.TrimSpace(req.Community)); slug != "" {
+    target, err := h.store.Communities.GetCommunityWithStats(r.Context(), slug, &record.ID)
+    if err != nil {
+      if errors.Is(err, store.ErrNotFound) {
+        response.WriteError(w, http.StatusNotFound, "community_not_found")
+        return
+      }
+      response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+      return
+    }
+    if target.Visibility != models.CommunityPublic && target.ViewerRole == nil {
+      if target.Visibility == models.CommunityPrivate {
+        response.WriteError(w, http.StatusNotFound, "community_not_found")
+        return
+      }
+      response.WriteError(w, http.StatusForbidden, "members_only")
+      return
+    }
+    if !h.checkCommunityBan(w, r, record.ID, &target.ID) {
+      return
+    }
+    communityID = &target.ID
+    community = &types.CommunitySummary{ID: target.ID, Slug: target.Slug, Name: target.Name}
+  }
+
+  post, err := h.store.Posts.CreatePost(r.Context(), record.ID, communityID, title, body)
   if err != nil {
     response.WriteError(w, http.StatusInternalServerError, "create_failed")
     return
@@ -54,44 +89,244 @@ func (h *Handler) HandleCreatePost(w http.ResponseWriter, r *http.Request) {
     Title: post.Title,
     Body: post.Body,
     CreatedAt: post.CreatedAt,
-    Author: types.AuthorView{ID: record.ID, Email: record.Email, Username: record.Username},
+    Author: types.AuthorView{ID: record.ID, Username: record.Username},
     Score: 0,
     MyVote: 0,
+    Community: community,
   })
 }
 
+const (
+  defaultFeedLimit = 25
+  maxFeedLimit     = 100
+)
+
+var feedWindows = map[string]time.Duration{
+  "hour":  time.Hour,
+  "day":   24 * time.Hour,
+  "week":  7 * 24 * time.Hour,
+  "month": 30 * 24 * time.Hour,
+  "all":   0,
+}
+
+type feedPosition struct {
+  Sort      string    `json:"s"`
+  ID        string    `json:"id"`
+  Pinned    bool      `json:"p,omitempty"`
+  CreatedAt time.Time `json:"t"`
+  Score     int       `json:"sc,omitempty"`
+  HotRank   float64   `json:"h,omitempty"`
+}
+
 func (h *Handler) HandleFeed(w http.ResponseWriter, r *http.Request) {
-  var userID *string
-  if user, ok := requestctx.AuthUserFromContext(r.Context()); ok {
-    userID = &user.ID
+  query := r.URL.Query()
+  opts := store.FeedOptions{Sort: strings.ToLower(strings.TrimSpace(query.Get("sort")))}
+  switch opts.Sort {
+  case "":
+    opts.Sort = store.FeedSortNew
+  case store.FeedSortNew, store.FeedSortTop, store.FeedSortHot:
+  default:
+    response.WriteError(w, http.StatusBadRequest, "invalid_sort")
+    return
+  }
+
+  if opts.Sort == store.FeedSortTop {
+    window := strings.ToLower(strings.TrimSpace(query.Get("t")))
+    if window == "" {
+      window = "day"
+    }
+    span, ok := feedWindows[window]
+    if !ok {
+      response.WriteError(w, http.StatusBadRequest, "invalid_window")
+      return
+    }
+    if span > 0 {
+      since := time.Now().Add(-span)
+      opts.Since = &since
+    }
+  }
+
+  limit, ok := intQueryParam(query.Get("limit"), defaultFeedLimit, maxFeedLimit)
+  if !ok || limit == 0 {
+    response.WriteError(w, http.StatusBadRequest, "invalid_limit")
+    return
+  }
+  opts.Limit = limit + 1
+
+  if raw := strings.TrimSpace(query.Get("after")); raw != "" {
+    var pos feedPosition
+    if err := cursor.Decode(raw, &pos); err != nil || pos.Sort != opts.Sort || !isUUID(pos.ID) {
+      response.WriteError(w, http.StatusBadRequest, "invalid_cursor")
+      return
+    }
+    opts.After = &store.FeedCursor{ID: pos.ID, Pinned: pos.Pinned, CreatedAt: pos.CreatedAt, Score: pos.Score, HotRank: pos.HotRank}
+  }
+
+  opts.ViewerID = viewerIDFromContext(r)
+
+  // A community filter shows that community; otherwise signed-in viewers
+  // get their subscriptions, falling back to everything until they have any.
+  if slug := strings.ToLower(strings.TrimSpace(query.Get("community"))); slug != "" {
+    community, err := h.store.Communities.GetCommunityWithStats(r.Context(), slug, opts.ViewerID)
+    if err != nil {
+      if errors.Is(err, store.ErrNotFound) {
+        response.WriteError(w, http.StatusNotFound, "community_not_found")
+        return
+      }
+      response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+      return
+    }
+    if community.Visibility == models.CommunityPrivate && community.ViewerRole == nil {
+      response.WriteError(w, http.StatusNotFound, "community_not_found")
+      return
+    }
+    opts.CommunityID = &community.ID
+  } else if opts.ViewerID != nil {
+    subscribed, err := h.store.Communities.HasSubscriptions(r.Context(), *opts.ViewerID)
+    if err != nil {
+      response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+      return
+    }
+    opts.Subscribed = subscribed
   }
 
-  posts, err := h.store.Posts.ListFeed(r.Context(), 50, userID)
+  posts, err := h.store.Posts.ListFeed(r.Context(), opts)
   if err != nil {
     response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
     return
   }
 
+  var nextCursor *string
+  if len(posts) > limit {
+    posts = posts[:limit]
+    last := posts[len(posts)-1]
+    token, err := cursor.Encode(feedPosition{
+      Sort:      opts.Sort,
+      ID:        last.ID,
+      Pinned:    last.PinnedAt != nil,
+      CreatedAt: last.CreatedAt,
+      Score:     last.Score,
+      HotRank:   last.HotRank,
+    })
+    if err != nil {
+      response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+      return
+    }
+    nextCursor = &token
+  }
+
+  viewer, err := h.loadViewerAudience(r)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
   views := make([]types.PostView, 0, len(posts))
   for _, post := range posts {
-    views = append(views, types.PostView{
+    views = append(views, postView(post, viewer.of(post.UserID, post.CommunityID)))
+  }
+
+  response.WriteJSON(w, http.StatusOK, types.FeedResponse{Posts: views, NextCursor: nextCursor})
+}
+
+func (h *Handler) HandleGetPost(w http.ResponseWriter, r *http.Request) {
+  post, ok := h.loadVisiblePost(w, r)
+  if !ok {
+    return
+  }
+  viewer, err := h.loadViewerAudience(r)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  audience := viewer.of(post.UserID, post.CommunityID)
+  // Without comments a gone post has nothing left to show, except to the
+  // moderators reviewing it.
+  if (post.DeletedAt != nil || post.RemovedAt != nil) && post.CommentCount == 0 && audience&types.AudienceModerator == 0 {
+    response.WriteError(w, http.StatusNotFound, "post_not_found")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, postView(post, audience))
+}
+
+// loadVisiblePost resolves the {postID} route param to a post the current
+// viewer may see, writing the error response itself when that fails.
+func (h *Handler) loadVisiblePost(w http.ResponseWriter, r *http.Request) (models.PostWithStats, bool) {
+  postID := strings.TrimSpace(chi.URLParam(r, "postID"))
+  if !isUUID(postID) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_post")
+    return models.PostWithStats{}, false
+  }
+
+  post, err := h.store.Posts.GetPostWithStats(r.Context(), postID, viewerIDFromContext(r))
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "post_not_found")
+      return models.PostWithStats{}, false
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return models.PostWithStats{}, false
+  }
+  return post, true
+}
+
+// postView renders post for audience. Deleted and removed posts keep their
+// place in threads as a placeholder; their author and moderators also get
+// the original content. See types.Redact.
+func postView(post models.PostWithStats, audience types.Audience) types.PostView {
+  var community *types.CommunitySummary
+  if post.CommunityID != nil && post.CommunitySlug != nil && post.CommunityName != nil {
+    community = &types.CommunitySummary{ID: *post.CommunityID, Slug: *post.CommunitySlug, Name: *post.CommunityName}
+  }
+  if post.DeletedAt != nil || post.RemovedAt != nil {
+    title := "[deleted]"
+    if post.DeletedAt == nil {
+      title = "[removed]"
+    }
+    return types.Redact(types.PostView{
       ID: post.ID,
-      Title: post.Title,
-      Body: post.Body,
+      Title: title,
       CreatedAt: post.CreatedAt,
-      Author: types.AuthorView{
-        ID: post.UserID,
-        Email: post.AuthorEmail,
-        Username: post.AuthorUsername,
-      },
       Score: post.Score,
+      Upvotes: post.Upvotes,
+      Downvotes: post.Downvotes,
       MyVote: post.MyVote,
-    })
+      CommentCount: post.CommentCount,
+      Community: community,
+      Deleted: post.DeletedAt != nil,
+      Removed: post.RemovedAt != nil,
+      Locked: post.LockedAt != nil,
+      Pinned: post.PinnedAt != nil,
+      Original: &types.PostContentView{
+        Title: post.Title,
+        Body: post.Body,
+        Author: types.AuthorView{ID: post.UserID, Username: post.AuthorUsername},
+      },
+    }, audience)
   }
-
-  response.WriteJSON(w, http.StatusOK, views)
+  return types.Redact(types.PostView{
+    ID: post.ID,
+    Title: post.Title,
+    Body: post.Body,
+    CreatedAt: post.CreatedAt,
+    Author: types.AuthorView{
+      ID: post.UserID,
+      Username: post.AuthorUsername,
+    },
+    Score: post.Score,
+    Upvotes: post.Upvotes,
+    Downvotes: post.Downvotes,
+    MyVote: post.MyVote,
+    CommentCount: post.CommentCount,
+    Community: community,
+    EditedAt: post.EditedAt,
+    Locked: post.LockedAt != nil,
+    Pinned: post.PinnedAt != nil,
+  }, audience)
 }
 
+// HandleVote sets or, with value 0, clears the caller's vote and replies
+// with the post's tally as of that change.
 func (h *Handler) HandleVote(w http.ResponseWriter, r *http.Request) {
   user, ok := requestctx.AuthUserFromContext(r.Context())
   if !ok {
@@ -99,36 +334,73 @@ func (h *Handler) HandleVote(w http.ResponseWriter, r *http.Request) {
     return
   }
 
-  postID := strings.TrimSpace(chi.URLParam(r, "postID"))
-  if postID == "" {
-    response.WriteError(w, http.StatusBadRequest, "invalid_post")
-    return
-  }
-
   var req types.VoteRequest
   if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
     response.WriteError(w, http.StatusBadRequest, "invalid_json")
     return
   }
-
-  if req.Value == 0 {
-    if err := h.store.Votes.DeleteVote(r.Context(), postID, user.ID); err != nil {
-      response.WriteError(w, http.StatusInternalServerError, "vote_failed")
-      return
-    }
-    response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+  if req.Value < -1 || req.Value > 1 {
+    response.WriteError(w, http.StatusBadRequest, "invalid_vote")
     return
   }
 
-  if req.Value != 1 && req.Value != -1 {
-    response.WriteError(w, http.StatusBadRequest, "invalid_vote")
+  // Posts in private communities the voter can't see answer like missing
+  // ones, so the vote and its tally don't reveal them.
+  post, ok := h.loadVisiblePost(w, r)
+  if !ok {
+    return
+  }
+  if post.DeletedAt != nil || post.RemovedAt != nil {
+    response.WriteError(w, http.StatusNotFound, "post_not_found")
+    return
+  }
+  if !h.checkCommunityBan(w, r, user.ID, post.CommunityID) {
     return
   }
 
-  if err := h.store.Votes.UpsertVote(r.Context(), postID, user.ID, req.Value); err != nil {
+  var tally models.VoteTally
+  var err error
+  if req.Value == 0 {
+    tally, err = h.store.Votes.DeleteVote(r.Context(), post.ID, user.ID)
+  } else {
+    tally, err = h.store.Votes.UpsertVote(r.Context(), post.ID, user.ID, req.Value)
+  }
+  if err != nil {
+    var pgErr *pgconn.PgError
+    // The post can disappear between the lookup and the vote.
+    if errors.Is(err, store.ErrNotFound) || (errors.As(err, &pgErr) && pgErr.Code == "23503") {
+      response.WriteError(w, http.StatusNotFound, "post_not_found")
+      return
+    }
     response.WriteError(w, http.StatusInternalServerError, "vote_failed")
     return
   }
 
-  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+  response.WriteJSON(w, http.StatusOK, types.VoteResponse{
+    Score:     tally.Score,
+    Upvotes:   tally.Upvotes,
+    Downvotes: tally.Downvotes,
+    MyVote:    tally.MyVote,
+  })
+}
+
+// isUUID reports whether s is a UUID in its canonical hyphenated form, so
+// that malformed IDs are rejected before they reach Postgres.
+func isUUID(s string) bool {
+  if len(s) != 36 {
+    return false
+  }
+  for i, c := range s {
+    switch i {
+    case 8, 13, 18, 23:
+      if c != '-' {
+        return false
+      }
+    default:
+      if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+        return false
+      }
+    }
+  }
+  return true
 }
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+  "errors"
+  "net/http"
+  "net/url"
+  "strings"
+  "time"
+
+  "github.com/go-chi/chi/v5"
+
+  "jabber_v3/apps/api/internal/http/cursor"
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+type profilePosition struct {
+  ID        string    `json:"id"`
+  CreatedAt time.Time `json:"t"`
+}
+
+func (h *Handler) HandleGetProfile(w http.ResponseWriter, r *http.Request) {
+  profile, ok := h.loadProfile(w, r)
+  if !ok {
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, types.ProfileView{
+    ID:           profile.ID,
+    Username:     profile.Username,
+    DisplayName:  profile.DisplayName,
+    Bio:          profile.Bio,
+    AvatarURL:    profile.AvatarURL,
+    CreatedAt:    profile.CreatedAt,
+    Karma:        profile.PostKarma + profile.CommentKarma,
+    PostKarma:    profile.PostKarma,
+    CommentKarma: profile.CommentKarma,
+  })
+}
+
+func (h *Handler) HandleListUserPosts(w http.ResponseWriter, r *http.Request) {
+  limit, after, ok := profilePageParams(w, r.URL.Query())
+  if !ok {
+    return
+  }
+  profile, ok := h.loadProfile(w, r)
+  if !ok {
+    return
+  }
+
+  posts, err := h.store.Users.ListUserPosts(r.Context(), profile.ID, viewerIDFromContext(r), after, limit+1)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  var nextCursor *string
+  if len(posts) > limit {
+    posts = posts[:limit]
+    last := posts[len(posts)-1]
+    if nextCursor, ok = encodeProfileCursor(w, last.ID, last.CreatedAt); !ok {
+      return
+    }
+  }
+
+  viewer, err := h.loadViewerAudience(r)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  views := make([]types.PostView, 0, len(posts))
+  for _, post := range posts {
+    views = append(views, postView(post, viewer.of(post.UserID, post.CommunityID)))
+  }
+  response.WriteJSON(w, http.StatusOK, types.FeedResponse{Posts: views, NextCursor: nextCursor})
+}
+
+func (h *Handler) HandleListUserComments(w http.ResponseWriter, r *http.Request) {
+  limit, after, ok := profilePageParams(w, r.URL.Query())
+  if !ok {
+    return
+  }
+  profile, ok := h.loadProfile(w, r)
+  if !ok {
+    return
+  }
+
+  comments, err := h.store.Users.ListUserComments(r.Context(), profile.ID, viewerIDFromContext(r), after, limit+1)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  var nextCursor *string
+  if len(comments) > limit {
+    comments = comments[:limit]
+    last := comments[len(comments)-1]
+    if nextCursor, ok = encodeProfileCursor(w, last.ID, last.CreatedAt); !ok {
+      return
+    }
+  }
+
+  viewer, err := h.loadViewerAudience(r)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  views := make([]types.ProfileCommentView, 0, len(comments))
+  for _, comment := range comments {
+    views = append(views, profileCommentView(comment, viewer.of(comment.UserID, comment.CommunityID)))
+  }
+  response.WriteJSON(w, http.StatusOK, types.ProfileCommentsResponse{Comments: views, NextCursor: nextCursor})
+}
+
+// HandleListUserVotes shows users the posts they voted on. Votes are
+// private, so it refuses to list anyone else's.
+func (h *Handler) HandleListUserVotes(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+  limit, after, ok := profilePageParams(w, r.URL.Query())
+  if !ok {
+    return
+  }
+  profile, ok := h.loadProfile(w, r)
+  if !ok {
+    return
+  }
+  if profile.ID != user.ID {
+    response.WriteError(w, http.StatusForbidden, "forbidden")
+    return
+  }
+
+  posts, err := h.store.Users.ListVotedPosts(r.Context(), user.ID, after, limit+1)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  var nextCursor *string
+  if len(posts) > limit {
+    posts = posts[:limit]
+    last := posts[len(posts)-1]
+    if nextCursor, ok = encodeProfileCursor(w, last.ID, last.VotedAt); !ok {
+      return
+    }
+  }
+
+  viewer, err := h.loadViewerAudience(r)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  views := make([]types.VotedPostView, 0, len(posts))
+  for _, post := range posts {
+    views = append(views, types.VotedPostView{
+      Post:    postView(post.PostWithStats, viewer.of(post.UserID, post.CommunityID)),
+      Value:   post.MyVote,
+      VotedAt: post.VotedAt,
+    })
+  }
+  response.WriteJSON(w, http.StatusOK, types.VotesResponse{Votes: views, NextCursor: nextCursor})
+}
+
+// loadProfile resolves the {username} route param, writing the error
+// response itself when that fails.
+func (h *Handler) loadProfile(w http.ResponseWriter, r *http.Request) (models.UserProfile, bool) {
+  username := normalizeUsername(chi.URLParam(r, "username"))
+  if username == "" {
+    response.WriteError(w, http.StatusNotFound, "user_not_found")
+    return models.UserProfile{}, false
+  }
+
+  profile, err := h.store.Users.GetProfile(r.Context(), username)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "user_not_found")
+      return models.UserProfile{}, false
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return models.UserProfile{}, false
+  }
+  return profile, true
+}
+
+func profilePageParams(w http.ResponseWriter, query url.Values) (int, *store.ProfileCursor, bool) {
+  limit, ok := intQueryParam(query.Get("limit"), defaultFeedLimit, maxFeedLimit)
+  if !ok || limit == 0 {
+    response.WriteError(w, http.StatusBadRequest, "invalid_limit")
+    return 0, nil, false
+  }
+
+  raw := strings.TrimSpace(query.Get("after"))
+  if raw == "" {
+    return limit, nil, true
+  }
+  var pos profilePosition
+  if err := cursor.Decode(raw, &pos); err != nil || !isUUID(pos.ID) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_cursor")
+    return 0, nil, false
+  }
+  return limit, &store.ProfileCursor{ID: pos.ID, CreatedAt: pos.CreatedAt}, true
+}
+
+func encodeProfileCursor(w http.ResponseWriter, id string, createdAt time.Time) (*string, bool) {
+  token, err := cursor.Encode(profilePosition{ID: id, CreatedAt: createdAt})
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return nil, false
+  }
+  return &token, true
+}
+
+// profileCommentView renders comment for audience. Moderators still see
+// the title of the post it was made on after the post is deleted or
+// removed.
+func profileCommentView(comment models.ProfileComment, audience types.Audience) types.ProfileCommentView {
+  postTitle := comment.PostTitle
+  if audience&types.AudienceModerator == 0 {
+    if comment.PostDeleted {
+      postTitle = "[deleted]"
+    } else if comment.PostRemoved {
+      postTitle = "[removed]"
+    }
+  }
+  var community *types.CommunitySummary
+  if comment.CommunityID != nil && comment.CommunitySlug != nil && comment.CommunityName != nil {
+    community = &types.CommunitySummary{ID: *comment.CommunityID, Slug: *comment.CommunitySlug, Name: *comment.CommunityName}
+  }
+  return types.Redact(types.ProfileCommentView{
+    ID:        comment.ID,
+    PostID:    comment.PostID,
+    PostTitle: postTitle,
+    ParentID:  comment.ParentID,
+    Body:      comment.Body,
+    CreatedAt: comment.CreatedAt,
+    Community: community,
+  }, audience)
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+  "encoding/json"
+  "errors"
+  "net/http"
+  "strings"
+
+  "github.com/go-chi/chi/v5"
+
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+func (h *Handler) HandleUpdatePost(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  post, ok := h.loadOwnPost(w, r, user.ID)
+  if !ok {
+    return
+  }
+
+  var req types.UpdatePostRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  title := post.Title
+  if req.Title != nil {
+    title = strings.TrimSpace(*req.Title)
+  }
+  body := post.Body
+  if req.Body != nil {
+    body = strings.TrimSpace(*req.Body)
+  }
+  if title == "" || body == "" {
+    response.WriteError(w, http.StatusBadRequest, "invalid_post")
+    return
+  }
+  if title == post.Title && body == post.Body {
+    response.WriteError(w, http.StatusBadRequest, "no_changes")
+    return
+  }
+
+  if _, err := h.store.Posts.UpdatePost(r.Context(), post.ID, title, body); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "post_not_found")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "update_failed")
+    return
+  }
+
+  updated, err := h.store.Posts.GetPostWithStats(r.Context(), post.ID, &user.ID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  viewer, err := h.loadViewerAudience(r)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+  response.WriteJSON(w, http.StatusOK, postView(updated, viewer.of(updated.UserID, updated.CommunityID)))
+}
+
+func (h *Handler) HandleDeletePost(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  post, ok := h.loadOwnPost(w, r, user.ID)
+  if !ok {
+    return
+  }
+
+  if err := h.store.Posts.SoftDeletePost(r.Context(), post.ID); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "post_not_found")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "delete_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) HandleListRevisions(w http.ResponseWriter, r *http.Request) {
+  post, ok := h.loadVisiblePost(w, r)
+  if !ok {
+    return
+  }
+  // The history of a deleted or removed post is as gone as the post,
+  // except to the moderators reviewing it.
+  if post.DeletedAt != nil || post.RemovedAt != nil {
+    moderator, err := h.viewerCanModerate(r, post.CommunityID)
+    if err != nil {
+      response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+      return
+    }
+    if !moderator {
+      response.WriteError(w, http.StatusNotFound, "post_not_found")
+      return
+    }
+  }
+
+  revisions, err := h.store.Posts.ListRevisions(r.Context(), post.ID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  views := make([]types.PostRevisionView, 0, len(revisions))
+  for _, revision := range revisions {
+    views = append(views, types.PostRevisionView{
+      ID:        revision.ID,
+      Title:     revision.Title,
+      Body:      revision.Body,
+      CreatedAt: revision.CreatedAt,
+    })
+  }
+
+  response.WriteJSON(w, http.StatusOK, views)
+}
+
+// loadOwnPost resolves the {postID} route param to a live post authored by
+// userID, writing the error response itself when that fails.
+func (h *Handler) loadOwnPost(w http.ResponseWriter, r *http.Request, userID string) (models.Post, bool) {
+  postID := strings.TrimSpace(chi.URLParam(r, "postID"))
+  if !isUUID(postID) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_post")
+    return models.Post{}, false
+  }
+
+  post, err := h.store.Posts.GetPostByID(r.Context(), postID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "post_not_found")
+      return models.Post{}, false
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return models.Post{}, false
+  }
+  if post.DeletedAt != nil || post.RemovedAt != nil {
+    response.WriteError(w, http.StatusNotFound, "post_not_found")
+    return models.Post{}, false
+  }
+  if post.UserID != userID {
+    response.WriteError(w, http.StatusForbidden, "forbidden")
+    return models.Post{}, false
+  }
+  return post, true
+}
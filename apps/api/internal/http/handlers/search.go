@@ -0,0 +1,156 @@
+package handlers
+
+import (
+  "errors"
+  "net/http"
+  "strings"
+  "time"
+
+  "jabber_v3/apps/api/internal/http/cursor"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+const (
+  defaultSearchLimit = 20
+  maxSearchLimit     = 50
+  maxSearchQueryLen  = 256
+)
+
+type searchPosition struct {
+  Rank float64 `json:"r"`
+  ID   string  `json:"id"`
+}
+
+func (h *Handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+  query := r.URL.Query()
+  opts := store.SearchOptions{
+    Query:    strings.TrimSpace(query.Get("q")),
+    Type:     strings.ToLower(strings.TrimSpace(query.Get("type"))),
+    ViewerID: viewerIDFromContext(r),
+  }
+  if opts.Query == "" || len(opts.Query) > maxSearchQueryLen {
+    response.WriteError(w, http.StatusBadRequest, "invalid_query")
+    return
+  }
+  switch opts.Type {
+  case "":
+    opts.Type = store.SearchTypeAll
+  case store.SearchTypeAll, store.SearchTypePosts, store.SearchTypeComments:
+  default:
+    response.WriteError(w, http.StatusBadRequest, "invalid_type")
+    return
+  }
+
+  limit, ok := intQueryParam(query.Get("limit"), defaultSearchLimit, maxSearchLimit)
+  if !ok || limit == 0 {
+    response.WriteError(w, http.StatusBadRequest, "invalid_limit")
+    return
+  }
+  opts.Limit = limit + 1
+
+  var err error
+  if opts.Since, err = parseDateParam(query.Get("from"), false); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_from")
+    return
+  }
+  if opts.Until, err = parseDateParam(query.Get("to"), true); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_to")
+    return
+  }
+
+  if raw := strings.TrimSpace(query.Get("after")); raw != "" {
+    var pos searchPosition
+    if err := cursor.Decode(raw, &pos); err != nil || !isUUID(pos.ID) {
+      response.WriteError(w, http.StatusBadRequest, "invalid_cursor")
+      return
+    }
+    opts.After = &store.SearchCursor{Rank: pos.Rank, ID: pos.ID}
+  }
+
+  if username := normalizeUsername(query.Get("author")); username != "" {
+    author, err := h.store.Users.GetUserByUsername(r.Context(), username)
+    if err != nil {
+      if errors.Is(err, store.ErrNotFound) {
+        response.WriteJSON(w, http.StatusOK, types.SearchResponse{Results: []types.SearchResultView{}})
+        return
+      }
+      response.WriteError(w, http.StatusInternalServerError, "search_failed")
+      return
+    }
+    opts.AuthorID = &author.ID
+  }
+
+  if slug := strings.ToLower(strings.TrimSpace(query.Get("community"))); slug != "" {
+    community, err := h.store.Communities.GetCommunityWithStats(r.Context(), slug, opts.ViewerID)
+    if err != nil && !errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusInternalServerError, "search_failed")
+      return
+    }
+    if err != nil || (community.Visibility == models.CommunityPrivate && community.ViewerRole == nil) {
+      response.WriteError(w, http.StatusNotFound, "community_not_found")
+      return
+    }
+    opts.CommunityID = &community.ID
+  }
+
+  results, err := h.store.Search.Search(r.Context(), opts)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "search_failed")
+    return
+  }
+
+  var nextCursor *string
+  if len(results) > limit {
+    results = results[:limit]
+    last := results[len(results)-1]
+    token, err := cursor.Encode(searchPosition{Rank: last.Rank, ID: last.ID})
+    if err != nil {
+      response.WriteError(w, http.StatusInternalServerError, "search_failed")
+      return
+    }
+    nextCursor = &token
+  }
+
+  views := make([]types.SearchResultView, 0, len(results))
+  for _, result := range results {
+    view := types.SearchResultView{
+      Type:      result.Kind,
+      ID:        result.ID,
+      PostID:    result.PostID,
+      Title:     result.Title,
+      Snippet:   result.Snippet,
+      Rank:      result.Rank,
+      CreatedAt: result.CreatedAt,
+      Author:    types.AuthorView{ID: result.UserID, Username: result.AuthorUsername},
+    }
+    if result.CommunityID != nil && result.CommunitySlug != nil && result.CommunityName != nil {
+      view.Community = &types.CommunitySummary{ID: *result.CommunityID, Slug: *result.CommunitySlug, Name: *result.CommunityName}
+    }
+    views = append(views, view)
+  }
+
+  response.WriteJSON(w, http.StatusOK, types.SearchResponse{Results: views, NextCursor: nextCursor})
+}
+
+// parseDateParam accepts RFC 3339 timestamps or plain dates. A plain date
+// used as an upper bound covers that whole day.
+func parseDateParam(raw string, endOfDay bool) (*time.Time, error) {
+  raw = strings.TrimSpace(raw)
+  if raw == "" {
+    return nil, nil
+  }
+  if value, err := time.Parse(time.RFC3339, raw); err == nil {
+    return &value, nil
+  }
+  value, err := time.Parse(time.DateOnly, raw)
+  if err != nil {
+    return nil, err
+  }
+  if endOfDay {
+    value = value.AddDate(0, 0, 1)
+  }
+  return &value, nil
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+  "encoding/json"
+  "errors"
+  "net"
+  "net/http"
+  "strings"
+  "time"
+
+  "github.com/go-chi/chi/v5"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+const maxUserAgentLen = 512
+
+// startSession signs the user in on a new session and writes the tokens.
+func (h *Handler) startSession(w http.ResponseWriter, r *http.Request, user models.User, status int) {
+  // Signing in during the grace period keeps the account.
+  if user.DeleteAfter != nil {
+    if err := h.store.Users.CancelDeletion(r.Context(), user.ID); err != nil {
+      response.WriteError(w, http.StatusInternalServerError, "session_failed")
+      return
+    }
+    user.DeleteAfter = nil
+  }
+
+  refreshToken, refreshHash, err := auth.NewToken()
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "token_failed")
+    return
+  }
+
+  session, err := h.store.Sessions.CreateSession(r.Context(), user.ID, userAgent(r), h.clientIP(r), refreshHash, time.Now().Add(auth.RefreshTokenTTL))
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "session_failed")
+    return
+  }
+
+  tokens, err := h.issueTokens(user.ID, session.ID, refreshToken)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "token_failed")
+    return
+  }
+
+  // The request may not be authenticated yet, but the response goes to
+  // the user who just signed in.
+  response.WriteJSON(w, status, types.AuthResponse{
+    TokenResponse: tokens,
+    User:          userView(user, types.AudienceSelf),
+  })
+}
+
+func (h *Handler) issueTokens(userID string, sessionID string, refreshToken string) (types.TokenResponse, error) {
+  expiresAt := time.Now().Add(h.jwt.TTL)
+  token, err := h.jwt.Generate(userID, sessionID)
+  if err != nil {
+    return types.TokenResponse{}, err
+  }
+  return types.TokenResponse{Token: token, RefreshToken: refreshToken, ExpiresAt: expiresAt}, nil
+}
+
+func (h *Handler) HandleRefresh(w http.ResponseWriter, r *http.Request) {
+  var req types.RefreshRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+  if req.RefreshToken == "" {
+    response.WriteError(w, http.StatusBadRequest, "invalid_refresh_token")
+    return
+  }
+
+  refreshToken, refreshHash, err := auth.NewToken()
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "token_failed")
+    return
+  }
+
+  session, err := h.store.Sessions.RotateRefreshToken(
+    r.Context(),
+    auth.HashToken(req.RefreshToken),
+    refreshHash,
+    userAgent(r),
+    h.clientIP(r),
+    time.Now().Add(auth.RefreshTokenTTL),
+  )
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusUnauthorized, "invalid_refresh_token")
+      return
+    }
+    if errors.Is(err, store.ErrRefreshTokenReused) {
+      response.WriteError(w, http.StatusUnauthorized, "refresh_token_reused")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "refresh_failed")
+    return
+  }
+
+  tokens, err := h.issueTokens(session.UserID, session.ID, refreshToken)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "token_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, tokens)
+}
+
+func (h *Handler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  if err := h.store.Sessions.RevokeSession(r.Context(), user.ID, user.SessionID); err != nil && !errors.Is(err, store.ErrNotFound) {
+    response.WriteError(w, http.StatusInternalServerError, "logout_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Handler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  sessions, err := h.store.Sessions.ListActiveSessions(r.Context(), user.ID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  views := make([]types.SessionView, 0, len(sessions))
+  for _, session := range sessions {
+    views = append(views, types.SessionView{
+      ID:         session.ID,
+      UserAgent:  session.UserAgent,
+      IP:         session.IP,
+      CreatedAt:  session.CreatedAt,
+      LastSeenAt: session.LastSeenAt,
+      ExpiresAt:  session.ExpiresAt,
+      Current:    session.ID == user.SessionID,
+    })
+  }
+
+  response.WriteJSON(w, http.StatusOK, views)
+}
+
+func (h *Handler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  sessionID := strings.TrimSpace(chi.URLParam(r, "sessionID"))
+  if !isUUID(sessionID) {
+    response.WriteError(w, http.StatusBadRequest, "invalid_session")
+    return
+  }
+
+  if err := h.store.Sessions.RevokeSession(r.Context(), user.ID, sessionID); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusNotFound, "session_not_found")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "revoke_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleRevokeOtherSessions signs out every device except the caller's.
+func (h *Handler) HandleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  revoked, err := h.store.Sessions.RevokeOtherSessions(r.Context(), user.ID, user.SessionID)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "revoke_failed")
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]int64{"revoked": revoked})
+}
+
+func userAgent(r *http.Request) string {
+  agent := strings.TrimSpace(r.UserAgent())
+  if len(agent) > maxUserAgentLen {
+    agent = agent[:maxUserAgentLen]
+  }
+  return agent
+}
+
+// clientIP is the address of the client. Without trusted proxies it is the
+// direct peer. Behind Config.TrustedProxyHops proxies it is read from
+// X-Forwarded-For, counting that many addresses back from the peer, since
+// anything further left is whatever the client sent. It is empty when the
+// header is too short to hold the client.
+func (h *Handler) clientIP(r *http.Request) string {
+  peer, _, err := net.SplitHostPort(r.RemoteAddr)
+  if err != nil {
+    peer = r.RemoteAddr
+  }
+  if h.cfg.TrustedProxyHops <= 0 {
+    return peer
+  }
+
+  var chain []string
+  for _, header := range r.Header.Values("X-Forwarded-For") {
+    for _, addr := range strings.Split(header, ",") {
+      chain = append(chain, strings.TrimSpace(addr))
+    }
+  }
+  chain = append(chain, peer)
+  i := len(chain) - 1 - h.cfg.TrustedProxyHops
+  if i < 0 || net.ParseIP(chain[i]) == nil {
+    return ""
+  }
+  return chain[i]
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+  "net/http/httptest"
+  "testing"
+)
+
+func TestClientIP(t *testing.T) {
+  cases := []struct {
+    name      string
+    hops      int
+    forwarded []string
+    want      string
+  }{
+    {"direct peer", 0, nil, "10.0.0.1"},
+    {"headers ignored without proxies", 0, []string{"203.0.113.7"}, "10.0.0.1"},
+    {"one proxy", 1, []string{"203.0.113.7"}, "203.0.113.7"},
+    {"spoofed entries are skipped", 1, []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+    {"repeated headers", 2, []string{"198.51.100.1", "203.0.113.7, 192.0.2.9"}, "203.0.113.7"},
+    {"header missing", 1, nil, ""},
+    {"header too short", 2, []string{"203.0.113.7"}, ""},
+    {"not an address", 1, []string{"unknown"}, ""},
+  }
+  for _, tc := range cases {
+    t.Run(tc.name, func(t *testing.T) {
+      h := &Handler{cfg: Config{TrustedProxyHops: tc.hops}}
+      r := httptest.NewRequest("POST", "/api/v1/auth/login", nil)
+      r.RemoteAddr = "10.0.0.1:4321"
+      for _, value := range tc.forwarded {
+        r.Header.Add("X-Forwarded-For", value)
+      }
+      if got := h.clientIP(r); got != tc.want {
+        t.Errorf("clientIP = %q, want %q", got, tc.want)
+      }
+    })
+  }
+}
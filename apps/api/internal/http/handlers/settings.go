@@ -0,0 +1,405 @@
+package handlers
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "log"
+  "net/http"
+  "net/url"
+  "strings"
+  "time"
+  "unicode"
+  "unicode/utf8"
+
+  "github.com/jackc/pgx/v5/pgconn"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/mail"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+const (
+  usernameChangeCooldown = 30 * 24 * time.Hour
+  emailChangeTTL         = 24 * time.Hour
+  accountDeletionGrace   = 14 * 24 * time.Hour
+  minUsernameLen         = 3
+  maxUsernameLen         = 30
+  maxDisplayNameLen      = 50
+  maxBioLen              = 500
+  maxAvatarURLLen        = 2048
+)
+
+// reservedUsernames could be mistaken for staff or collide with routes.
+var reservedUsernames = map[string]struct{}{
+  "admin": {}, "administrator": {}, "root": {}, "system": {}, "staff": {},
+  "mod": {}, "mods": {}, "moderator": {}, "moderators": {}, "support": {},
+  "help": {}, "security": {}, "abuse": {}, "official": {}, "foorum": {},
+  "api": {}, "www": {}, "mail": {}, "me": {}, "settings": {}, "login": {},
+  "logout": {}, "register": {}, "signup": {}, "deleted": {}, "removed": {},
+  "anonymous": {}, "null": {}, "undefined": {}, "nobody": {}, "everyone": {},
+}
+
+// validateUsername returns the problems with a normalized username.
+func validateUsername(username string) []string {
+  if username == "" {
+    return []string{"required"}
+  }
+  if len(username) < minUsernameLen || len(username) > maxUsernameLen {
+    return []string{"invalid_length"}
+  }
+  for _, c := range username {
+    if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' || c == '-' || c == '.') {
+      return []string{"invalid_characters"}
+    }
+  }
+  if _, ok := reservedUsernames[username]; ok {
+    return []string{"reserved"}
+  }
+  return nil
+}
+
+// HandleUpdateMe changes the username and profile. A user can rename once
+// per usernameChangeCooldown.
+func (h *Handler) HandleUpdateMe(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  var req types.UpdateMeRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  record, err := h.store.Users.GetUserByID(r.Context(), user.ID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  rename := req.Username != nil && normalizeUsername(*req.Username) != record.Username
+  username := record.Username
+  if rename {
+    username = normalizeUsername(*req.Username)
+  }
+  displayName, bio, avatarURL := record.DisplayName, record.Bio, record.AvatarURL
+  if req.DisplayName != nil {
+    displayName = strings.TrimSpace(*req.DisplayName)
+  }
+  if req.Bio != nil {
+    bio = strings.TrimSpace(*req.Bio)
+  }
+  if req.AvatarURL != nil {
+    avatarURL = strings.TrimSpace(*req.AvatarURL)
+  }
+
+  fields := validateProfile(displayName, bio, avatarURL)
+  if rename {
+    if problems := validateUsername(username); len(problems) > 0 {
+      fields["username"] = problems
+    }
+  }
+  if len(fields) > 0 {
+    response.WriteFieldErrors(w, fields)
+    return
+  }
+  if rename && record.UsernameChangedAt != nil && time.Since(*record.UsernameChangedAt) < usernameChangeCooldown {
+    writeUsernameCooldown(w, *record.UsernameChangedAt)
+    return
+  }
+
+  if !rename {
+    if displayName != record.DisplayName || bio != record.Bio || avatarURL != record.AvatarURL {
+      record, err = h.store.Users.UpdateProfile(r.Context(), record.ID, displayName, bio, avatarURL)
+      if err != nil {
+        response.WriteError(w, http.StatusInternalServerError, "update_failed")
+        return
+      }
+    }
+    response.WriteJSON(w, http.StatusOK, userView(record, accountAudience(r, record.ID)))
+    return
+  }
+
+  // The profile goes in with the rename, so a taken username or a rename
+  // racing this one leaves both unchanged.
+  updated, err := h.store.Users.UpdateProfileAndUsername(r.Context(), record.ID, displayName, bio, avatarURL, username, time.Now().Add(-usernameChangeCooldown))
+  if err != nil {
+    var pgErr *pgconn.PgError
+    switch {
+    case errors.Is(err, store.ErrNotFound):
+      // Another request renamed the user in the meantime.
+      writeUsernameCooldown(w, time.Now())
+    case errors.As(err, &pgErr) && pgErr.Code == "23505":
+      response.WriteError(w, http.StatusConflict, "username_taken")
+    default:
+      response.WriteError(w, http.StatusInternalServerError, "update_failed")
+    }
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, userView(updated, accountAudience(r, updated.ID)))
+}
+
+// validateProfile returns the problems with the public profile fields by
+// field name.
+func validateProfile(displayName string, bio string, avatarURL string) map[string][]string {
+  fields := make(map[string][]string)
+  if utf8.RuneCountInString(displayName) > maxDisplayNameLen {
+    fields["displayName"] = []string{"too_long"}
+  } else if strings.IndexFunc(displayName, unicode.IsControl) >= 0 {
+    fields["displayName"] = []string{"invalid_characters"}
+  }
+  if utf8.RuneCountInString(bio) > maxBioLen {
+    fields["bio"] = []string{"too_long"}
+  }
+  if avatarURL != "" {
+    // Avatars are loaded by every visitor's browser, so only absolute
+    // https URLs are accepted.
+    parsed, err := url.Parse(avatarURL)
+    if len(avatarURL) > maxAvatarURLLen || err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+      fields["avatarUrl"] = []string{"invalid"}
+    }
+  }
+  return fields
+}
+
+func writeUsernameCooldown(w http.ResponseWriter, changedAt time.Time) {
+  response.WriteJSON(w, http.StatusConflict, map[string]any{
+    "error":       "username_change_cooldown",
+    "availableAt": changedAt.Add(usernameChangeCooldown),
+  })
+}
+
+// HandleChangePassword sets a new password after checking the current one
+// and signs out every other session.
+func (h *Handler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  var req types.ChangePasswordRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  record, ok := h.reauthenticate(w, r, user.ID, req.CurrentPassword)
+  if !ok {
+    return
+  }
+  if problems := h.checkPasswordPolicy(req.NewPassword, record.Username, record.Email); len(problems) > 0 {
+    response.WriteFieldErrors(w, map[string][]string{"newPassword": problems})
+    return
+  }
+
+  hash, err := h.cfg.Passwords.Hash(req.NewPassword)
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "hash_failed")
+    return
+  }
+  if err := h.store.Users.ChangePassword(r.Context(), record.ID, hash, user.SessionID); err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "update_failed")
+    return
+  }
+
+  h.sendMail(mail.Message{
+    To:      record.Email,
+    Subject: "Your password was changed",
+    Body: fmt.Sprintf(
+      "Hi %s,\n\nThe password for your account was just changed and your other sessions were signed out.\n\n"+
+        "If this wasn't you, reset your password right away.\n",
+      record.Username,
+    ),
+  })
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleChangeEmail mails a confirmation link to the new address. The
+// account keeps its current address until the link is used.
+func (h *Handler) HandleChangeEmail(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  var req types.ChangeEmailRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  email := normalizeEmail(req.Email)
+  if email == "" || !strings.Contains(email, "@") {
+    response.WriteFieldErrors(w, map[string][]string{"email": {"invalid"}})
+    return
+  }
+
+  record, ok := h.reauthenticate(w, r, user.ID, req.Password)
+  if !ok {
+    return
+  }
+  if email == record.Email {
+    response.WriteFieldErrors(w, map[string][]string{"email": {"unchanged"}})
+    return
+  }
+  if _, err := h.store.Users.GetUserByEmail(r.Context(), email); err == nil {
+    response.WriteError(w, http.StatusConflict, "email_taken")
+    return
+  } else if !errors.Is(err, store.ErrNotFound) {
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return
+  }
+
+  token, hash, err := auth.NewToken()
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "token_failed")
+    return
+  }
+  if err := h.store.AccountTokens.CreateEmailChangeToken(r.Context(), record.ID, email, hash, time.Now().Add(emailChangeTTL)); err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "token_failed")
+    return
+  }
+
+  h.sendMail(mail.Message{
+    To:      email,
+    Subject: "Confirm your new email address",
+    Body: fmt.Sprintf(
+      "Hi %s,\n\nConfirm that this is your new email address by opening this link:\n%s\n",
+      record.Username,
+      h.appLink("/confirm-email", token),
+    ),
+  })
+  h.sendMail(mail.Message{
+    To:      record.Email,
+    Subject: "Email change requested",
+    Body: fmt.Sprintf(
+      "Hi %s,\n\nSomeone asked to move your account to %s. Nothing changes until the new address is confirmed.\n\n"+
+        "If this wasn't you, change your password.\n",
+      record.Username,
+      email,
+    ),
+  })
+  response.WriteJSON(w, http.StatusAccepted, map[string]string{"status": "ok"})
+}
+
+// HandleConfirmEmailChange redeems the link mailed by HandleChangeEmail. It
+// needs no session since the link may be opened on another device.
+func (h *Handler) HandleConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+  var req types.VerifyEmailRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  token := strings.TrimSpace(req.Token)
+  if token == "" {
+    response.WriteError(w, http.StatusBadRequest, "invalid_token")
+    return
+  }
+
+  if _, _, err := h.store.AccountTokens.ChangeEmail(r.Context(), auth.HashToken(token)); err != nil {
+    var pgErr *pgconn.PgError
+    switch {
+    case errors.Is(err, store.ErrNotFound):
+      response.WriteError(w, http.StatusBadRequest, "invalid_token")
+    case errors.As(err, &pgErr) && pgErr.Code == "23505":
+      response.WriteError(w, http.StatusConflict, "email_taken")
+    default:
+      response.WriteError(w, http.StatusInternalServerError, "update_failed")
+    }
+    return
+  }
+
+  response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleDeleteAccount schedules the account for deletion after
+// accountDeletionGrace and signs it out everywhere. Signing in again before
+// then cancels the deletion.
+func (h *Handler) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+    return
+  }
+
+  var req types.DeleteAccountRequest
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    response.WriteError(w, http.StatusBadRequest, "invalid_json")
+    return
+  }
+
+  record, ok := h.reauthenticate(w, r, user.ID, req.Password)
+  if !ok {
+    return
+  }
+
+  deleteAfter := time.Now().Add(accountDeletionGrace)
+  if err := h.store.Users.ScheduleDeletion(r.Context(), record.ID, deleteAfter); err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+      return
+    }
+    response.WriteError(w, http.StatusInternalServerError, "delete_failed")
+    return
+  }
+
+  h.sendMail(mail.Message{
+    To:      record.Email,
+    Subject: "Your account will be deleted",
+    Body: fmt.Sprintf(
+      "Hi %s,\n\nYour account is scheduled for deletion on %s. Your posts and comments will stay up as [deleted].\n\n"+
+        "Changed your mind? Sign in before then and the deletion is cancelled.\n",
+      record.Username,
+      deleteAfter.UTC().Format("2 January 2006"),
+    ),
+  })
+  response.WriteJSON(w, http.StatusAccepted, types.DeleteAccountResponse{DeleteAfter: deleteAfter})
+}
+
+// reauthenticate checks the current password before a sensitive change.
+// Wrong guesses count towards the login throttle like failed logins.
+func (h *Handler) reauthenticate(w http.ResponseWriter, r *http.Request, userID string, password string) (models.User, bool) {
+  record, err := h.store.Users.GetUserByID(r.Context(), userID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+      return models.User{}, false
+    }
+    response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+    return models.User{}, false
+  }
+  if record.PasswordHash == "" {
+    // Accounts created through single sign-on set a password with the
+    // reset flow first.
+    response.WriteError(w, http.StatusConflict, "password_not_set")
+    return models.User{}, false
+  }
+  if !h.checkLoginThrottle(w, r, record.ID) {
+    return models.User{}, false
+  }
+
+  if _, err := h.cfg.Passwords.Verify(record.PasswordHash, password); err != nil {
+    if !errors.Is(err, auth.ErrPasswordMismatch) {
+      log.Printf("password check failed for %s: %v", record.ID, err)
+    }
+    h.recordLoginFailure(r, record.ID, &record)
+    response.WriteError(w, http.StatusUnauthorized, "invalid_password")
+    return models.User{}, false
+  }
+  return record, true
+}
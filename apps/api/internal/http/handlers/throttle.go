@@ -0,0 +1,84 @@
+package handlers
+
+import (
+  "fmt"
+  "log"
+  "math"
+  "net/http"
+  "strconv"
+  "strings"
+  "time"
+
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/mail"
+  "jabber_v3/apps/api/internal/models"
+)
+
+// loginAccount is the throttle key for a login attempt. Unknown identifiers
+// are throttled and locked like real accounts so that the responses do not
+// reveal which ones exist.
+func loginAccount(user *models.User, identifier string) string {
+  if user != nil {
+    return user.ID
+  }
+  return "unknown:" + strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// checkLoginThrottle answers 429 with a Retry-After header when the attempt
+// has to wait, and reports whether it may go ahead.
+func (h *Handler) checkLoginThrottle(w http.ResponseWriter, r *http.Request, account string) bool {
+  decision, err := h.cfg.LoginGuard.Check(r.Context(), account, h.clientIP(r))
+  if err != nil {
+    response.WriteError(w, http.StatusInternalServerError, "login_failed")
+    return false
+  }
+  if decision.Allowed() {
+    return true
+  }
+  w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+  if decision.Locked {
+    response.WriteError(w, http.StatusTooManyRequests, "account_locked")
+    return false
+  }
+  response.WriteError(w, http.StatusTooManyRequests, "too_many_attempts")
+  return false
+}
+
+// recordLoginFailure counts a failed attempt and tells the owner when it
+// locks their account. Errors are logged; the attempt has failed anyway.
+// Attempts without a known client IP only count against the account.
+func (h *Handler) recordLoginFailure(r *http.Request, account string, user *models.User) {
+  ip := h.clientIP(r)
+  locked, err := h.cfg.LoginGuard.Fail(r.Context(), account, ip)
+  if err != nil {
+    log.Printf("login throttle record failed for %s: %v", account, err)
+    return
+  }
+  if locked && user != nil {
+    h.sendLockoutEmail(*user, ip)
+  }
+}
+
+func (h *Handler) recordLoginSuccess(r *http.Request, account string) {
+  if err := h.cfg.LoginGuard.Succeed(r.Context(), account); err != nil {
+    log.Printf("login throttle reset failed for %s: %v", account, err)
+  }
+}
+
+func (h *Handler) sendLockoutEmail(user models.User, ip string) {
+  if ip == "" {
+    ip = "an unknown address"
+  }
+  h.sendMail(mail.Message{
+    To:      user.Email,
+    Subject: "Sign-in to your account was paused",
+    Body: fmt.Sprintf(
+      "Hi %s,\n\nWe paused sign-in to your account at %s after too many failed attempts, the last one from %s. "+
+        "You can try again later.\n\nIf this wasn't you, someone may be guessing your password. "+
+        "Consider changing it once you are back in, and turning on two-factor authentication.\n",
+      user.Username,
+      time.Now().UTC().Format(time.RFC1123),
+      ip,
+    ),
+  })
+}
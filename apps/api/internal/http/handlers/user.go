@@ -4,9 +4,11 @@ import (
   "errors"
   "net/http"
 
+  "jabber_v3/apps/api/internal/auth"
   "jabber_v3/apps/api/internal/http/requestctx"
   "jabber_v3/apps/api/internal/http/response"
   "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
   "jabber_v3/apps/api/internal/store"
 )
 
@@ -27,5 +29,80 @@ func (h *Handler) HandleMe(w http.ResponseWriter, r *http.Request) {
     return
   }
 
-  response.WriteJSON(w, http.StatusOK, types.UserView{ID: record.ID, Email: record.Email, Username: record.Username, CreatedAt: record.CreatedAt})
+  response.WriteJSON(w, http.StatusOK, userView(record, accountAudience(r, record.ID)))
+}
+
+// userView renders the account for audience; see types.Redact.
+func userView(user models.User, audience types.Audience) types.UserView {
+  emailVerified := user.EmailVerifiedAt != nil
+  twoFactor := user.TOTPEnabledAt != nil
+  updatedAt := user.UpdatedAt
+  return types.Redact(types.UserView{
+    ID:            user.ID,
+    Email:         user.Email,
+    Username:      user.Username,
+    Role:          user.Role,
+    EmailVerified: &emailVerified,
+    TwoFactor:     &twoFactor,
+    DisplayName:   user.DisplayName,
+    Bio:           user.Bio,
+    AvatarURL:     user.AvatarURL,
+    CreatedAt:     user.CreatedAt,
+    UpdatedAt:     &updatedAt,
+  }, audience)
+}
+
+// viewerAudience knows enough about the current viewer to tell which
+// types.Audience they are for each record in a response: who they are,
+// whether they are a site admin and which communities they moderate.
+type viewerAudience struct {
+  userID    string
+  admin     bool
+  moderates map[string]bool
+}
+
+// loadViewerAudience looks the viewer up once per response, so that long
+// lists don't cost a query per record.
+func (h *Handler) loadViewerAudience(r *http.Request) (viewerAudience, error) {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    return viewerAudience{}, nil
+  }
+  viewer := viewerAudience{userID: user.ID, admin: user.Role == auth.RoleAdmin}
+  if viewer.admin {
+    return viewer, nil
+  }
+  communityIDs, err := h.store.Communities.ListModeratedCommunityIDs(r.Context(), user.ID)
+  if err != nil {
+    return viewerAudience{}, err
+  }
+  viewer.moderates = make(map[string]bool, len(communityIDs))
+  for _, id := range communityIDs {
+    viewer.moderates[id] = true
+  }
+  return viewer, nil
+}
+
+// of is who the viewer is relative to a record owned by ownerID in the
+// given community; communityID is nil for site-wide records such as
+// accounts, which only site admins moderate.
+func (v viewerAudience) of(ownerID string, communityID *string) types.Audience {
+  audience := types.AudiencePublic
+  if v.userID != "" && v.userID == ownerID {
+    audience |= types.AudienceSelf
+  }
+  if v.admin || (communityID != nil && v.moderates[*communityID]) {
+    audience |= types.AudienceModerator
+  }
+  return audience
+}
+
+// accountAudience is who the viewer is relative to the account ownerID.
+// Unlike content, accounts have no community, so it needs no lookups.
+func accountAudience(r *http.Request, ownerID string) types.Audience {
+  user, ok := requestctx.AuthUserFromContext(r.Context())
+  if !ok {
+    return types.AudiencePublic
+  }
+  return viewerAudience{userID: user.ID, admin: user.Role == auth.RoleAdmin}.of(ownerID, nil)
 }
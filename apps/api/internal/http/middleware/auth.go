@@ -1,65 +1,166 @@
 package middleware
 
 import (
+  "context"
+  "errors"
+  "log"
   "net/http"
+  "slices"
   "strings"
+  "time"
 
   "jabber_v3/apps/api/internal/auth"
   "jabber_v3/apps/api/internal/http/requestctx"
   "jabber_v3/apps/api/internal/http/response"
   "jabber_v3/apps/api/internal/http/types"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
 )
 
-func Auth(jwt auth.JWTManager) func(http.Handler) http.Handler {
+var errUnauthenticated = errors.New("unauthenticated")
+
+// Auth requires a valid bearer token for an existing, unbanned account. The
+// token is either a session JWT or a personal access token; for a JWT the
+// session must still be active. Both are checked on every request so that
+// deleting or banning a user, signing out a session or revoking a token
+// takes effect immediately.
+//
+// Personal access tokens are only accepted for read-only requests, with the
+// read scope. Use AuthScope on routes that tokens may write to.
+func Auth(jwt auth.JWTManager, s *store.Store) func(http.Handler) http.Handler {
+  return AuthScope(jwt, s, "")
+}
+
+// AuthScope is Auth for a route that personal access tokens holding scope
+// may also call.
+func AuthScope(jwt auth.JWTManager, s *store.Store, scope auth.Scope) func(http.Handler) http.Handler {
   return func(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-      header := r.Header.Get("Authorization")
-      if header == "" {
-        response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+      user, ban, err := authenticate(r, jwt, s)
+      if err != nil {
+        if errors.Is(err, errUnauthenticated) {
+          response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+          return
+        }
+        response.WriteError(w, http.StatusInternalServerError, "auth_failed")
         return
       }
-
-      parts := strings.SplitN(header, " ", 2)
-      if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-        response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+      if ban != nil {
+        response.WriteBanned(w, ban.Reason, ban.ExpiresAt)
         return
       }
-
-      claims, err := jwt.Parse(parts[1])
-      if err != nil {
-        response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+      if !scopeAllows(r, user, scope) {
+        response.WriteError(w, http.StatusForbidden, "insufficient_scope")
         return
       }
 
-      ctx := requestctx.WithAuthUser(r.Context(), types.AuthUser{ID: claims.UserID})
-      next.ServeHTTP(w, r.WithContext(ctx))
+      next.ServeHTTP(w, r.WithContext(requestctx.WithAuthUser(r.Context(), user)))
     })
   }
 }
 
-func OptionalAuth(jwt auth.JWTManager) func(http.Handler) http.Handler {
+// OptionalAuth attaches the user when a usable token is present and
+// otherwise serves the request anonymously, including for banned users.
+func OptionalAuth(jwt auth.JWTManager, s *store.Store) func(http.Handler) http.Handler {
   return func(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-      header := r.Header.Get("Authorization")
-      if header == "" {
+      user, ban, err := authenticate(r, jwt, s)
+      if err != nil || ban != nil || !scopeAllows(r, user, "") {
         next.ServeHTTP(w, r)
         return
       }
 
-      parts := strings.SplitN(header, " ", 2)
-      if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-        next.ServeHTTP(w, r)
-        return
-      }
+      next.ServeHTTP(w, r.WithContext(requestctx.WithAuthUser(r.Context(), user)))
+    })
+  }
+}
 
-      claims, err := jwt.Parse(parts[1])
-      if err != nil {
-        next.ServeHTTP(w, r)
-        return
+// authenticate resolves the bearer token to a user. It returns
+// errUnauthenticated when there is no usable token, and the user's active
+// site ban, if any.
+func authenticate(r *http.Request, jwt auth.JWTManager, s *store.Store) (types.AuthUser, *models.Ban, error) {
+  token := bearerToken(r)
+  if token == "" {
+    return types.AuthUser{}, nil, errUnauthenticated
+  }
+
+  if auth.IsAccessToken(token) {
+    status, tokenID, scopes, err := s.AccessTokens.Authenticate(r.Context(), auth.HashToken(token))
+    if err != nil {
+      if errors.Is(err, store.ErrNotFound) {
+        return types.AuthUser{}, nil, errUnauthenticated
       }
+      return types.AuthUser{}, nil, err
+    }
+    touchAccessToken(s, tokenID)
 
-      ctx := requestctx.WithAuthUser(r.Context(), types.AuthUser{ID: claims.UserID})
-      next.ServeHTTP(w, r.WithContext(ctx))
-    })
+    user := accountUser(status)
+    user.Scopes = scopes
+    if user.Scopes == nil {
+      user.Scopes = []string{}
+    }
+    return user, status.SiteBan, nil
+  }
+
+  claims, err := jwt.Parse(token)
+  if err != nil {
+    return types.AuthUser{}, nil, errUnauthenticated
+  }
+
+  status, err := s.Users.GetAccountStatus(r.Context(), claims.UserID, claims.SessionID)
+  if err != nil {
+    if errors.Is(err, store.ErrNotFound) {
+      return types.AuthUser{}, nil, errUnauthenticated
+    }
+    return types.AuthUser{}, nil, err
+  }
+
+  user := accountUser(status)
+  user.SessionID = claims.SessionID
+  return user, status.SiteBan, nil
+}
+
+func accountUser(status models.AccountStatus) types.AuthUser {
+  return types.AuthUser{
+    ID:            status.UserID,
+    Role:          status.Role,
+    EmailVerified: status.EmailVerified,
+  }
+}
+
+// scopeAllows reports whether the caller may make this request. Session
+// users are unrestricted; access tokens need read for GET requests and the
+// route's scope for anything else.
+func scopeAllows(r *http.Request, user types.AuthUser, scope auth.Scope) bool {
+  if user.Scopes == nil {
+    return true
+  }
+  if r.Method == http.MethodGet || r.Method == http.MethodHead {
+    return slices.Contains(user.Scopes, string(auth.ScopeRead))
+  }
+  return scope != "" && slices.Contains(user.Scopes, string(scope))
+}
+
+// touchAccessToken updates the token's last use without holding up the
+// request.
+func touchAccessToken(s *store.Store, tokenID string) {
+  go func() {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := s.AccessTokens.TouchLastUsed(ctx, tokenID); err != nil {
+      log.Printf("access token touch failed: %v", err)
+    }
+  }()
+}
+
+func bearerToken(r *http.Request) string {
+  header := r.Header.Get("Authorization")
+  if header == "" {
+    return ""
+  }
+  parts := strings.SplitN(header, " ", 2)
+  if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+    return ""
   }
+  return strings.TrimSpace(parts[1])
 }
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+  "errors"
+  "net/http"
+  "strings"
+
+  "github.com/go-chi/chi/v5"
+
+  "jabber_v3/apps/api/internal/auth"
+  "jabber_v3/apps/api/internal/http/requestctx"
+  "jabber_v3/apps/api/internal/http/response"
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store"
+)
+
+// RequireRole looks up the caller's site role and rejects the request
+// unless it is one of roles. It must run after Auth.
+func RequireRole(s *store.Store, roles ...string) func(http.Handler) http.Handler {
+  return func(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+      user, ok := requestctx.AuthUserFromContext(r.Context())
+      if !ok {
+        response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+        return
+      }
+
+      record, err := s.Users.GetUserByID(r.Context(), user.ID)
+      if err != nil {
+        if errors.Is(err, store.ErrNotFound) {
+          response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+          return
+        }
+        response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+        return
+      }
+
+      for _, role := range roles {
+        if record.Role == role {
+          user.Role = record.Role
+          next.ServeHTTP(w, r.WithContext(requestctx.WithAuthUser(r.Context(), user)))
+          return
+        }
+      }
+      response.WriteError(w, http.StatusForbidden, "forbidden")
+    })
+  }
+}
+
+// RequirePermission rejects the request unless the caller holds perm. When
+// the route has a {slug} param the caller's role in that community counts
+// too, and private communities answer 404 to callers outside them. It must
+// run after Auth.
+func RequirePermission(s *store.Store, perm auth.Permission) func(http.Handler) http.Handler {
+  return func(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+      user, ok := requestctx.AuthUserFromContext(r.Context())
+      if !ok {
+        response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+        return
+      }
+
+      record, err := s.Users.GetUserByID(r.Context(), user.ID)
+      if err != nil {
+        if errors.Is(err, store.ErrNotFound) {
+          response.WriteError(w, http.StatusUnauthorized, "unauthorized")
+          return
+        }
+        response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+        return
+      }
+
+      communityRole := ""
+      private := false
+      if slug := strings.ToLower(strings.TrimSpace(chi.URLParam(r, "slug"))); slug != "" {
+        community, err := s.Communities.GetCommunityBySlug(r.Context(), slug)
+        if err != nil {
+          if errors.Is(err, store.ErrNotFound) {
+            response.WriteError(w, http.StatusNotFound, "community_not_found")
+            return
+          }
+          response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+          return
+        }
+        role, err := s.Communities.GetMemberRole(r.Context(), community.ID, user.ID)
+        if err != nil && !errors.Is(err, store.ErrNotFound) {
+          response.WriteError(w, http.StatusInternalServerError, "fetch_failed")
+          return
+        }
+        communityRole = role
+        private = community.Visibility == models.CommunityPrivate
+      }
+
+      if !auth.Can(record.Role, communityRole, perm) {
+        // Outsiders get the same answer as for a missing community, so
+        // private communities can't be discovered by probing slugs.
+        if private && communityRole == "" {
+          response.WriteError(w, http.StatusNotFound, "community_not_found")
+          return
+        }
+        response.WriteError(w, http.StatusForbidden, "forbidden")
+        return
+      }
+
+      user.Role = record.Role
+      ctx := requestctx.WithAuthUser(r.Context(), user)
+      ctx = requestctx.WithCommunityRole(ctx, communityRole)
+      next.ServeHTTP(w, r.WithContext(ctx))
+    })
+  }
+}
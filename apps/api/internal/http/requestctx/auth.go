@@ -16,3 +16,16 @@ func AuthUserFromContext(ctx context.Context) (types.AuthUser, bool) {
   user, ok := ctx.Value(authUserKey{}).(types.AuthUser)
   return user, ok
 }
+
+type communityRoleKey struct{}
+
+// WithCommunityRole records the caller's role in the community a request
+// targets, as resolved by the permission middleware.
+func WithCommunityRole(ctx context.Context, role string) context.Context {
+  return context.WithValue(ctx, communityRoleKey{}, role)
+}
+
+func CommunityRoleFromContext(ctx context.Context) (string, bool) {
+  role, ok := ctx.Value(communityRoleKey{}).(string)
+  return role, ok
+}
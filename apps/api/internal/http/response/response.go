@@ -3,6 +3,7 @@ package response
 import (
   "encoding/json"
   "net/http"
+  "time"
 )
 
 func WriteJSON(w http.ResponseWriter, status int, payload any) {
@@ -14,3 +15,20 @@ func WriteJSON(w http.ResponseWriter, status int, payload any) {
 func WriteError(w http.ResponseWriter, status int, code string) {
   WriteJSON(w, status, map[string]string{"error": code})
 }
+
+// WriteFieldErrors reports validation problems by request field, e.g.
+// {"error": "invalid_fields", "fields": {"password": ["too_short"]}}.
+func WriteFieldErrors(w http.ResponseWriter, fields map[string][]string) {
+  WriteJSON(w, http.StatusBadRequest, map[string]any{
+    "error":  "invalid_fields",
+    "fields": fields,
+  })
+}
+
+func WriteBanned(w http.ResponseWriter, reason string, expiresAt *time.Time) {
+  WriteJSON(w, http.StatusForbidden, map[string]any{
+    "error":     "banned",
+    "reason":    reason,
+    "expiresAt": expiresAt,
+  })
+}
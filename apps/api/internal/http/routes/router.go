@@ -11,19 +11,26 @@ import (
 	"jabber_v3/apps/api/internal/http/middleware"
 	"jabber_v3/apps/api/internal/http/response"
 	"jabber_v3/apps/api/internal/http/utils"
+	"jabber_v3/apps/api/internal/mail"
 	"jabber_v3/apps/api/internal/rtc"
 	"jabber_v3/apps/api/internal/store"
 )
 
-func NewRouter(store *store.Store, jwt auth.JWTManager, allowedOrigins []string) http.Handler {
-	handler := handlers.New(store, jwt)
-	rtcHandler := rtc.NewHandler(jwt, rtc.NewRoomManager())
+func NewRouter(store *store.Store, jwt auth.JWTManager, mailer mail.Mailer, handlerConfig handlers.Config, allowedOrigins []string) http.Handler {
+	handler := handlers.New(store, jwt, mailer, handlerConfig)
+	rtcHandler := rtc.NewHandler(jwt, store.Users, rtc.NewRoomManager())
+	requireAuth := middleware.Auth(jwt, store)
+	optionalAuth := middleware.OptionalAuth(jwt, store)
+	requireScope := func(scope auth.Scope) func(http.Handler) http.Handler {
+		return middleware.AuthScope(jwt, store, scope)
+	}
 	r := chi.NewRouter()
 	r.Use(utils.RequestLogger)
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 	})
+	r.Get("/.well-known/jwks.json", handler.HandleJWKS)
 
 	roomsRouter := chi.NewRouter()
 	roomsRouter.Get("/{roomID}/ws", func(w http.ResponseWriter, r *http.Request) {
@@ -37,18 +44,94 @@ func NewRouter(store *store.Store, jwt auth.JWTManager, allowedOrigins []string)
 		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		AllowCredentials: false,
+		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
 	apiRouter.Post("/auth/register", handler.HandleRegister)
 	apiRouter.Post("/auth/login", handler.HandleLogin)
-	apiRouter.With(middleware.Auth(jwt)).Get("/me", handler.HandleMe)
+	apiRouter.Post("/auth/2fa/verify", handler.HandleVerifyMFA)
+	apiRouter.Post("/auth/oidc/{provider}/start", handler.HandleOIDCStart)
+	apiRouter.Post("/auth/oidc/{provider}/callback", handler.HandleOIDCCallback)
+	apiRouter.Post("/auth/refresh", handler.HandleRefresh)
+	apiRouter.With(requireAuth).Post("/auth/logout", handler.HandleLogout)
+	apiRouter.Post("/auth/password/forgot", handler.HandleForgotPassword)
+	apiRouter.Post("/auth/password/reset", handler.HandleResetPassword)
+	apiRouter.Post("/auth/email/verify", handler.HandleVerifyEmail)
+	apiRouter.With(requireAuth).Post("/auth/email/resend", handler.HandleResendVerification)
+	apiRouter.Post("/auth/email/change/confirm", handler.HandleConfirmEmailChange)
+	apiRouter.With(requireAuth).Get("/me", handler.HandleMe)
+	apiRouter.With(requireAuth).Patch("/me", handler.HandleUpdateMe)
+	apiRouter.With(requireAuth).Delete("/me", handler.HandleDeleteAccount)
+	apiRouter.With(requireAuth).Post("/me/password", handler.HandleChangePassword)
+	apiRouter.With(requireAuth).Post("/me/email", handler.HandleChangeEmail)
+	apiRouter.With(requireAuth).Get("/me/sessions", handler.HandleListSessions)
+	apiRouter.With(requireAuth).Delete("/me/sessions", handler.HandleRevokeOtherSessions)
+	apiRouter.With(requireAuth).Delete("/me/sessions/{sessionID}", handler.HandleRevokeSession)
+	apiRouter.With(requireAuth).Post("/me/2fa/totp/setup", handler.HandleSetupTOTP)
+	apiRouter.With(requireAuth).Post("/me/2fa/totp/confirm", handler.HandleConfirmTOTP)
+	apiRouter.With(requireAuth).Delete("/me/2fa/totp", handler.HandleDisableTOTP)
+	apiRouter.With(requireAuth).Post("/me/2fa/recovery-codes", handler.HandleRegenerateRecoveryCodes)
+	apiRouter.With(requireAuth).Get("/me/identities", handler.HandleListIdentities)
+	apiRouter.With(requireAuth).Post("/me/identities/{provider}/start", handler.HandleLinkIdentityStart)
+	apiRouter.With(requireAuth).Post("/me/identities/{provider}/callback", handler.HandleLinkIdentityCallback)
+	apiRouter.With(requireAuth).Delete("/me/identities/{identityID}", handler.HandleUnlinkIdentity)
+	apiRouter.With(requireAuth).Get("/me/tokens", handler.HandleListAccessTokens)
+	apiRouter.With(requireAuth).Post("/me/tokens", handler.HandleCreateAccessToken)
+	apiRouter.With(requireAuth).Delete("/me/tokens/{tokenID}", handler.HandleRevokeAccessToken)
+	apiRouter.With(requireAuth).Post("/me/export", handler.HandleCreateExport)
+	apiRouter.With(requireAuth).Get("/me/exports/{exportID}", handler.HandleGetExport)
+	apiRouter.With(requireAuth).Get("/me/exports/{exportID}/download", handler.HandleDownloadExport)
 
 	apiRouter.Route("/posts", func(r chi.Router) {
-		r.With(middleware.OptionalAuth(jwt)).Get("/", handler.HandleFeed)
-		r.With(middleware.Auth(jwt)).Post("/", handler.HandleCreatePost)
-		r.With(middleware.Auth(jwt)).Post("/{postID}/vote", handler.HandleVote)
+		r.With(optionalAuth).Get("/", handler.HandleFeed)
+		r.With(requireScope(auth.ScopePostsWrite)).Post("/", handler.HandleCreatePost)
+		r.With(optionalAuth).Get("/{postID}", handler.HandleGetPost)
+		r.With(requireScope(auth.ScopePostsWrite)).Patch("/{postID}", handler.HandleUpdatePost)
+		r.With(requireScope(auth.ScopePostsWrite)).Delete("/{postID}", handler.HandleDeletePost)
+		r.With(optionalAuth).Get("/{postID}/revisions", handler.HandleListRevisions)
+		r.With(requireScope(auth.ScopeVotesWrite)).Post("/{postID}/vote", handler.HandleVote)
+		r.With(requireAuth).Post("/{postID}/report", handler.HandleReportPost)
+		r.With(requireAuth).Post("/{postID}/moderate", handler.HandleModeratePost)
+		r.With(optionalAuth).Get("/{postID}/comments", handler.HandleListComments)
+		r.With(requireScope(auth.ScopeCommentsWrite)).Post("/{postID}/comments", handler.HandleCreateComment)
+		r.With(optionalAuth).Get("/{postID}/comments/{commentID}", handler.HandleGetCommentThread)
+	})
+
+	apiRouter.With(optionalAuth).Get("/search", handler.HandleSearch)
+
+	apiRouter.Route("/users/{username}", func(r chi.Router) {
+		r.With(optionalAuth).Get("/", handler.HandleGetProfile)
+		r.With(optionalAuth).Get("/posts", handler.HandleListUserPosts)
+		r.With(optionalAuth).Get("/comments", handler.HandleListUserComments)
+		r.With(requireAuth).Get("/votes", handler.HandleListUserVotes)
+	})
+
+	apiRouter.Route("/communities", func(r chi.Router) {
+		r.With(optionalAuth).Get("/", handler.HandleListCommunities)
+		r.With(requireAuth).Post("/", handler.HandleCreateCommunity)
+		r.With(optionalAuth).Get("/{slug}", handler.HandleGetCommunity)
+		r.With(requireAuth).Post("/{slug}/join", handler.HandleJoinCommunity)
+		r.With(requireAuth).Post("/{slug}/leave", handler.HandleLeaveCommunity)
+		r.With(requireAuth, middleware.RequirePermission(store, auth.PermManageMembers)).Post("/{slug}/members", handler.HandleAddCommunityMember)
+		r.With(optionalAuth).Get("/{slug}/moderators", handler.HandleListModerators)
+		r.With(requireAuth, middleware.RequirePermission(store, auth.PermModerate)).Get("/{slug}/reports", handler.HandleCommunityReportQueue)
+		r.With(requireAuth, middleware.RequirePermission(store, auth.PermModerate)).Get("/{slug}/modlog", handler.HandleCommunityModerationLog)
+		r.With(requireAuth, middleware.RequirePermission(store, auth.PermModerate)).Get("/{slug}/bans", handler.HandleListCommunityBans)
+		r.With(requireAuth, middleware.RequirePermission(store, auth.PermModerate)).Post("/{slug}/bans", handler.HandleCreateCommunityBan)
+		r.With(requireAuth, middleware.RequirePermission(store, auth.PermModerate)).Delete("/{slug}/bans/{banID}", handler.HandleRevokeCommunityBan)
+		r.With(requireAuth, middleware.RequirePermission(store, auth.PermManageModerators)).Put("/{slug}/moderators/{username}", handler.HandleAddModerator)
+		r.With(requireAuth, middleware.RequirePermission(store, auth.PermManageModerators)).Delete("/{slug}/moderators/{username}", handler.HandleRemoveModerator)
+	})
+
+	apiRouter.Route("/admin", func(r chi.Router) {
+		r.Use(requireAuth, middleware.RequireRole(store, auth.RoleAdmin))
+		r.Put("/users/{username}/role", handler.HandleSetUserRole)
+		r.Get("/reports", handler.HandleSiteReportQueue)
+		r.Get("/modlog", handler.HandleSiteModerationLog)
+		r.Get("/bans", handler.HandleListSiteBans)
+		r.Post("/bans", handler.HandleCreateSiteBan)
+		r.Delete("/bans/{banID}", handler.HandleRevokeSiteBan)
 	})
 
 	r.Mount("/api/v1", apiRouter)
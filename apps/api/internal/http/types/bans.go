@@ -0,0 +1,19 @@
+package types
+
+import "time"
+
+type CreateBanRequest struct {
+  Username  string     `json:"username"`
+  Reason    string     `json:"reason"`
+  ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type BanView struct {
+  ID          string     `json:"id"`
+  UserID      string     `json:"userId"`
+  CommunityID *string    `json:"communityId"`
+  Reason      string     `json:"reason"`
+  BannedBy    *string    `json:"bannedBy"`
+  CreatedAt   time.Time  `json:"createdAt"`
+  ExpiresAt   *time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,25 @@
+package types
+
+import "time"
+
+type CreateCommentRequest struct {
+  ParentID *string `json:"parentId"`
+  Body     string  `json:"body"`
+}
+
+type CommentView struct {
+  ID         string         `json:"id"`
+  PostID     string         `json:"postId"`
+  ParentID   *string        `json:"parentId"`
+  Body       string         `json:"body"`
+  CreatedAt  time.Time      `json:"createdAt"`
+  Author     AuthorView     `json:"author"`
+  ReplyCount int            `json:"replyCount"`
+  HasMore    bool           `json:"hasMore"`
+  Replies    []*CommentView `json:"replies"`
+}
+
+type CommentThreadResponse struct {
+  Comments   []*CommentView `json:"comments"`
+  NextCursor *string        `json:"nextCursor"`
+}
@@ -0,0 +1,46 @@
+package types
+
+import "time"
+
+type CreateCommunityRequest struct {
+  Slug        string `json:"slug"`
+  Name        string `json:"name"`
+  Description string `json:"description"`
+  Visibility  string `json:"visibility"`
+}
+
+type AddCommunityMemberRequest struct {
+  Username string `json:"username"`
+}
+
+type CommunityView struct {
+  ID           string    `json:"id"`
+  Slug         string    `json:"slug"`
+  Name         string    `json:"name"`
+  Description  string    `json:"description"`
+  Visibility   string    `json:"visibility"`
+  OwnerID      string    `json:"ownerId"`
+  CreatedAt    time.Time `json:"createdAt"`
+  MemberCount  int       `json:"memberCount"`
+  ViewerRole   *string   `json:"viewerRole"`
+  IsMember     bool      `json:"isMember"`
+  IsSubscribed bool      `json:"isSubscribed"`
+}
+
+type CommunityListResponse struct {
+  Communities []CommunityView `json:"communities"`
+  NextCursor  *string         `json:"nextCursor"`
+}
+
+type CommunitySummary struct {
+  ID   string `json:"id"`
+  Slug string `json:"slug"`
+  Name string `json:"name"`
+}
+
+type CommunityMemberView struct {
+  UserID   string    `json:"userId"`
+  Username string    `json:"username"`
+  Role     string    `json:"role"`
+  Since    time.Time `json:"since"`
+}
@@ -0,0 +1,46 @@
+package types
+
+import "time"
+
+type ExportView struct {
+  ID          string     `json:"id"`
+  Status      string     `json:"status"`
+  CreatedAt   time.Time  `json:"createdAt"`
+  CompletedAt *time.Time `json:"completedAt"`
+  ExpiresAt   *time.Time `json:"expiresAt"`
+}
+
+// The files of a data export archive.
+
+type ExportedPost struct {
+  ID          string     `json:"id"`
+  CommunityID *string    `json:"communityId"`
+  Title       string     `json:"title"`
+  Body        string     `json:"body"`
+  CreatedAt   time.Time  `json:"createdAt"`
+  EditedAt    *time.Time `json:"editedAt"`
+  DeletedAt   *time.Time `json:"deletedAt"`
+  RemovedAt   *time.Time `json:"removedAt"`
+}
+
+type ExportedComment struct {
+  ID        string    `json:"id"`
+  PostID    string    `json:"postId"`
+  ParentID  *string   `json:"parentId"`
+  Body      string    `json:"body"`
+  CreatedAt time.Time `json:"createdAt"`
+}
+
+type ExportedVote struct {
+  PostID    string    `json:"postId"`
+  Value     int       `json:"value"`
+  CreatedAt time.Time `json:"createdAt"`
+}
+
+type DeleteAccountRequest struct {
+  Password string `json:"password"`
+}
+
+type DeleteAccountResponse struct {
+  DeleteAfter time.Time `json:"deleteAfter"`
+}
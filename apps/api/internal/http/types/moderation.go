@@ -0,0 +1,48 @@
+package types
+
+import "time"
+
+type ReportRequest struct {
+  Reason  string `json:"reason"`
+  Details string `json:"details"`
+}
+
+type ModerateRequest struct {
+  Action string `json:"action"`
+  Reason string `json:"reason"`
+}
+
+type ReportView struct {
+  ID        string    `json:"id"`
+  PostID    string    `json:"postId"`
+  Reason    string    `json:"reason"`
+  Details   string    `json:"details"`
+  Status    string    `json:"status"`
+  CreatedAt time.Time `json:"createdAt"`
+}
+
+type ReportGroupView struct {
+  PostID          string     `json:"postId"`
+  PostTitle       string     `json:"postTitle"`
+  Author          AuthorView `json:"author"`
+  ReportCount     int        `json:"reportCount"`
+  Reasons         []string   `json:"reasons"`
+  FirstReportedAt time.Time  `json:"firstReportedAt"`
+  LastReportedAt  time.Time  `json:"lastReportedAt"`
+}
+
+type ModerationLogEntryView struct {
+  ID          string    `json:"id"`
+  CommunityID *string   `json:"communityId"`
+  ModeratorID string    `json:"moderatorId"`
+  Action      string    `json:"action"`
+  TargetType  string    `json:"targetType"`
+  TargetID    string    `json:"targetId"`
+  Reason      string    `json:"reason"`
+  CreatedAt   time.Time `json:"createdAt"`
+}
+
+type ModerationLogResponse struct {
+  Entries    []ModerationLogEntryView `json:"entries"`
+  NextCursor *string                  `json:"nextCursor"`
+}
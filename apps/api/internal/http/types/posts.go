@@ -3,26 +3,70 @@ package types
 import "time"
 
 type CreatePostRequest struct {
-  Title string `json:"title"`
-  Body  string `json:"body"`
+  Title     string `json:"title"`
+  Body      string `json:"body"`
+  Community string `json:"community"`
+}
+
+type UpdatePostRequest struct {
+  Title *string `json:"title"`
+  Body  *string `json:"body"`
 }
 
 type VoteRequest struct {
   Value int `json:"value"`
 }
 
+type VoteResponse struct {
+  Score     int `json:"score"`
+  Upvotes   int `json:"upvotes"`
+  Downvotes int `json:"downvotes"`
+  MyVote    int `json:"myVote"`
+}
+
 type PostView struct {
+  ID           string            `json:"id"`
+  Title        string            `json:"title"`
+  Body         string            `json:"body"`
+  CreatedAt    time.Time         `json:"createdAt"`
+  Author       AuthorView        `json:"author"`
+  Score        int               `json:"score"`
+  Upvotes      int               `json:"upvotes"`
+  Downvotes    int               `json:"downvotes"`
+  MyVote       int               `json:"myVote"`
+  CommentCount int               `json:"commentCount"`
+  Community    *CommunitySummary `json:"community"`
+  EditedAt     *time.Time        `json:"editedAt"`
+  Deleted      bool              `json:"deleted"`
+  Removed      bool              `json:"removed"`
+  Locked       bool              `json:"locked"`
+  Pinned       bool              `json:"pinned"`
+  // Original is what a deleted or removed post said. Everyone else sees
+  // the placeholder title only.
+  Original *PostContentView `json:"original,omitempty" visible:"self,moderator"`
+}
+
+type PostContentView struct {
+  Title  string     `json:"title"`
+  Body   string     `json:"body"`
+  Author AuthorView `json:"author"`
+}
+
+type PostRevisionView struct {
   ID        string    `json:"id"`
   Title     string    `json:"title"`
   Body      string    `json:"body"`
   CreatedAt time.Time `json:"createdAt"`
-  Author    AuthorView `json:"author"`
-  Score     int       `json:"score"`
-  MyVote    int       `json:"myVote"`
 }
 
+type FeedResponse struct {
+  Posts      []PostView `json:"posts"`
+  NextCursor *string    `json:"nextCursor"`
+}
+
+// AuthorView names the author of public content. It only ever holds public
+// fields since it is embedded in views shown to everyone.
 type AuthorView struct {
   ID       string `json:"id"`
-  Email    string `json:"email"`
   Username string `json:"username"`
 }
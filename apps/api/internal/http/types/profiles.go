@@ -0,0 +1,44 @@
+package types
+
+import "time"
+
+// ProfileView is the public profile of a user. Karma is PostKarma plus
+// CommentKarma. CommentKarma is reserved for when comments can be voted on
+// and is always 0 until then.
+type ProfileView struct {
+  ID           string    `json:"id"`
+  Username     string    `json:"username"`
+  DisplayName  string    `json:"displayName"`
+  Bio          string    `json:"bio"`
+  AvatarURL    string    `json:"avatarUrl"`
+  CreatedAt    time.Time `json:"createdAt"`
+  Karma        int       `json:"karma"`
+  PostKarma    int       `json:"postKarma"`
+  CommentKarma int       `json:"commentKarma"`
+}
+
+type ProfileCommentView struct {
+  ID        string            `json:"id"`
+  PostID    string            `json:"postId"`
+  PostTitle string            `json:"postTitle"`
+  ParentID  *string           `json:"parentId"`
+  Body      string            `json:"body"`
+  CreatedAt time.Time         `json:"createdAt"`
+  Community *CommunitySummary `json:"community"`
+}
+
+type ProfileCommentsResponse struct {
+  Comments   []ProfileCommentView `json:"comments"`
+  NextCursor *string              `json:"nextCursor"`
+}
+
+type VotedPostView struct {
+  Post    PostView  `json:"post"`
+  Value   int       `json:"value"`
+  VotedAt time.Time `json:"votedAt"`
+}
+
+type VotesResponse struct {
+  Votes      []VotedPostView `json:"votes"`
+  NextCursor *string         `json:"nextCursor"`
+}
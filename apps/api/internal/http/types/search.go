@@ -0,0 +1,20 @@
+package types
+
+import "time"
+
+type SearchResultView struct {
+  Type      string            `json:"type"`
+  ID        string            `json:"id"`
+  PostID    string            `json:"postId"`
+  Title     string            `json:"title"`
+  Snippet   string            `json:"snippet"`
+  Rank      float64           `json:"rank"`
+  CreatedAt time.Time         `json:"createdAt"`
+  Author    AuthorView        `json:"author"`
+  Community *CommunitySummary `json:"community"`
+}
+
+type SearchResponse struct {
+  Results    []SearchResultView `json:"results"`
+  NextCursor *string            `json:"nextCursor"`
+}
@@ -3,8 +3,14 @@ package types
 import "time"
 
 type AuthUser struct {
-  ID    string
-  Email string
+  ID            string
+  Email         string
+  Role          string
+  SessionID     string
+  EmailVerified bool
+  // Scopes is set when the request was made with a personal access token
+  // and nil for password sessions.
+  Scopes []string
 }
 
 type CredentialsRequest struct {
@@ -14,13 +20,153 @@ type CredentialsRequest struct {
 }
 
 type AuthResponse struct {
-  Token string   `json:"token"`
-  User  UserView `json:"user"`
+  TokenResponse
+  User UserView `json:"user"`
 }
 
+type TokenResponse struct {
+  Token        string    `json:"token"`
+  RefreshToken string    `json:"refreshToken"`
+  ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+type RefreshRequest struct {
+  RefreshToken string `json:"refreshToken"`
+}
+
+type SessionView struct {
+  ID         string    `json:"id"`
+  UserAgent  string    `json:"userAgent"`
+  IP         string    `json:"ip"`
+  CreatedAt  time.Time `json:"createdAt"`
+  LastSeenAt time.Time `json:"lastSeenAt"`
+  ExpiresAt  time.Time `json:"expiresAt"`
+  Current    bool      `json:"current"`
+}
+
+// UserView is an account as its owner and site moderators see it. Render it
+// with Redact for anyone else.
 type UserView struct {
-  ID        string    `json:"id"`
-  Email     string    `json:"email"`
-  Username  string    `json:"username"`
-  CreatedAt time.Time `json:"createdAt"`
+  ID            string     `json:"id"`
+  Email         string     `json:"email,omitempty" visible:"self,moderator"`
+  Username      string     `json:"username"`
+  Role          string     `json:"role"`
+  EmailVerified *bool      `json:"emailVerified,omitempty" visible:"self,moderator"`
+  TwoFactor     *bool      `json:"twoFactorEnabled,omitempty" visible:"self,moderator"`
+  DisplayName   string     `json:"displayName"`
+  Bio           string     `json:"bio"`
+  AvatarURL     string     `json:"avatarUrl"`
+  CreatedAt     time.Time  `json:"createdAt"`
+  UpdatedAt     *time.Time `json:"updatedAt,omitempty" visible:"self,moderator"`
+}
+
+// MFAChallengeResponse is returned by login instead of tokens when the
+// account has two-factor authentication enabled.
+type MFAChallengeResponse struct {
+  MFARequired    bool      `json:"mfaRequired"`
+  ChallengeToken string    `json:"challengeToken"`
+  ExpiresAt      time.Time `json:"expiresAt"`
+}
+
+type MFAVerifyRequest struct {
+  ChallengeToken string `json:"challengeToken"`
+  Code           string `json:"code"`
+  RecoveryCode   string `json:"recoveryCode"`
+}
+
+type TOTPSetupResponse struct {
+  Secret string `json:"secret"`
+  URI    string `json:"otpauthUri"`
+}
+
+type TOTPCodeRequest struct {
+  Code string `json:"code"`
+}
+
+type DisableTOTPRequest struct {
+  Password string `json:"password"`
+  Code     string `json:"code"`
+}
+
+type RecoveryCodesResponse struct {
+  RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type ForgotPasswordRequest struct {
+  Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+  Token    string `json:"token"`
+  Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+  Token string `json:"token"`
+}
+
+type UpdateMeRequest struct {
+  Username    *string `json:"username"`
+  DisplayName *string `json:"displayName"`
+  Bio         *string `json:"bio"`
+  AvatarURL   *string `json:"avatarUrl"`
+}
+
+type ChangePasswordRequest struct {
+  CurrentPassword string `json:"currentPassword"`
+  NewPassword     string `json:"newPassword"`
+}
+
+type ChangeEmailRequest struct {
+  Email    string `json:"email"`
+  Password string `json:"password"`
+}
+
+type SetRoleRequest struct {
+  Role string `json:"role"`
+}
+
+type CreateAccessTokenRequest struct {
+  Name      string     `json:"name"`
+  Scopes    []string   `json:"scopes"`
+  ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type AccessTokenView struct {
+  ID         string     `json:"id"`
+  Name       string     `json:"name"`
+  Prefix     string     `json:"prefix"`
+  Scopes     []string   `json:"scopes"`
+  CreatedAt  time.Time  `json:"createdAt"`
+  LastUsedAt *time.Time `json:"lastUsedAt"`
+  ExpiresAt  *time.Time `json:"expiresAt"`
+}
+
+// CreatedAccessTokenResponse is the only time the token itself is shown.
+type CreatedAccessTokenResponse struct {
+  AccessTokenView
+  Token string `json:"token"`
+}
+
+type OIDCStartResponse struct {
+  AuthorizationURL string `json:"authorizationUrl"`
+}
+
+type OIDCCallbackRequest struct {
+  Code  string `json:"code"`
+  State string `json:"state"`
+}
+
+type IdentityView struct {
+  ID          string     `json:"id"`
+  Provider    string     `json:"provider"`
+  Email       string     `json:"email"`
+  CreatedAt   time.Time  `json:"createdAt"`
+  LastLoginAt *time.Time `json:"lastLoginAt"`
+}
+
+// LinkedIdentityResponse answers an OIDC callback that connected an
+// identity to the signed-in user rather than logging in.
+type LinkedIdentityResponse struct {
+  Identity IdentityView `json:"identity"`
 }
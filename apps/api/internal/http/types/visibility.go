@@ -0,0 +1,112 @@
+package types
+
+import (
+  "reflect"
+  "strings"
+)
+
+// Audience describes who a view is being rendered for, relative to the
+// record it shows. It is a set: a site admin looking at their own account
+// is both AudienceSelf and AudienceModerator.
+type Audience uint8
+
+const (
+  AudienceSelf Audience = 1 << iota
+  AudienceModerator
+)
+
+// AudiencePublic is anyone else, including anonymous visitors.
+const AudiencePublic Audience = 0
+
+var audienceNames = map[string]Audience{
+  "self":      AudienceSelf,
+  "moderator": AudienceModerator,
+}
+
+// Redact returns view with every field the audience may not see set to its
+// zero value. Fields are public unless tagged, e.g. `visible:"self,moderator"`;
+// tagged fields should be omitempty (pointers for bools and numbers) so that
+// redacted values are left out of the response rather than shown as zero.
+// Structs reached through fields, pointers, slices and arrays are redacted
+// for the same audience; maps and interfaces are left alone. Pointers and
+// slices are copied rather than redacted in place, so the caller's values
+// are never modified.
+func Redact[T any](view T, audience Audience) T {
+  value := reflect.ValueOf(&view).Elem()
+  redact(value, audience)
+  return view
+}
+
+// redact zeroes the hidden fields reachable from value, which must be
+// settable.
+func redact(value reflect.Value, audience Audience) {
+  if !mayHoldTags(value.Type()) {
+    return
+  }
+  switch value.Kind() {
+  case reflect.Struct:
+    fields := value.Type()
+    for i := 0; i < fields.NumField(); i++ {
+      field := fields.Field(i)
+      if !field.IsExported() {
+        continue
+      }
+      if tag, ok := field.Tag.Lookup("visible"); ok && !visibleTo(tag, audience) {
+        value.Field(i).SetZero()
+        continue
+      }
+      redact(value.Field(i), audience)
+    }
+  case reflect.Pointer:
+    if value.IsNil() {
+      return
+    }
+    clone := reflect.New(value.Type().Elem())
+    clone.Elem().Set(value.Elem())
+    redact(clone.Elem(), audience)
+    value.Set(clone)
+  case reflect.Slice:
+    if value.IsNil() {
+      return
+    }
+    clone := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+    reflect.Copy(clone, value)
+    for i := 0; i < clone.Len(); i++ {
+      redact(clone.Index(i), audience)
+    }
+    value.Set(clone)
+  case reflect.Array:
+    for i := 0; i < value.Len(); i++ {
+      redact(value.Index(i), audience)
+    }
+  }
+}
+
+// mayHoldTags reports whether values of t can contain exported struct
+// fields, so that slices of strings or times aren't copied for nothing.
+func mayHoldTags(t reflect.Type) bool {
+  for {
+    switch t.Kind() {
+    case reflect.Pointer, reflect.Slice, reflect.Array:
+      t = t.Elem()
+    case reflect.Struct:
+      for i := 0; i < t.NumField(); i++ {
+        if t.Field(i).IsExported() {
+          return true
+        }
+      }
+      return false
+    default:
+      return false
+    }
+  }
+}
+
+func visibleTo(tag string, audience Audience) bool {
+  for _, name := range strings.Split(tag, ",") {
+    if audience&audienceNames[strings.TrimSpace(name)] != 0 {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,137 @@
+package types
+
+import (
+  "reflect"
+  "testing"
+)
+
+type secretView struct {
+  Name   string `json:"name"`
+  Email  string `json:"email,omitempty" visible:"self,moderator"`
+  Notes  string `json:"notes,omitempty" visible:"moderator"`
+  Count  *int   `json:"count,omitempty" visible:"self"`
+  hidden string
+}
+
+type nestedView struct {
+  Secret   secretView
+  Pointer  *secretView
+  List     []secretView
+  Pointers []*secretView
+  Array    [2]secretView
+  Tags     []string
+  Replies  []*nestedView
+}
+
+func newSecret(name string) secretView {
+  count := 3
+  return secretView{Name: name, Email: name + "@example.com", Notes: "note", Count: &count, hidden: "kept"}
+}
+
+func TestRedactByAudience(t *testing.T) {
+  view := newSecret("ada")
+  cases := []struct {
+    audience Audience
+    email    bool
+    notes    bool
+    count    bool
+  }{
+    {AudiencePublic, false, false, false},
+    {AudienceSelf, true, false, true},
+    {AudienceModerator, true, true, false},
+    {AudienceSelf | AudienceModerator, true, true, true},
+  }
+  for _, tc := range cases {
+    got := Redact(view, tc.audience)
+    if got.Name != "ada" || got.hidden != "kept" {
+      t.Errorf("audience %d: untagged fields changed: %+v", tc.audience, got)
+    }
+    if (got.Email != "") != tc.email || (got.Notes != "") != tc.notes || (got.Count != nil) != tc.count {
+      t.Errorf("audience %d: got %+v", tc.audience, got)
+    }
+  }
+}
+
+func TestRedactNested(t *testing.T) {
+  pointer := newSecret("pointer")
+  listed := newSecret("listed")
+  view := nestedView{
+    Secret:   newSecret("field"),
+    Pointer:  &pointer,
+    List:     []secretView{newSecret("list")},
+    Pointers: []*secretView{&listed, nil},
+    Array:    [2]secretView{newSecret("first"), newSecret("second")},
+    Tags:     []string{"a", "b"},
+  }
+
+  got := Redact(view, AudiencePublic)
+  redacted := []secretView{got.Secret, *got.Pointer, got.List[0], *got.Pointers[0], got.Array[0], got.Array[1]}
+  for _, secret := range redacted {
+    if secret.Email != "" || secret.Notes != "" || secret.Count != nil {
+      t.Errorf("nested view not redacted: %+v", secret)
+    }
+    if secret.Name == "" {
+      t.Errorf("nested view lost public fields: %+v", secret)
+    }
+  }
+  if got.Pointers[1] != nil {
+    t.Errorf("nil pointer in slice became %+v", got.Pointers[1])
+  }
+  if !reflect.DeepEqual(got.Tags, []string{"a", "b"}) {
+    t.Errorf("Tags = %v", got.Tags)
+  }
+}
+
+func TestRedactLeavesInputAlone(t *testing.T) {
+  pointer := newSecret("pointer")
+  listed := newSecret("listed")
+  view := nestedView{
+    Pointer:  &pointer,
+    List:     []secretView{newSecret("list")},
+    Pointers: []*secretView{&listed},
+  }
+
+  Redact(view, AudiencePublic)
+  Redact(&pointer, AudiencePublic)
+  for _, secret := range []secretView{pointer, view.List[0], listed} {
+    if secret.Email == "" || secret.Notes == "" || secret.Count == nil {
+      t.Errorf("Redact modified its input: %+v", secret)
+    }
+  }
+}
+
+func TestRedactPointerView(t *testing.T) {
+  view := newSecret("ada")
+  got := Redact(&view, AudienceSelf)
+  if got == &view {
+    t.Fatal("Redact returned the caller's pointer")
+  }
+  if got.Email == "" || got.Notes != "" || got.Count == nil {
+    t.Errorf("got %+v", *got)
+  }
+}
+
+func TestRedactKeepsNil(t *testing.T) {
+  got := Redact(nestedView{}, AudiencePublic)
+  if got.Pointer != nil || got.List != nil || got.Pointers != nil || got.Replies != nil {
+    t.Errorf("nil values were replaced: %+v", got)
+  }
+  if Redact[*secretView](nil, AudiencePublic) != nil {
+    t.Error("nil view was replaced")
+  }
+}
+
+func TestRedactReplyTree(t *testing.T) {
+  leaf := &nestedView{Secret: newSecret("leaf")}
+  root := nestedView{Secret: newSecret("root"), Replies: []*nestedView{{Secret: newSecret("child"), Replies: []*nestedView{leaf}}}}
+
+  got := Redact(root, AudiencePublic)
+  for _, secret := range []secretView{got.Secret, got.Replies[0].Secret, got.Replies[0].Replies[0].Secret} {
+    if secret.Email != "" || secret.Name == "" {
+      t.Errorf("reply not redacted: %+v", secret)
+    }
+  }
+  if leaf.Secret.Email == "" {
+    t.Error("Redact modified a reply in the input")
+  }
+}
@@ -0,0 +1,30 @@
+package mail
+
+import (
+  "context"
+  "fmt"
+  "log"
+  "os"
+  "path/filepath"
+  "time"
+)
+
+// FileMailer is for local development. It writes each message to a file in
+// Dir, or to the server log when Dir is empty, so links can be copied out.
+type FileMailer struct {
+  Dir string
+}
+
+func (m FileMailer) Send(ctx context.Context, msg Message) error {
+  content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+  if m.Dir == "" {
+    log.Printf("mail:\n%s", content)
+    return nil
+  }
+
+  if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+    return err
+  }
+  name := fmt.Sprintf("%s.txt", time.Now().UTC().Format("20060102T150405.000000000"))
+  return os.WriteFile(filepath.Join(m.Dir, name), []byte(content), 0o600)
+}
@@ -0,0 +1,16 @@
+// Package mail sends transactional email such as password resets and
+// address verification.
+package mail
+
+import "context"
+
+type Message struct {
+  To      string
+  Subject string
+  Body    string
+}
+
+// Mailer delivers a plain-text message.
+type Mailer interface {
+  Send(ctx context.Context, msg Message) error
+}
@@ -0,0 +1,59 @@
+package mail
+
+import (
+  "context"
+  "fmt"
+  "net"
+  "net/smtp"
+  "strings"
+  "time"
+)
+
+// SMTPMailer sends through an SMTP relay, authenticating with PLAIN auth
+// when a username is set.
+type SMTPMailer struct {
+  Addr     string
+  Username string
+  Password string
+  From     string
+}
+
+func (m SMTPMailer) Send(ctx context.Context, msg Message) error {
+  if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+    return fmt.Errorf("mail: header contains a line break")
+  }
+
+  var auth smtp.Auth
+  if m.Username != "" {
+    host, _, err := net.SplitHostPort(m.Addr)
+    if err != nil {
+      return err
+    }
+    auth = smtp.PlainAuth("", m.Username, m.Password, host)
+  }
+
+  done := make(chan error, 1)
+  go func() {
+    done <- smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, m.format(msg))
+  }()
+
+  select {
+  case err := <-done:
+    return err
+  case <-ctx.Done():
+    return ctx.Err()
+  }
+}
+
+func (m SMTPMailer) format(msg Message) []byte {
+  var b strings.Builder
+  b.WriteString("From: " + m.From + "\r\n")
+  b.WriteString("To: " + msg.To + "\r\n")
+  b.WriteString("Subject: " + msg.Subject + "\r\n")
+  b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+  b.WriteString("MIME-Version: 1.0\r\n")
+  b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+  b.WriteString("\r\n")
+  b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+  return []byte(b.String())
+}
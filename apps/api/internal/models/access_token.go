@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PersonalAccessToken is a long-lived credential for scripts and bots.
+// Only its hash is stored; Prefix identifies it in listings.
+type PersonalAccessToken struct {
+  ID         string
+  UserID     string
+  Name       string
+  Prefix     string
+  Scopes     []string
+  CreatedAt  time.Time
+  LastUsedAt *time.Time
+  ExpiresAt  *time.Time
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Ban blocks a user site-wide, or within one community when CommunityID is
+// set. A ban without ExpiresAt lasts until it is revoked.
+type Ban struct {
+  ID          string
+  UserID      string
+  CommunityID *string
+  Reason      string
+  BannedBy    *string
+  CreatedAt   time.Time
+  ExpiresAt   *time.Time
+}
+
+// AccountStatus is what authentication needs to know about a user on
+// every request.
+type AccountStatus struct {
+  UserID        string
+  Role          string
+  EmailVerified bool
+  SiteBan       *Ban
+}
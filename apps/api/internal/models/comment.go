@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type Comment struct {
+  ID        string
+  PostID    string
+  ParentID  *string
+  UserID    string
+  Body      string
+  CreatedAt time.Time
+}
+
+type CommentWithAuthor struct {
+  Comment
+  AuthorUsername string
+  Depth          int
+  ReplyCount     int
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+  CommunityPublic     = "public"
+  CommunityRestricted = "restricted"
+  CommunityPrivate    = "private"
+
+  CommunityRoleOwner     = "owner"
+  CommunityRoleModerator = "moderator"
+  CommunityRoleMember    = "member"
+)
+
+type Community struct {
+  ID          string
+  Slug        string
+  Name        string
+  Description string
+  Visibility  string
+  OwnerID     string
+  CreatedAt   time.Time
+}
+
+type CommunityWithStats struct {
+  Community
+  MemberCount  int
+  ViewerRole   *string
+  IsSubscribed bool
+}
+
+type CommunityMember struct {
+  UserID    string
+  Username  string
+  Role      string
+  CreatedAt time.Time
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+  ExportPending = "pending"
+  ExportReady   = "ready"
+  ExportFailed  = "failed"
+)
+
+type DataExport struct {
+  ID          string
+  UserID      string
+  Status      string
+  CreatedAt   time.Time
+  CompletedAt *time.Time
+  ExpiresAt   *time.Time
+}
+
+type UserVote struct {
+  PostID    string
+  Value     int
+  CreatedAt time.Time
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Identity links a user to an account at an external OpenID Connect
+// provider.
+type Identity struct {
+  ID          string
+  UserID      string
+  Provider    string
+  Subject     string
+  Email       string
+  CreatedAt   time.Time
+  LastLoginAt *time.Time
+}
+
+// OIDCLoginState is what a login remembers between sending the browser to
+// the provider and handling its redirect back. LinkUserID is set when a
+// signed-in user is connecting a new identity.
+type OIDCLoginState struct {
+  Provider     string
+  Nonce        string
+  CodeVerifier string
+  LinkUserID   *string
+}
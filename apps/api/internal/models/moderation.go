@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+var ReportReasons = []string{"spam", "harassment", "hate", "violence", "sexual", "misinformation", "self_harm", "other"}
+
+const (
+  ModActionRemove  = "remove"
+  ModActionApprove = "approve"
+  ModActionLock    = "lock"
+  ModActionUnlock  = "unlock"
+  ModActionPin     = "pin"
+  ModActionUnpin   = "unpin"
+  ModActionDismiss = "dismiss"
+)
+
+type Report struct {
+  ID         string
+  PostID     string
+  ReporterID string
+  Reason     string
+  Details    string
+  Status     string
+  CreatedAt  time.Time
+}
+
+// ReportGroup collects the open reports filed against one post.
+type ReportGroup struct {
+  PostID          string
+  PostTitle       string
+  AuthorID        string
+  AuthorUsername  string
+  ReportCount     int
+  Reasons         []string
+  FirstReportedAt time.Time
+  LastReportedAt  time.Time
+}
+
+type ModerationLogEntry struct {
+  ID          string
+  CommunityID *string
+  ModeratorID string
+  Action      string
+  TargetType  string
+  TargetID    string
+  Reason      string
+  CreatedAt   time.Time
+}
@@ -3,17 +3,45 @@ package models
 import "time"
 
 type Post struct {
-  ID        string
-  UserID    string
-  Title     string
-  Body      string
-  CreatedAt time.Time
+  ID          string
+  UserID      string
+  CommunityID *string
+  Title       string
+  Body        string
+  CreatedAt   time.Time
+  EditedAt    *time.Time
+  DeletedAt   *time.Time
+  RemovedAt   *time.Time
+  LockedAt    *time.Time
+  PinnedAt    *time.Time
 }
 
 type PostWithStats struct {
   Post
-  AuthorEmail    string
   AuthorUsername string
   Score          int
+  Upvotes        int
+  Downvotes      int
   MyVote         int
+  CommentCount   int
+  HotRank        float64
+  CommunitySlug  *string
+  CommunityName  *string
+}
+
+type PostRevision struct {
+  ID        string
+  PostID    string
+  Title     string
+  Body      string
+  CreatedAt time.Time
+}
+
+// VoteTally is a post's vote counts right after a vote, with the voter's
+// current vote.
+type VoteTally struct {
+  Score     int
+  Upvotes   int
+  Downvotes int
+  MyVote    int
 }
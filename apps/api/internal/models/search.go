@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+  SearchResultPost    = "post"
+  SearchResultComment = "comment"
+)
+
+type SearchResult struct {
+  Kind           string
+  ID             string
+  PostID         string
+  Title          string
+  Snippet        string
+  Rank           float64
+  CreatedAt      time.Time
+  UserID         string
+  AuthorUsername string
+  CommunityID    *string
+  CommunitySlug  *string
+  CommunityName  *string
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Session is one signed-in device. Access tokens carry the session ID and
+// stop working as soon as the session is revoked.
+type Session struct {
+  ID         string
+  UserID     string
+  UserAgent  string
+  IP         string
+  CreatedAt  time.Time
+  LastSeenAt time.Time
+  ExpiresAt  time.Time
+}
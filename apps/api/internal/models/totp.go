@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// TOTP is a user's authenticator app enrollment. A secret without EnabledAt
+// is still waiting for the user to confirm a code.
+type TOTP struct {
+  Secret    string
+  EnabledAt *time.Time
+  LastStep  int64
+}
@@ -3,9 +3,52 @@ package models
 import "time"
 
 type User struct {
-  ID           string
-  Email        string
-  Username     string
-  PasswordHash string
-  CreatedAt    time.Time
+  ID                string
+  Email             string
+  Username          string
+  PasswordHash      string
+  Role              string
+  EmailVerifiedAt   *time.Time
+  TOTPEnabledAt     *time.Time
+  UsernameChangedAt *time.Time
+  DisplayName       string
+  Bio               string
+  AvatarURL         string
+  // DeleteAfter is set while the account is scheduled for deletion.
+  DeleteAfter *time.Time
+  CreatedAt   time.Time
+  UpdatedAt   time.Time
+}
+
+// UserProfile is the public face of an account.
+type UserProfile struct {
+  ID          string
+  Username    string
+  DisplayName string
+  Bio         string
+  AvatarURL   string
+  CreatedAt   time.Time
+  // PostKarma and CommentKarma are the sums of the votes on the user's
+  // posts and comments. Comments can't be voted on yet, so nothing writes
+  // CommentKarma and it stays 0.
+  PostKarma    int
+  CommentKarma int
+}
+
+// ProfileComment is a comment listed on its author's profile, with enough
+// about its post to link to it.
+type ProfileComment struct {
+  Comment
+  PostTitle     string
+  PostDeleted   bool
+  PostRemoved   bool
+  CommunityID   *string
+  CommunitySlug *string
+  CommunityName *string
+}
+
+// VotedPost is a post the user voted on, for their own vote history.
+type VotedPost struct {
+  PostWithStats
+  VotedAt time.Time
 }
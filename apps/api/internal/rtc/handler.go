@@ -1,6 +1,7 @@
 package rtc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
@@ -12,25 +13,35 @@ import (
 	"github.com/pion/webrtc/v3"
 
 	"jabber_v3/apps/api/internal/auth"
+	"jabber_v3/apps/api/internal/models"
+	"jabber_v3/apps/api/internal/store"
 )
 
+// AccountChecker reports whether a token's user and session are still
+// active and whether the user is banned.
+type AccountChecker interface {
+	GetAccountStatus(ctx context.Context, userID string, sessionID string) (models.AccountStatus, error)
+}
+
 type Handler struct {
-	jwt    auth.JWTManager
-	rooms  *RoomManager
-	api    webrtc.API
-	config webrtc.Configuration
+	jwt      auth.JWTManager
+	accounts AccountChecker
+	rooms    *RoomManager
+	api      webrtc.API
+	config   webrtc.Configuration
 }
 
-func NewHandler(jwt auth.JWTManager, rooms *RoomManager) *Handler {
+func NewHandler(jwt auth.JWTManager, accounts AccountChecker, rooms *RoomManager) *Handler {
 	mediaEngine := &webrtc.MediaEngine{}
 	mediaEngine.RegisterDefaultCodecs()
 
 	api := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine))
 
 	return &Handler{
-		jwt:   jwt,
-		rooms: rooms,
-		api:   *api,
+		jwt:      jwt,
+		accounts: accounts,
+		rooms:    rooms,
+		api:      *api,
 		config: webrtc.Configuration{
 			ICEServers: []webrtc.ICEServer{
 				{URLs: []string{"stun:stun.l.google.com:19302"}},
@@ -67,6 +78,20 @@ func (h *Handler) ServeWS(w http.ResponseWriter, r *http.Request, roomID string)
 		return
 	}
 
+	status, err := h.accounts.GetAccountStatus(r.Context(), claims.UserID, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "invalid_token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "auth_failed", http.StatusInternalServerError)
+		return
+	}
+	if status.SiteBan != nil {
+		http.Error(w, "banned", http.StatusForbidden)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("rtc upgrade error: %v", err)
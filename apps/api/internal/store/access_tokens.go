@@ -0,0 +1,139 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "strings"
+  "time"
+
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+type AccessTokenStore struct {
+  db *sql.DB
+}
+
+var accessTokenColumns = []string{
+  "id",
+  "user_id",
+  "name",
+  "token_prefix",
+  "array_to_string(scopes, ' ')",
+  "created_at",
+  "last_used_at",
+  "expires_at",
+}
+
+const activeAccessTokenCondition = "revoked_at is null and (expires_at is null or expires_at > now())"
+
+// lastUsedResolution limits how often using a token writes last_used_at.
+const lastUsedResolution = time.Minute
+
+func (s *AccessTokenStore) CreateToken(ctx context.Context, userID string, name string, tokenHash string, prefix string, scopes []string, expiresAt *time.Time) (models.PersonalAccessToken, error) {
+  query, args := qb.Insert("personal_access_tokens").
+    Columns("user_id", "name", "token_hash", "token_prefix", "scopes", "expires_at").
+    Values(userID, name, tokenHash, prefix, scopes, expiresAt).
+    Returning(accessTokenColumns...).
+    Build()
+  return scanAccessToken(s.db.QueryRowContext(ctx, query, args...))
+}
+
+func (s *AccessTokenStore) ListTokens(ctx context.Context, userID string) ([]models.PersonalAccessToken, error) {
+  query, args := qb.Select(accessTokenColumns...).
+    From("personal_access_tokens").
+    WhereEq("user_id", userID).
+    Where(activeAccessTokenCondition).
+    OrderBy("created_at desc").
+    Build()
+
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var tokens []models.PersonalAccessToken
+  for rows.Next() {
+    token, err := scanAccessToken(rows)
+    if err != nil {
+      return nil, err
+    }
+    tokens = append(tokens, token)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return tokens, nil
+}
+
+func (s *AccessTokenStore) RevokeToken(ctx context.Context, userID string, tokenID string) error {
+  query, args := qb.Update("personal_access_tokens").
+    Set("revoked_at", time.Now()).
+    WhereEq("id", tokenID).
+    WhereEq("user_id", userID).
+    Where("revoked_at is null").
+    Build()
+  return execAffectingOne(ctx, s.db, query, args)
+}
+
+// Authenticate resolves an active token to its owner's account status and
+// the token's ID and scopes. It returns ErrNotFound for unknown, revoked or
+// expired tokens.
+func (s *AccessTokenStore) Authenticate(ctx context.Context, tokenHash string) (models.AccountStatus, string, []string, error) {
+  query := `
+    select ` + accountStatusColumns + `,
+      t.id,
+      array_to_string(t.scopes, ' ')
+    from ` + accountStatusFrom + `
+    join personal_access_tokens t on t.user_id = u.id
+    where t.token_hash = $1
+      and t.revoked_at is null
+      and (t.expires_at is null or t.expires_at > now())`
+
+  var tokenID, scopes string
+  status, err := scanAccountStatus(s.db.QueryRowContext(ctx, query, tokenHash), &tokenID, &scopes)
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.AccountStatus{}, "", nil, ErrNotFound
+  }
+  if err != nil {
+    return models.AccountStatus{}, "", nil, err
+  }
+  return status, tokenID, strings.Fields(scopes), nil
+}
+
+// TouchLastUsed records that the token was just used, at most once per
+// lastUsedResolution.
+func (s *AccessTokenStore) TouchLastUsed(ctx context.Context, tokenID string) error {
+  query, args := qb.Update("personal_access_tokens").
+    Set("last_used_at", time.Now()).
+    WhereEq("id", tokenID).
+    Where("(last_used_at is null or last_used_at < ?)", time.Now().Add(-lastUsedResolution)).
+    Build()
+  _, err := s.db.ExecContext(ctx, query, args...)
+  return err
+}
+
+func scanAccessToken(row rowScanner) (models.PersonalAccessToken, error) {
+  var token models.PersonalAccessToken
+  var scopes string
+  var lastUsedAt, expiresAt sql.NullTime
+  err := row.Scan(
+    &token.ID,
+    &token.UserID,
+    &token.Name,
+    &token.Prefix,
+    &scopes,
+    &token.CreatedAt,
+    &lastUsedAt,
+    &expiresAt,
+  )
+  if err != nil {
+    return models.PersonalAccessToken{}, err
+  }
+  token.Scopes = strings.Fields(scopes)
+  token.LastUsedAt = nullTimePtr(lastUsedAt)
+  token.ExpiresAt = nullTimePtr(expiresAt)
+  return token, nil
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "time"
+
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+const (
+  TokenPasswordReset     = "password_reset"
+  TokenEmailVerification = "email_verification"
+  TokenEmailChange       = "email_change"
+)
+
+type AccountTokenStore struct {
+  db *sql.DB
+}
+
+// CreateToken stores a new token for the user and invalidates any earlier
+// unused token with the same purpose, so only the latest mail works.
+func (s *AccountTokenStore) CreateToken(ctx context.Context, userID string, purpose string, tokenHash string, expiresAt time.Time) error {
+  return s.createToken(ctx, userID, purpose, tokenHash, expiresAt, nil)
+}
+
+// CreateEmailChangeToken is CreateToken for confirming newEmail.
+func (s *AccountTokenStore) CreateEmailChangeToken(ctx context.Context, userID string, newEmail string, tokenHash string, expiresAt time.Time) error {
+  return s.createToken(ctx, userID, TokenEmailChange, tokenHash, expiresAt, &newEmail)
+}
+
+func (s *AccountTokenStore) createToken(ctx context.Context, userID string, purpose string, tokenHash string, expiresAt time.Time, newEmail *string) error {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  expire, expireArgs := qb.Update("account_tokens").
+    Set("used_at", time.Now()).
+    WhereEq("user_id", userID).
+    WhereEq("purpose", purpose).
+    Where("used_at is null").
+    Build()
+  if _, err := tx.ExecContext(ctx, expire, expireArgs...); err != nil {
+    return err
+  }
+
+  query, args := qb.Insert("account_tokens").
+    Columns("user_id", "purpose", "token_hash", "expires_at", "new_email").
+    Values(userID, purpose, tokenHash, expiresAt, newEmail).
+    Build()
+  if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+    return err
+  }
+
+  return tx.Commit()
+}
+
+// GetTokenUserID returns the user of an unexpired, unused token without
+// redeeming it, or ErrNotFound.
+func (s *AccountTokenStore) GetTokenUserID(ctx context.Context, purpose string, tokenHash string) (string, error) {
+  query, args := qb.Select("user_id").
+    From("account_tokens").
+    WhereEq("token_hash", tokenHash).
+    WhereEq("purpose", purpose).
+    Where("used_at is null and expires_at > now()").
+    Build()
+
+  var userID string
+  err := s.db.QueryRowContext(ctx, query, args...).Scan(&userID)
+  if errors.Is(err, sql.ErrNoRows) {
+    return "", ErrNotFound
+  }
+  if err != nil {
+    return "", err
+  }
+  return userID, nil
+}
+
+// ResetPassword redeems a reset token, sets the new password hash and signs
+// the user out everywhere.
+func (s *AccountTokenStore) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) error {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  userID, err := consumeToken(ctx, tx, TokenPasswordReset, tokenHash)
+  if err != nil {
+    return err
+  }
+
+  query, args := qb.Update("users").
+    Set("password_hash", passwordHash).
+    WhereEq("id", userID).
+    Build()
+  if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+    return err
+  }
+
+  revoke, revokeArgs := qb.Update("sessions").
+    Set("revoked_at", time.Now()).
+    WhereEq("user_id", userID).
+    Where("revoked_at is null").
+    Build()
+  if _, err := tx.ExecContext(ctx, revoke, revokeArgs...); err != nil {
+    return err
+  }
+
+  return tx.Commit()
+}
+
+// VerifyEmail redeems a verification token and marks the address verified.
+func (s *AccountTokenStore) VerifyEmail(ctx context.Context, tokenHash string) error {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  userID, err := consumeToken(ctx, tx, TokenEmailVerification, tokenHash)
+  if err != nil {
+    return err
+  }
+
+  query, args := qb.Update("users").
+    Set("email_verified_at", time.Now()).
+    WhereEq("id", userID).
+    Where("email_verified_at is null").
+    Build()
+  if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+    return err
+  }
+
+  return tx.Commit()
+}
+
+// ChangeEmail redeems an email change token and moves the user to the new,
+// now verified, address. It returns the user ID and the previous address.
+// A unique violation means the address was taken after the token was sent.
+func (s *AccountTokenStore) ChangeEmail(ctx context.Context, tokenHash string) (string, string, error) {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return "", "", err
+  }
+  defer tx.Rollback()
+
+  userID, err := consumeToken(ctx, tx, TokenEmailChange, tokenHash)
+  if err != nil {
+    return "", "", err
+  }
+
+  var oldEmail string
+  if err := tx.QueryRowContext(ctx, "select email from users where id = $1 for update", userID).Scan(&oldEmail); err != nil {
+    return "", "", err
+  }
+
+  query := `
+    update users
+    set email = t.new_email, email_verified_at = now()
+    from account_tokens t
+    where t.token_hash = $1 and users.id = $2`
+  if _, err := tx.ExecContext(ctx, query, tokenHash, userID); err != nil {
+    return "", "", err
+  }
+
+  if err := tx.Commit(); err != nil {
+    return "", "", err
+  }
+  return userID, oldEmail, nil
+}
+
+// consumeToken marks an unexpired, unused token as used and returns its
+// user. It returns ErrNotFound for unknown, expired or spent tokens.
+func consumeToken(ctx context.Context, tx *sql.Tx, purpose string, tokenHash string) (string, error) {
+  query, args := qb.Update("account_tokens").
+    Set("used_at", time.Now()).
+    WhereEq("token_hash", tokenHash).
+    WhereEq("purpose", purpose).
+    Where("used_at is null and expires_at > now()").
+    Returning("user_id").
+    Build()
+
+  var userID string
+  err := tx.QueryRowContext(ctx, query, args...).Scan(&userID)
+  if errors.Is(err, sql.ErrNoRows) {
+    return "", ErrNotFound
+  }
+  if err != nil {
+    return "", err
+  }
+  return userID, nil
+}
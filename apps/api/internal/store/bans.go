@@ -0,0 +1,152 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "time"
+
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+type BanStore struct {
+  db *sql.DB
+}
+
+var banColumns = []string{"id", "user_id", "community_id", "reason", "banned_by", "created_at", "expires_at"}
+
+const activeBanCondition = "revoked_at is null and (expires_at is null or expires_at > now())"
+
+// CreateBan records the ban and its moderation log entry together.
+func (s *BanStore) CreateBan(ctx context.Context, userID string, communityID *string, reason string, bannedBy string, expiresAt *time.Time) (models.Ban, error) {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return models.Ban{}, err
+  }
+  defer tx.Rollback()
+
+  query, args := qb.Insert("bans").
+    Columns("user_id", "community_id", "reason", "banned_by", "expires_at").
+    Values(userID, communityID, reason, bannedBy, expiresAt).
+    Returning(banColumns...).
+    Build()
+  ban, err := scanBan(tx.QueryRowContext(ctx, query, args...))
+  if err != nil {
+    return models.Ban{}, err
+  }
+
+  if _, err := insertModerationLog(ctx, tx, communityID, bannedBy, "ban", "user", userID, reason); err != nil {
+    return models.Ban{}, err
+  }
+
+  if err := tx.Commit(); err != nil {
+    return models.Ban{}, err
+  }
+  return ban, nil
+}
+
+// RevokeBan lifts an active ban. The community must match so that a
+// moderator cannot lift bans issued elsewhere.
+func (s *BanStore) RevokeBan(ctx context.Context, banID string, communityID *string, revokedBy string) error {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  builder := qb.Update("bans").
+    Set("revoked_at", time.Now()).
+    WhereEq("id", banID).
+    Where("revoked_at is null")
+  if communityID != nil {
+    builder.WhereEq("community_id", *communityID)
+  } else {
+    builder.Where("community_id is null")
+  }
+  query, args := builder.Returning("user_id").Build()
+
+  var userID string
+  err = tx.QueryRowContext(ctx, query, args...).Scan(&userID)
+  if errors.Is(err, sql.ErrNoRows) {
+    return ErrNotFound
+  }
+  if err != nil {
+    return err
+  }
+
+  if _, err := insertModerationLog(ctx, tx, communityID, revokedBy, "unban", "user", userID, ""); err != nil {
+    return err
+  }
+
+  return tx.Commit()
+}
+
+// GetActiveBan returns the longest-lasting active ban of a user, site-wide
+// when communityID is nil.
+func (s *BanStore) GetActiveBan(ctx context.Context, userID string, communityID *string) (models.Ban, error) {
+  builder := qb.Select(banColumns...).
+    From("bans").
+    WhereEq("user_id", userID).
+    Where(activeBanCondition)
+  if communityID != nil {
+    builder.WhereEq("community_id", *communityID)
+  } else {
+    builder.Where("community_id is null")
+  }
+  query, args := builder.OrderBy("expires_at desc nulls first").Limit(1).Build()
+
+  ban, err := scanBan(s.db.QueryRowContext(ctx, query, args...))
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.Ban{}, ErrNotFound
+  }
+  if err != nil {
+    return models.Ban{}, err
+  }
+  return ban, nil
+}
+
+func (s *BanStore) ListActiveBans(ctx context.Context, communityID *string) ([]models.Ban, error) {
+  builder := qb.Select(banColumns...).
+    From("bans").
+    Where(activeBanCondition)
+  if communityID != nil {
+    builder.WhereEq("community_id", *communityID)
+  } else {
+    builder.Where("community_id is null")
+  }
+  query, args := builder.OrderBy("created_at desc").Build()
+
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var bans []models.Ban
+  for rows.Next() {
+    ban, err := scanBan(rows)
+    if err != nil {
+      return nil, err
+    }
+    bans = append(bans, ban)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return bans, nil
+}
+
+func scanBan(row rowScanner) (models.Ban, error) {
+  var ban models.Ban
+  var communityID, bannedBy sql.NullString
+  var expiresAt sql.NullTime
+  err := row.Scan(&ban.ID, &ban.UserID, &communityID, &ban.Reason, &bannedBy, &ban.CreatedAt, &expiresAt)
+  if err != nil {
+    return models.Ban{}, err
+  }
+  ban.CommunityID = nullStringPtr(communityID)
+  ban.BannedBy = nullStringPtr(bannedBy)
+  ban.ExpiresAt = nullTimePtr(expiresAt)
+  return ban, nil
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+type CommentStore struct {
+  db *sql.DB
+}
+
+var commentColumns = []string{"id", "post_id", "parent_id", "user_id", "body", "created_at"}
+
+func (s *CommentStore) CreateComment(ctx context.Context, postID string, parentID *string, userID string, body string) (models.Comment, error) {
+  query, args := qb.Insert("comments").
+    Columns("post_id", "parent_id", "user_id", "body").
+    Values(postID, parentID, userID, body).
+    Returning(commentColumns...).
+    Build()
+  row := s.db.QueryRowContext(ctx, query, args...)
+  comment, err := scanComment(row)
+  if err != nil {
+    return models.Comment{}, err
+  }
+  return comment, nil
+}
+
+func (s *CommentStore) GetCommentByID(ctx context.Context, commentID string) (models.Comment, error) {
+  query, args := qb.Select(commentColumns...).
+    From("comments").
+    WhereEq("id", commentID).
+    Build()
+  row := s.db.QueryRowContext(ctx, query, args...)
+  comment, err := scanComment(row)
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.Comment{}, ErrNotFound
+  }
+  if err != nil {
+    return models.Comment{}, err
+  }
+  return comment, nil
+}
+
+// ListThread walks the reply tree of a post breadth-first, starting either
+// from its top-level comments (paged by limit/after) or from a single
+// comment when rootID is set. Nodes deeper than maxDepth are not returned;
+// their parents report them through ReplyCount so clients can load more.
+func (s *CommentStore) ListThread(ctx context.Context, postID string, rootID *string, maxDepth int, limit int, after *string) ([]models.CommentWithAuthor, error) {
+  var anchor string
+  args := []any{postID, maxDepth}
+  if rootID != nil {
+    anchor = `
+      select c.id, c.post_id, c.parent_id, c.user_id, c.body, c.created_at
+      from comments c
+      where c.post_id = $1 and c.id = $3`
+    args = append(args, *rootID)
+  } else {
+    anchor = `
+      select c.id, c.post_id, c.parent_id, c.user_id, c.body, c.created_at
+      from comments c
+      where c.post_id = $1
+        and c.parent_id is null
+        and ($3::uuid is null or (c.created_at, c.id) > (
+          select a.created_at, a.id from comments a where a.id = $3::uuid
+        ))
+      order by c.created_at, c.id
+      limit $4`
+    args = append(args, after, limit)
+  }
+
+  query := `
+    with recursive thread as (
+      select a.*, 0 as depth from (` + anchor + `
+      ) a
+      union all
+      select c.id, c.post_id, c.parent_id, c.user_id, c.body, c.created_at, t.depth + 1
+      from comments c
+      join thread t on c.parent_id = t.id
+      where t.depth < $2
+    )
+    select
+      t.id,
+      t.post_id,
+      t.parent_id,
+      t.user_id,
+      t.body,
+      t.created_at,
+      u.username,
+      t.depth,
+      (select count(*) from comments r where r.parent_id = t.id) as reply_count
+    from thread t
+    join users u on u.id = t.user_id
+    order by t.depth, t.created_at, t.id`
+
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var comments []models.CommentWithAuthor
+  for rows.Next() {
+    comment, err := scanCommentWithAuthor(rows)
+    if err != nil {
+      return nil, err
+    }
+    comments = append(comments, comment)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return comments, nil
+}
+
+func scanComment(row rowScanner) (models.Comment, error) {
+  var comment models.Comment
+  var parentID sql.NullString
+  err := row.Scan(&comment.ID, &comment.PostID, &parentID, &comment.UserID, &comment.Body, &comment.CreatedAt)
+  if err != nil {
+    return models.Comment{}, err
+  }
+  if parentID.Valid {
+    comment.ParentID = &parentID.String
+  }
+  return comment, nil
+}
+
+func scanCommentWithAuthor(row rowScanner) (models.CommentWithAuthor, error) {
+  var comment models.CommentWithAuthor
+  var parentID sql.NullString
+  err := row.Scan(
+    &comment.ID,
+    &comment.PostID,
+    &parentID,
+    &comment.UserID,
+    &comment.Body,
+    &comment.CreatedAt,
+    &comment.AuthorUsername,
+    &comment.Depth,
+    &comment.ReplyCount,
+  )
+  if err != nil {
+    return models.CommentWithAuthor{}, err
+  }
+  if parentID.Valid {
+    comment.ParentID = &parentID.String
+  }
+  return comment, nil
+}
@@ -0,0 +1,320 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+type CommunityStore struct {
+  db *sql.DB
+}
+
+var communityColumns = []string{"id", "slug", "name", "description", "visibility", "owner_id", "created_at"}
+
+// CreateCommunity inserts the community and makes its creator the owning
+// member and a subscriber in one transaction.
+func (s *CommunityStore) CreateCommunity(ctx context.Context, slug string, name string, description string, visibility string, ownerID string) (models.Community, error) {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return models.Community{}, err
+  }
+  defer tx.Rollback()
+
+  query, args := qb.Insert("communities").
+    Columns("slug", "name", "description", "visibility", "owner_id").
+    Values(slug, name, description, visibility, ownerID).
+    Returning(communityColumns...).
+    Build()
+  community, err := scanCommunity(tx.QueryRowContext(ctx, query, args...))
+  if err != nil {
+    return models.Community{}, err
+  }
+
+  query, args = qb.Insert("community_members").
+    Columns("community_id", "user_id", "role").
+    Values(community.ID, ownerID, models.CommunityRoleOwner).
+    Build()
+  if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+    return models.Community{}, err
+  }
+
+  query, args = qb.Insert("community_subscriptions").
+    Columns("community_id", "user_id").
+    Values(community.ID, ownerID).
+    Build()
+  if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+    return models.Community{}, err
+  }
+
+  if err := tx.Commit(); err != nil {
+    return models.Community{}, err
+  }
+  return community, nil
+}
+
+func (s *CommunityStore) GetCommunityBySlug(ctx context.Context, slug string) (models.Community, error) {
+  query, args := qb.Select(communityColumns...).
+    From("communities").
+    WhereEq("slug", slug).
+    Build()
+  community, err := scanCommunity(s.db.QueryRowContext(ctx, query, args...))
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.Community{}, ErrNotFound
+  }
+  if err != nil {
+    return models.Community{}, err
+  }
+  return community, nil
+}
+
+func (s *CommunityStore) GetCommunityWithStats(ctx context.Context, slug string, viewerID *string) (models.CommunityWithStats, error) {
+  query, args := selectCommunitiesWithStats(viewerID).
+    Where("c.slug = ?", slug).
+    Build()
+  community, err := scanCommunityWithStats(s.db.QueryRowContext(ctx, query, args...))
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.CommunityWithStats{}, ErrNotFound
+  }
+  if err != nil {
+    return models.CommunityWithStats{}, err
+  }
+  return community, nil
+}
+
+// ListCommunities pages through communities by slug. Private communities
+// are only listed for their members.
+func (s *CommunityStore) ListCommunities(ctx context.Context, viewerID *string, limit int, afterSlug *string) ([]models.CommunityWithStats, error) {
+  builder := selectCommunitiesWithStats(viewerID).
+    Where("(c.visibility <> 'private' or vm.role is not null)")
+  if afterSlug != nil {
+    builder.Where("c.slug > ?", *afterSlug)
+  }
+  query, args := builder.OrderBy("c.slug").Limit(limit).Build()
+
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var communities []models.CommunityWithStats
+  for rows.Next() {
+    community, err := scanCommunityWithStats(rows)
+    if err != nil {
+      return nil, err
+    }
+    communities = append(communities, community)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return communities, nil
+}
+
+func (s *CommunityStore) GetMemberRole(ctx context.Context, communityID string, userID string) (string, error) {
+  query, args := qb.Select("role").
+    From("community_members").
+    WhereEq("community_id", communityID).
+    WhereEq("user_id", userID).
+    Build()
+  var role string
+  err := s.db.QueryRowContext(ctx, query, args...).Scan(&role)
+  if errors.Is(err, sql.ErrNoRows) {
+    return "", ErrNotFound
+  }
+  if err != nil {
+    return "", err
+  }
+  return role, nil
+}
+
+// ListModeratedCommunityIDs returns the communities userID owns or
+// moderates.
+func (s *CommunityStore) ListModeratedCommunityIDs(ctx context.Context, userID string) ([]string, error) {
+  query := `
+    select community_id
+    from community_members
+    where user_id = $1 and role in ($2, $3)`
+  rows, err := s.db.QueryContext(ctx, query, userID, models.CommunityRoleOwner, models.CommunityRoleModerator)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var ids []string
+  for rows.Next() {
+    var id string
+    if err := rows.Scan(&id); err != nil {
+      return nil, err
+    }
+    ids = append(ids, id)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return ids, nil
+}
+
+func (s *CommunityStore) AddMember(ctx context.Context, communityID string, userID string) error {
+  query := `
+    insert into community_members (community_id, user_id, role)
+    values ($1, $2, $3)
+    on conflict (community_id, user_id) do nothing`
+  _, err := s.db.ExecContext(ctx, query, communityID, userID, models.CommunityRoleMember)
+  return err
+}
+
+func (s *CommunityStore) Subscribe(ctx context.Context, communityID string, userID string) error {
+  query := `
+    insert into community_subscriptions (community_id, user_id)
+    values ($1, $2)
+    on conflict (user_id, community_id) do nothing`
+  _, err := s.db.ExecContext(ctx, query, communityID, userID)
+  return err
+}
+
+// Leave drops both the membership and the subscription.
+func (s *CommunityStore) Leave(ctx context.Context, communityID string, userID string) error {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  query, args := qb.Delete("community_members").
+    WhereEq("community_id", communityID).
+    WhereEq("user_id", userID).
+    Build()
+  if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+    return err
+  }
+
+  query, args = qb.Delete("community_subscriptions").
+    WhereEq("community_id", communityID).
+    WhereEq("user_id", userID).
+    Build()
+  if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+    return err
+  }
+
+  return tx.Commit()
+}
+
+func (s *CommunityStore) HasSubscriptions(ctx context.Context, userID string) (bool, error) {
+  query := `select exists (select 1 from community_subscriptions where user_id = $1)`
+  var exists bool
+  if err := s.db.QueryRowContext(ctx, query, userID).Scan(&exists); err != nil {
+    return false, err
+  }
+  return exists, nil
+}
+
+func selectCommunitiesWithStats(viewerID *string) *qb.SelectBuilder {
+  return qb.Select(
+    "c.id",
+    "c.slug",
+    "c.name",
+    "c.description",
+    "c.visibility",
+    "c.owner_id",
+    "c.created_at",
+    "(select count(*) from community_members m where m.community_id = c.id) as member_count",
+    "vm.role",
+    "vs.user_id is not null as is_subscribed",
+  ).
+    From("communities c").
+    Join("left join community_members vm on vm.community_id = c.id and vm.user_id = ?", viewerID).
+    Join("left join community_subscriptions vs on vs.community_id = c.id and vs.user_id = ?", viewerID)
+}
+
+func scanCommunity(row rowScanner) (models.Community, error) {
+  var community models.Community
+  err := row.Scan(
+    &community.ID,
+    &community.Slug,
+    &community.Name,
+    &community.Description,
+    &community.Visibility,
+    &community.OwnerID,
+    &community.CreatedAt,
+  )
+  if err != nil {
+    return models.Community{}, err
+  }
+  return community, nil
+}
+
+func scanCommunityWithStats(row rowScanner) (models.CommunityWithStats, error) {
+  var community models.CommunityWithStats
+  var role sql.NullString
+  err := row.Scan(
+    &community.ID,
+    &community.Slug,
+    &community.Name,
+    &community.Description,
+    &community.Visibility,
+    &community.OwnerID,
+    &community.CreatedAt,
+    &community.MemberCount,
+    &role,
+    &community.IsSubscribed,
+  )
+  if err != nil {
+    return models.CommunityWithStats{}, err
+  }
+  community.ViewerRole = nullStringPtr(role)
+  return community, nil
+}
+
+// SetMemberRole makes userID a member of the community with the given role,
+// promoting or demoting an existing membership.
+func (s *CommunityStore) SetMemberRole(ctx context.Context, communityID string, userID string, role string) error {
+  query := `
+    insert into community_members (community_id, user_id, role)
+    values ($1, $2, $3)
+    on conflict (community_id, user_id)
+    do update set role = excluded.role`
+  _, err := s.db.ExecContext(ctx, query, communityID, userID, role)
+  return err
+}
+
+// DemoteModerator turns a moderator back into a plain member. It returns
+// ErrNotFound when userID is not a moderator of the community.
+func (s *CommunityStore) DemoteModerator(ctx context.Context, communityID string, userID string) error {
+  query := `
+    update community_members
+    set role = $3
+    where community_id = $1 and user_id = $2 and role = $4`
+  return execAffectingOne(ctx, s.db, query, []any{communityID, userID, models.CommunityRoleMember, models.CommunityRoleModerator})
+}
+
+func (s *CommunityStore) ListModerators(ctx context.Context, communityID string) ([]models.CommunityMember, error) {
+  query := `
+    select m.user_id, u.username, m.role, m.created_at
+    from community_members m
+    join users u on u.id = m.user_id
+    where m.community_id = $1 and m.role in ('owner', 'moderator')
+    order by m.created_at`
+  rows, err := s.db.QueryContext(ctx, query, communityID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var members []models.CommunityMember
+  for rows.Next() {
+    var member models.CommunityMember
+    if err := rows.Scan(&member.UserID, &member.Username, &member.Role, &member.CreatedAt); err != nil {
+      return nil, err
+    }
+    members = append(members, member)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return members, nil
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "time"
+
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+// DeletedUserID is the placeholder account that inherits the posts and
+// comments of deleted users. See migration 020.
+const DeletedUserID = "00000000-0000-0000-0000-000000000000"
+
+// ScheduleDeletion marks the account for deletion at deleteAfter and signs
+// it out everywhere, including personal access tokens.
+func (s *UserStore) ScheduleDeletion(ctx context.Context, userID string, deleteAfter time.Time) error {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  query, args := qb.Update("users").
+    Set("delete_after", deleteAfter).
+    WhereEq("id", userID).
+    Where("id <> ?", DeletedUserID).
+    Build()
+  if err := execAffectingOne(ctx, tx, query, args); err != nil {
+    return err
+  }
+
+  now := time.Now()
+  for _, table := range []string{"sessions", "personal_access_tokens"} {
+    revoke, revokeArgs := qb.Update(table).
+      Set("revoked_at", now).
+      WhereEq("user_id", userID).
+      Where("revoked_at is null").
+      Build()
+    if _, err := tx.ExecContext(ctx, revoke, revokeArgs...); err != nil {
+      return err
+    }
+  }
+
+  return tx.Commit()
+}
+
+func (s *UserStore) CancelDeletion(ctx context.Context, userID string) error {
+  query, args := qb.Update("users").
+    Set("delete_after", nil).
+    WhereEq("id", userID).
+    Build()
+  _, err := s.db.ExecContext(ctx, query, args...)
+  return err
+}
+
+// ListDueDeletions returns up to limit accounts whose grace period ended
+// before now.
+func (s *UserStore) ListDueDeletions(ctx context.Context, now time.Time, limit int) ([]string, error) {
+  query, args := qb.Select("id").
+    From("users").
+    Where("delete_after <= ?", now).
+    OrderBy("delete_after").
+    Limit(limit).
+    Build()
+
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var ids []string
+  for rows.Next() {
+    var id string
+    if err := rows.Scan(&id); err != nil {
+      return nil, err
+    }
+    ids = append(ids, id)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return ids, nil
+}
+
+// PurgeAccount deletes an account whose grace period is over. Communities
+// it owns pass to their longest-serving moderator, else their oldest
+// member, else the placeholder; its posts and comments are reassigned to
+// the placeholder. Everything else about the user cascades away. It returns
+// ErrNotFound when the deletion was cancelled in the meantime.
+func (s *UserStore) PurgeAccount(ctx context.Context, userID string) error {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  var deleteAfter sql.NullTime
+  err = tx.QueryRowContext(ctx, "select delete_after from users where id = $1 for update", userID).Scan(&deleteAfter)
+  if errors.Is(err, sql.ErrNoRows) || (err == nil && (!deleteAfter.Valid || deleteAfter.Time.After(time.Now()))) {
+    return ErrNotFound
+  }
+  if err != nil {
+    return err
+  }
+
+  if err := transferCommunities(ctx, tx, userID); err != nil {
+    return err
+  }
+
+  for _, table := range []string{"posts", "comments"} {
+    query, args := qb.Update(table).
+      Set("user_id", DeletedUserID).
+      WhereEq("user_id", userID).
+      Build()
+    if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+      return err
+    }
+  }
+
+  query, args := qb.Delete("users").
+    WhereEq("id", userID).
+    Build()
+  if err := execAffectingOne(ctx, tx, query, args); err != nil {
+    return err
+  }
+
+  return tx.Commit()
+}
+
+func transferCommunities(ctx context.Context, tx *sql.Tx, userID string) error {
+  query, args := qb.Select("id").
+    From("communities").
+    WhereEq("owner_id", userID).
+    Build()
+  rows, err := tx.QueryContext(ctx, query, args...)
+  if err != nil {
+    return err
+  }
+  var communityIDs []string
+  for rows.Next() {
+    var id string
+    if err := rows.Scan(&id); err != nil {
+      rows.Close()
+      return err
+    }
+    communityIDs = append(communityIDs, id)
+  }
+  rows.Close()
+  if err := rows.Err(); err != nil {
+    return err
+  }
+
+  for _, communityID := range communityIDs {
+    successor := DeletedUserID
+    err := tx.QueryRowContext(ctx, `
+      select user_id
+      from community_members
+      where community_id = $1 and user_id <> $2
+      order by case role when 'moderator' then 0 else 1 end, created_at
+      limit 1`, communityID, userID).Scan(&successor)
+    if err != nil && !errors.Is(err, sql.ErrNoRows) {
+      return err
+    }
+
+    update, updateArgs := qb.Update("communities").
+      Set("owner_id", successor).
+      WhereEq("id", communityID).
+      Build()
+    if _, err := tx.ExecContext(ctx, update, updateArgs...); err != nil {
+      return err
+    }
+    if successor == DeletedUserID {
+      continue
+    }
+    promote, promoteArgs := qb.Update("community_members").
+      Set("role", "owner").
+      WhereEq("community_id", communityID).
+      WhereEq("user_id", successor).
+      Build()
+    if _, err := tx.ExecContext(ctx, promote, promoteArgs...); err != nil {
+      return err
+    }
+  }
+  return nil
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "time"
+
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+type ExportStore struct {
+  db *sql.DB
+}
+
+var exportColumns = []string{"id", "user_id", "status", "created_at", "completed_at", "expires_at"}
+
+func scanExport(row rowScanner) (models.DataExport, error) {
+  var export models.DataExport
+  var completedAt, expiresAt sql.NullTime
+  if err := row.Scan(&export.ID, &export.UserID, &export.Status, &export.CreatedAt, &completedAt, &expiresAt); err != nil {
+    return models.DataExport{}, err
+  }
+  export.CompletedAt = nullTimePtr(completedAt)
+  export.ExpiresAt = nullTimePtr(expiresAt)
+  return export, nil
+}
+
+func (s *ExportStore) CreateExport(ctx context.Context, userID string) (models.DataExport, error) {
+  query, args := qb.Insert("data_exports").
+    Columns("user_id").
+    Values(userID).
+    Returning(exportColumns...).
+    Build()
+  return scanExport(s.db.QueryRowContext(ctx, query, args...))
+}
+
+// GetLatestExport returns the user's most recent export or ErrNotFound.
+func (s *ExportStore) GetLatestExport(ctx context.Context, userID string) (models.DataExport, error) {
+  query, args := qb.Select(exportColumns...).
+    From("data_exports").
+    WhereEq("user_id", userID).
+    OrderBy("created_at desc").
+    Limit(1).
+    Build()
+  export, err := scanExport(s.db.QueryRowContext(ctx, query, args...))
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.DataExport{}, ErrNotFound
+  }
+  return export, err
+}
+
+func (s *ExportStore) GetExport(ctx context.Context, userID string, exportID string) (models.DataExport, error) {
+  query, args := qb.Select(exportColumns...).
+    From("data_exports").
+    WhereEq("id", exportID).
+    WhereEq("user_id", userID).
+    Build()
+  export, err := scanExport(s.db.QueryRowContext(ctx, query, args...))
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.DataExport{}, ErrNotFound
+  }
+  return export, err
+}
+
+// GetArchive returns a ready, unexpired archive or ErrNotFound.
+func (s *ExportStore) GetArchive(ctx context.Context, userID string, exportID string) ([]byte, error) {
+  query, args := qb.Select("archive").
+    From("data_exports").
+    WhereEq("id", exportID).
+    WhereEq("user_id", userID).
+    WhereEq("status", models.ExportReady).
+    Where("expires_at > now()").
+    Build()
+  var archive []byte
+  err := s.db.QueryRowContext(ctx, query, args...).Scan(&archive)
+  if errors.Is(err, sql.ErrNoRows) {
+    return nil, ErrNotFound
+  }
+  return archive, err
+}
+
+func (s *ExportStore) CompleteExport(ctx context.Context, exportID string, archive []byte, expiresAt time.Time) error {
+  query, args := qb.Update("data_exports").
+    Set("status", models.ExportReady).
+    Set("archive", archive).
+    Set("completed_at", time.Now()).
+    Set("expires_at", expiresAt).
+    WhereEq("id", exportID).
+    Build()
+  return execAffectingOne(ctx, s.db, query, args)
+}
+
+func (s *ExportStore) FailExport(ctx context.Context, exportID string) error {
+  query, args := qb.Update("data_exports").
+    Set("status", models.ExportFailed).
+    Set("completed_at", time.Now()).
+    WhereEq("id", exportID).
+    Build()
+  return execAffectingOne(ctx, s.db, query, args)
+}
+
+// PurgeExpiredExports drops archives past their expiry to free space.
+func (s *ExportStore) PurgeExpiredExports(ctx context.Context) (int64, error) {
+  query, args := qb.Delete("data_exports").
+    Where("expires_at <= now()").
+    Build()
+  result, err := s.db.ExecContext(ctx, query, args...)
+  if err != nil {
+    return 0, err
+  }
+  return result.RowsAffected()
+}
+
+// ListAuthoredPosts returns every post the user wrote, including deleted
+// and removed ones, oldest first.
+func (s *ExportStore) ListAuthoredPosts(ctx context.Context, userID string) ([]models.Post, error) {
+  query, args := qb.Select(postColumns...).
+    From("posts").
+    WhereEq("user_id", userID).
+    OrderBy("created_at, id").
+    Build()
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  posts := make([]models.Post, 0)
+  for rows.Next() {
+    post, err := scanPost(rows)
+    if err != nil {
+      return nil, err
+    }
+    posts = append(posts, post)
+  }
+  return posts, rows.Err()
+}
+
+func (s *ExportStore) ListAuthoredComments(ctx context.Context, userID string) ([]models.Comment, error) {
+  query, args := qb.Select(commentColumns...).
+    From("comments").
+    WhereEq("user_id", userID).
+    OrderBy("created_at, id").
+    Build()
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  comments := make([]models.Comment, 0)
+  for rows.Next() {
+    comment, err := scanComment(rows)
+    if err != nil {
+      return nil, err
+    }
+    comments = append(comments, comment)
+  }
+  return comments, rows.Err()
+}
+
+func (s *ExportStore) ListVotes(ctx context.Context, userID string) ([]models.UserVote, error) {
+  query, args := qb.Select("post_id", "value", "created_at").
+    From("post_votes").
+    WhereEq("user_id", userID).
+    OrderBy("created_at, post_id").
+    Build()
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  votes := make([]models.UserVote, 0)
+  for rows.Next() {
+    var vote models.UserVote
+    if err := rows.Scan(&vote.PostID, &vote.Value, &vote.CreatedAt); err != nil {
+      return nil, err
+    }
+    votes = append(votes, vote)
+  }
+  return votes, rows.Err()
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "time"
+
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+type IdentityStore struct {
+  db *sql.DB
+}
+
+var identityColumns = []string{"id", "user_id", "provider", "subject", "email", "created_at", "last_login_at"}
+
+// SaveLoginState remembers a pending OIDC login. Expired states from
+// abandoned logins are cleared at the same time.
+func (s *IdentityStore) SaveLoginState(ctx context.Context, stateHash string, state models.OIDCLoginState, expiresAt time.Time) error {
+  cleanup, cleanupArgs := qb.Delete("oidc_login_states").
+    Where("expires_at < now()").
+    Build()
+  if _, err := s.db.ExecContext(ctx, cleanup, cleanupArgs...); err != nil {
+    return err
+  }
+
+  query, args := qb.Insert("oidc_login_states").
+    Columns("state_hash", "provider", "nonce", "code_verifier", "link_user_id", "expires_at").
+    Values(stateHash, state.Provider, state.Nonce, state.CodeVerifier, state.LinkUserID, expiresAt).
+    Build()
+  _, err := s.db.ExecContext(ctx, query, args...)
+  return err
+}
+
+// ConsumeLoginState removes and returns a pending login. It returns
+// ErrNotFound for unknown, used or expired states.
+func (s *IdentityStore) ConsumeLoginState(ctx context.Context, stateHash string) (models.OIDCLoginState, error) {
+  query, args := qb.Delete("oidc_login_states").
+    WhereEq("state_hash", stateHash).
+    Where("expires_at > now()").
+    Returning("provider", "nonce", "code_verifier", "link_user_id").
+    Build()
+
+  var state models.OIDCLoginState
+  var linkUserID sql.NullString
+  err := s.db.QueryRowContext(ctx, query, args...).Scan(&state.Provider, &state.Nonce, &state.CodeVerifier, &linkUserID)
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.OIDCLoginState{}, ErrNotFound
+  }
+  if err != nil {
+    return models.OIDCLoginState{}, err
+  }
+  state.LinkUserID = nullStringPtr(linkUserID)
+  return state, nil
+}
+
+// TouchIdentity records a login through the identity and returns the
+// linked user's ID.
+func (s *IdentityStore) TouchIdentity(ctx context.Context, provider string, subject string) (string, error) {
+  query, args := qb.Update("identities").
+    Set("last_login_at", time.Now()).
+    WhereEq("provider", provider).
+    WhereEq("subject", subject).
+    Returning("user_id").
+    Build()
+
+  var userID string
+  err := s.db.QueryRowContext(ctx, query, args...).Scan(&userID)
+  if errors.Is(err, sql.ErrNoRows) {
+    return "", ErrNotFound
+  }
+  if err != nil {
+    return "", err
+  }
+  return userID, nil
+}
+
+func (s *IdentityStore) LinkIdentity(ctx context.Context, userID string, provider string, subject string, email string) (models.Identity, error) {
+  query, args := qb.Insert("identities").
+    Columns("user_id", "provider", "subject", "email").
+    Values(userID, provider, subject, email).
+    Returning(identityColumns...).
+    Build()
+  return scanIdentity(s.db.QueryRowContext(ctx, query, args...))
+}
+
+// CreateUserWithIdentity registers a passwordless user signing up through
+// an identity provider.
+func (s *IdentityStore) CreateUserWithIdentity(ctx context.Context, email string, username string, emailVerified bool, provider string, subject string) (models.User, error) {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return models.User{}, err
+  }
+  defer tx.Rollback()
+
+  var verifiedAt *time.Time
+  if emailVerified {
+    now := time.Now()
+    verifiedAt = &now
+  }
+
+  query, args := qb.Insert("users").
+    Columns("email", "username", "password_hash", "email_verified_at").
+    Values(email, username, "", verifiedAt).
+    Returning(userColumns...).
+    Build()
+  user, err := scanUser(tx.QueryRowContext(ctx, query, args...))
+  if err != nil {
+    return models.User{}, err
+  }
+
+  link, linkArgs := qb.Insert("identities").
+    Columns("user_id", "provider", "subject", "email", "last_login_at").
+    Values(user.ID, provider, subject, email, time.Now()).
+    Build()
+  if _, err := tx.ExecContext(ctx, link, linkArgs...); err != nil {
+    return models.User{}, err
+  }
+
+  if err := tx.Commit(); err != nil {
+    return models.User{}, err
+  }
+  return user, nil
+}
+
+func (s *IdentityStore) ListIdentities(ctx context.Context, userID string) ([]models.Identity, error) {
+  query, args := qb.Select(identityColumns...).
+    From("identities").
+    WhereEq("user_id", userID).
+    OrderBy("created_at").
+    Build()
+
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var identities []models.Identity
+  for rows.Next() {
+    identity, err := scanIdentity(rows)
+    if err != nil {
+      return nil, err
+    }
+    identities = append(identities, identity)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return identities, nil
+}
+
+func (s *IdentityStore) DeleteIdentity(ctx context.Context, userID string, identityID string) error {
+  query, args := qb.Delete("identities").
+    WhereEq("id", identityID).
+    WhereEq("user_id", userID).
+    Build()
+  return execAffectingOne(ctx, s.db, query, args)
+}
+
+func scanIdentity(row rowScanner) (models.Identity, error) {
+  var identity models.Identity
+  var lastLoginAt sql.NullTime
+  err := row.Scan(
+    &identity.ID,
+    &identity.UserID,
+    &identity.Provider,
+    &identity.Subject,
+    &identity.Email,
+    &identity.CreatedAt,
+    &lastLoginAt,
+  )
+  if err != nil {
+    return models.Identity{}, err
+  }
+  identity.LastLoginAt = nullTimePtr(lastLoginAt)
+  return identity, nil
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+  "context"
+)
+
+// ReconcileKarma recomputes every user's post karma from post_votes and
+// returns how many users had drifted. comment_karma has no votes to be
+// recomputed from yet and is left alone. Users are processed in batches of
+// batchSize whose rows are locked first, so a vote landing during the run
+// is either counted or applied on top of the corrected value.
+func (s *UserStore) ReconcileKarma(ctx context.Context, batchSize int) (int64, error) {
+  var fixed int64
+  var after *string
+  for {
+    last, count, err := s.reconcileKarmaBatch(ctx, after, batchSize)
+    if err != nil {
+      return fixed, err
+    }
+    fixed += count
+    if last == nil {
+      return fixed, nil
+    }
+    after = last
+  }
+}
+
+// reconcileKarmaBatch fixes the next batch of users after the given ID and
+// returns the last ID it covered, or nil when none were left.
+func (s *UserStore) reconcileKarmaBatch(ctx context.Context, after *string, batchSize int) (*string, int64, error) {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return nil, 0, err
+  }
+  defer tx.Rollback()
+
+  rows, err := tx.QueryContext(ctx, `
+    select id
+    from users
+    where $1::uuid is null or id > $1::uuid
+    order by id
+    limit $2
+    for update`, after, batchSize)
+  if err != nil {
+    return nil, 0, err
+  }
+  var last *string
+  for rows.Next() {
+    var id string
+    if err := rows.Scan(&id); err != nil {
+      rows.Close()
+      return nil, 0, err
+    }
+    last = &id
+  }
+  rows.Close()
+  if err := rows.Err(); err != nil {
+    return nil, 0, err
+  }
+  if last == nil {
+    return nil, 0, nil
+  }
+
+  // A separate statement so that it sees every vote committed before the
+  // rows above were locked.
+  result, err := tx.ExecContext(ctx, `
+    update users u
+    set post_karma = totals.karma
+    from (
+      select b.id, coalesce(sum(v.value), 0)::integer as karma
+      from users b
+      left join posts p on p.user_id = b.id
+      left join post_votes v on v.post_id = p.id
+      where ($1::uuid is null or b.id > $1::uuid) and b.id <= $2::uuid
+      group by b.id
+    ) totals
+    where u.id = totals.id
+      and u.post_karma <> totals.karma`, after, *last)
+  if err != nil {
+    return nil, 0, err
+  }
+  fixed, err := result.RowsAffected()
+  if err != nil {
+    return nil, 0, err
+  }
+  return last, fixed, tx.Commit()
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "time"
+
+  "jabber_v3/apps/api/internal/auth/throttle"
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+// LoginAttemptStore is the Postgres throttle.Backend, for deployments that
+// run more than one API instance.
+type LoginAttemptStore struct {
+  db *sql.DB
+}
+
+var _ throttle.Backend = (*LoginAttemptStore)(nil)
+
+func (s *LoginAttemptStore) RecordFailure(ctx context.Context, key string, at time.Time) error {
+  query, args := qb.Insert("login_failures").
+    Columns("key", "failed_at").
+    Values(key, at).
+    Build()
+  _, err := s.db.ExecContext(ctx, query, args...)
+  return err
+}
+
+func (s *LoginAttemptStore) Failures(ctx context.Context, key string, since time.Time) (throttle.Window, error) {
+  query, args := qb.Select("count(*)", "min(failed_at)", "max(failed_at)").
+    From("login_failures").
+    WhereEq("key", key).
+    Where("failed_at > ?", since).
+    Build()
+
+  var window throttle.Window
+  var oldest, newest sql.NullTime
+  if err := s.db.QueryRowContext(ctx, query, args...).Scan(&window.Count, &oldest, &newest); err != nil {
+    return throttle.Window{}, err
+  }
+  window.Oldest = oldest.Time
+  window.Newest = newest.Time
+  return window, nil
+}
+
+func (s *LoginAttemptStore) ClearFailures(ctx context.Context, key string) error {
+  query, args := qb.Delete("login_failures").
+    WhereEq("key", key).
+    Build()
+  _, err := s.db.ExecContext(ctx, query, args...)
+  return err
+}
+
+func (s *LoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+  query := `
+    insert into login_lockouts (key, locked_until)
+    values ($1, $2)
+    on conflict (key)
+    do update set locked_until = greatest(login_lockouts.locked_until, excluded.locked_until)`
+  _, err := s.db.ExecContext(ctx, query, key, until)
+  return err
+}
+
+func (s *LoginAttemptStore) LockedUntil(ctx context.Context, key string, now time.Time) (time.Time, error) {
+  query, args := qb.Select("locked_until").
+    From("login_lockouts").
+    WhereEq("key", key).
+    Where("locked_until > ?", now).
+    Build()
+
+  var until time.Time
+  if err := s.db.QueryRowContext(ctx, query, args...).Scan(&until); err != nil {
+    if errors.Is(err, sql.ErrNoRows) {
+      return time.Time{}, nil
+    }
+    return time.Time{}, err
+  }
+  return until, nil
+}
+
+func (s *LoginAttemptStore) Prune(ctx context.Context, before time.Time) error {
+  query, args := qb.Delete("login_failures").
+    Where("failed_at <= ?", before).
+    Build()
+  if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+    return err
+  }
+  query, args = qb.Delete("login_lockouts").
+    Where("locked_until <= ?", before).
+    Build()
+  _, err := s.db.ExecContext(ctx, query, args...)
+  return err
+}
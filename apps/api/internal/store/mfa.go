@@ -0,0 +1,176 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "time"
+
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+type MFAStore struct {
+  db *sql.DB
+}
+
+func (s *MFAStore) GetTOTP(ctx context.Context, userID string) (models.TOTP, error) {
+  query, args := qb.Select("totp_secret", "totp_enabled_at", "totp_last_step").
+    From("users").
+    WhereEq("id", userID).
+    Build()
+
+  var secret sql.NullString
+  var enabledAt sql.NullTime
+  var totp models.TOTP
+  err := s.db.QueryRowContext(ctx, query, args...).Scan(&secret, &enabledAt, &totp.LastStep)
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.TOTP{}, ErrNotFound
+  }
+  if err != nil {
+    return models.TOTP{}, err
+  }
+  totp.Secret = secret.String
+  totp.EnabledAt = nullTimePtr(enabledAt)
+  return totp, nil
+}
+
+// SetPendingTOTP stores a new secret awaiting confirmation. It leaves an
+// already enabled secret alone and returns ErrNotFound in that case.
+func (s *MFAStore) SetPendingTOTP(ctx context.Context, userID string, secret string) error {
+  query, args := qb.Update("users").
+    Set("totp_secret", secret).
+    Set("totp_last_step", 0).
+    WhereEq("id", userID).
+    Where("totp_enabled_at is null").
+    Build()
+  return execAffectingOne(ctx, s.db, query, args)
+}
+
+// EnableTOTP turns on the pending secret after the user proved they can
+// generate codes for it, and stores the recovery code hashes.
+func (s *MFAStore) EnableTOTP(ctx context.Context, userID string, step int64, recoveryHashes []string) error {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  query, args := qb.Update("users").
+    Set("totp_enabled_at", time.Now()).
+    Set("totp_last_step", step).
+    WhereEq("id", userID).
+    Where("totp_secret is not null and totp_enabled_at is null").
+    Build()
+  if err := execAffectingOne(ctx, tx, query, args); err != nil {
+    return err
+  }
+
+  if err := replaceRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+    return err
+  }
+
+  return tx.Commit()
+}
+
+func (s *MFAStore) DisableTOTP(ctx context.Context, userID string) error {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  query, args := qb.Update("users").
+    Set("totp_secret", nil).
+    Set("totp_enabled_at", nil).
+    Set("totp_last_step", 0).
+    WhereEq("id", userID).
+    Build()
+  if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+    return err
+  }
+
+  if err := replaceRecoveryCodes(ctx, tx, userID, nil); err != nil {
+    return err
+  }
+
+  return tx.Commit()
+}
+
+// UseTOTPStep records step as the last accepted code. It returns
+// ErrNotFound when that step or a later one was already used.
+func (s *MFAStore) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+  query, args := qb.Update("users").
+    Set("totp_last_step", step).
+    WhereEq("id", userID).
+    Where("totp_last_step < ?", step).
+    Build()
+  return execAffectingOne(ctx, s.db, query, args)
+}
+
+// UseRecoveryCode spends a recovery code. It returns ErrNotFound when the
+// code is unknown or already used.
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID string, codeHash string) error {
+  query, args := qb.Update("mfa_recovery_codes").
+    Set("used_at", time.Now()).
+    WhereEq("user_id", userID).
+    WhereEq("code_hash", codeHash).
+    Where("used_at is null").
+    Build()
+  return execAffectingOne(ctx, s.db, query, args)
+}
+
+func (s *MFAStore) ReplaceRecoveryCodes(ctx context.Context, userID string, recoveryHashes []string) error {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  if err := replaceRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+    return err
+  }
+
+  return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string, recoveryHashes []string) error {
+  query, args := qb.Delete("mfa_recovery_codes").
+    WhereEq("user_id", userID).
+    Build()
+  if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+    return err
+  }
+
+  for _, hash := range recoveryHashes {
+    query, args := qb.Insert("mfa_recovery_codes").
+      Columns("user_id", "code_hash").
+      Values(userID, hash).
+      Build()
+    if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+type execer interface {
+  ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// execAffectingOne runs a statement that must touch a row, mapping "no rows
+// affected" to ErrNotFound.
+func execAffectingOne(ctx context.Context, db execer, query string, args []any) error {
+  result, err := db.ExecContext(ctx, query, args...)
+  if err != nil {
+    return err
+  }
+  affected, err := result.RowsAffected()
+  if err != nil {
+    return err
+  }
+  if affected == 0 {
+    return ErrNotFound
+  }
+  return nil
+}
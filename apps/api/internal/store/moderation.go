@@ -0,0 +1,230 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "strings"
+  "time"
+
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+type ModerationStore struct {
+  db *sql.DB
+}
+
+var reportColumns = []string{"id", "post_id", "reporter_id", "reason", "details", "status", "created_at"}
+
+var moderationLogColumns = []string{"id", "community_id", "moderator_id", "action", "target_type", "target_id", "reason", "created_at"}
+
+func (s *ModerationStore) CreateReport(ctx context.Context, postID string, reporterID string, reason string, details string) (models.Report, error) {
+  query, args := qb.Insert("reports").
+    Columns("post_id", "reporter_id", "reason", "details").
+    Values(postID, reporterID, reason, details).
+    Returning(reportColumns...).
+    Build()
+  var report models.Report
+  err := s.db.QueryRowContext(ctx, query, args...).Scan(
+    &report.ID,
+    &report.PostID,
+    &report.ReporterID,
+    &report.Reason,
+    &report.Details,
+    &report.Status,
+    &report.CreatedAt,
+  )
+  if err != nil {
+    return models.Report{}, err
+  }
+  return report, nil
+}
+
+// ListReportQueue groups open reports by the reported post, most reported
+// first. A nil communityID selects posts that belong to no community.
+func (s *ModerationStore) ListReportQueue(ctx context.Context, communityID *string, limit int) ([]models.ReportGroup, error) {
+  builder := qb.Select(
+    "r.post_id",
+    "p.title",
+    "p.user_id",
+    "u.username",
+    "count(*) as report_count",
+    "string_agg(distinct r.reason, ',') as reasons",
+    "min(r.created_at) as first_reported_at",
+    "max(r.created_at) as last_reported_at",
+  ).
+    From("reports r").
+    Join("join posts p on p.id = r.post_id").
+    Join("join users u on u.id = p.user_id").
+    Where("r.status = 'open'")
+  if communityID != nil {
+    builder.Where("p.community_id = ?", *communityID)
+  } else {
+    builder.Where("p.community_id is null")
+  }
+  query, args := builder.
+    GroupBy("r.post_id, p.title, p.user_id, u.username").
+    OrderBy("report_count desc, first_reported_at").
+    Limit(limit).
+    Build()
+
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var groups []models.ReportGroup
+  for rows.Next() {
+    var group models.ReportGroup
+    var reasons string
+    err := rows.Scan(
+      &group.PostID,
+      &group.PostTitle,
+      &group.AuthorID,
+      &group.AuthorUsername,
+      &group.ReportCount,
+      &reasons,
+      &group.FirstReportedAt,
+      &group.LastReportedAt,
+    )
+    if err != nil {
+      return nil, err
+    }
+    group.Reasons = strings.Split(reasons, ",")
+    groups = append(groups, group)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return groups, nil
+}
+
+// ModeratePost applies a moderator action to a post, settles its open
+// reports and appends the action to the moderation log in one transaction.
+func (s *ModerationStore) ModeratePost(ctx context.Context, post models.Post, moderatorID string, action string, reason string) (models.ModerationLogEntry, error) {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return models.ModerationLogEntry{}, err
+  }
+  defer tx.Rollback()
+
+  now := time.Now()
+  update := qb.Update("posts")
+  reportStatus := ""
+  switch action {
+  case models.ModActionRemove:
+    update.Set("removed_at", now)
+    reportStatus = "resolved"
+  case models.ModActionApprove:
+    update.Set("removed_at", nil)
+    reportStatus = "resolved"
+  case models.ModActionLock:
+    update.Set("locked_at", now)
+  case models.ModActionUnlock:
+    update.Set("locked_at", nil)
+  case models.ModActionPin:
+    update.Set("pinned_at", now)
+  case models.ModActionUnpin:
+    update.Set("pinned_at", nil)
+  case models.ModActionDismiss:
+    update = nil
+    reportStatus = "dismissed"
+  default:
+    return models.ModerationLogEntry{}, errors.New("unknown moderation action")
+  }
+
+  if update != nil {
+    query, args := update.WhereEq("id", post.ID).Build()
+    if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+      return models.ModerationLogEntry{}, err
+    }
+  }
+
+  if reportStatus != "" {
+    query, args := qb.Update("reports").
+      Set("status", reportStatus).
+      Set("resolved_at", now).
+      Set("resolved_by", moderatorID).
+      WhereEq("post_id", post.ID).
+      Where("status = 'open'").
+      Build()
+    if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+      return models.ModerationLogEntry{}, err
+    }
+  }
+
+  entry, err := insertModerationLog(ctx, tx, post.CommunityID, moderatorID, action, "post", post.ID, reason)
+  if err != nil {
+    return models.ModerationLogEntry{}, err
+  }
+
+  if err := tx.Commit(); err != nil {
+    return models.ModerationLogEntry{}, err
+  }
+  return entry, nil
+}
+
+// ListLog pages backwards through the moderation log of a community, or of
+// posts outside any community when communityID is nil.
+func (s *ModerationStore) ListLog(ctx context.Context, communityID *string, limit int, before *models.ModerationLogEntry) ([]models.ModerationLogEntry, error) {
+  builder := qb.Select(moderationLogColumns...).From("moderation_log")
+  if communityID != nil {
+    builder.Where("community_id = ?", *communityID)
+  } else {
+    builder.Where("community_id is null")
+  }
+  if before != nil {
+    builder.Where("(created_at, id) < (?::timestamptz, ?::uuid)", before.CreatedAt, before.ID)
+  }
+  query, args := builder.OrderBy("created_at desc, id desc").Limit(limit).Build()
+
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var entries []models.ModerationLogEntry
+  for rows.Next() {
+    entry, err := scanModerationLogEntry(rows)
+    if err != nil {
+      return nil, err
+    }
+    entries = append(entries, entry)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return entries, nil
+}
+
+func insertModerationLog(ctx context.Context, tx *sql.Tx, communityID *string, moderatorID string, action string, targetType string, targetID string, reason string) (models.ModerationLogEntry, error) {
+  query, args := qb.Insert("moderation_log").
+    Columns("community_id", "moderator_id", "action", "target_type", "target_id", "reason").
+    Values(communityID, moderatorID, action, targetType, targetID, reason).
+    Returning(moderationLogColumns...).
+    Build()
+  return scanModerationLogEntry(tx.QueryRowContext(ctx, query, args...))
+}
+
+func scanModerationLogEntry(row rowScanner) (models.ModerationLogEntry, error) {
+  var entry models.ModerationLogEntry
+  var communityID sql.NullString
+  err := row.Scan(
+    &entry.ID,
+    &communityID,
+    &entry.ModeratorID,
+    &entry.Action,
+    &entry.TargetType,
+    &entry.TargetID,
+    &entry.Reason,
+    &entry.CreatedAt,
+  )
+  if err != nil {
+    return models.ModerationLogEntry{}, err
+  }
+  entry.CommunityID = nullStringPtr(communityID)
+  return entry, nil
+}
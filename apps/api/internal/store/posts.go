@@ -4,6 +4,7 @@ import (
   "context"
   "database/sql"
   "errors"
+  "time"
 
   "jabber_v3/apps/api/internal/models"
   "jabber_v3/apps/api/internal/store/qb"
@@ -13,12 +14,14 @@ type PostStore struct {
   db *sql.DB
 }
 
-var postColumns = []string{"id", "user_id", "title", "body", "created_at"}
+var postColumns = []string{"id", "user_id", "community_id", "title", "body", "created_at", "edited_at", "deleted_at", "removed_at", "locked_at", "pinned_at"}
 
-func (s *PostStore) CreatePost(ctx context.Context, userID string, title string, body string) (models.Post, error) {
+var revisionColumns = []string{"id", "post_id", "title", "body", "created_at"}
+
+func (s *PostStore) CreatePost(ctx context.Context, userID string, communityID *string, title string, body string) (models.Post, error) {
   query, args := qb.Insert("posts").
-    Columns("user_id", "title", "body").
-    Values(userID, title, body).
+    Columns("user_id", "community_id", "title", "body").
+    Values(userID, communityID, title, body).
     Returning(postColumns...).
     Build()
   row := s.db.QueryRowContext(ctx, query, args...)
@@ -29,31 +32,103 @@ func (s *PostStore) CreatePost(ctx context.Context, userID string, title string,
   return post, nil
 }
 
-func (s *PostStore) ListFeed(ctx context.Context, limit int, userID *string) ([]models.PostWithStats, error) {
-  var args []any
-  query := `
-    select
-      p.id,
-      p.user_id,
-      p.title,
-      p.body,
-      p.created_at,
-      u.email,
-      u.username,
-      coalesce(sum(v.value), 0) as score,
-      coalesce(max(case when v.user_id = $1 then v.value end), 0) as my_vote
-    from posts p
-    join users u on u.id = p.user_id
-    left join post_votes v on v.post_id = p.id
-    group by p.id, u.email, u.username
-    order by p.created_at desc
-    limit $2`
-  viewerID := ""
-  if userID != nil {
-    viewerID = *userID
-  }
-  args = append(args, viewerID, limit)
+const (
+  FeedSortNew = "new"
+  FeedSortTop = "top"
+  FeedSortHot = "hot"
+)
+
+// FeedCursor is the keyset position of the last post on a page. Only the
+// fields relevant to the sort mode are compared; Pinned only in community
+// feeds.
+type FeedCursor struct {
+  ID        string
+  Pinned    bool
+  CreatedAt time.Time
+  Score     int
+  HotRank   float64
+}
+
+// FeedOptions narrows the feed to one community, or to the viewer's
+// subscriptions when Subscribed is set. Posts in private communities are
+// only ever returned to their members.
+type FeedOptions struct {
+  Sort        string
+  Since       *time.Time
+  After       *FeedCursor
+  Limit       int
+  ViewerID    *string
+  CommunityID *string
+  Subscribed  bool
+}
+
+var feedColumns = []string{
+  "p.id",
+  "p.user_id",
+  "p.community_id",
+  "p.title",
+  "p.body",
+  "p.created_at",
+  "p.edited_at",
+  "p.deleted_at",
+  "p.removed_at",
+  "p.locked_at",
+  "p.pinned_at",
+  "u.username",
+  "p.score",
+  "p.upvotes",
+  "p.downvotes",
+  "coalesce(mv.value, 0) as my_vote",
+  "(select count(*) from comments c where c.post_id = p.id) as comment_count",
+  "p.hot_rank",
+  "cm.slug",
+  "cm.name",
+}
+
+func (s *PostStore) ListFeed(ctx context.Context, opts FeedOptions) ([]models.PostWithStats, error) {
+  builder := selectPostsWithStats(opts.ViewerID).
+    Where("((p.deleted_at is null and p.removed_at is null) or exists (select 1 from comments c where c.post_id = p.id))")
+
+  if opts.CommunityID != nil {
+    builder.Where("p.community_id = ?", *opts.CommunityID)
+  } else if opts.Subscribed && opts.ViewerID != nil {
+    builder.Where("p.community_id in (select s.community_id from community_subscriptions s where s.user_id = ?)", *opts.ViewerID)
+  }
+  if opts.Since != nil {
+    builder.Where("p.created_at >= ?", *opts.Since)
+  }
+
+  // Pinned posts lead a community's feed whatever the sort, so there the
+  // keyset and the order start with whether the post is pinned.
+  keyColumns, keyValues, order := "", "", ""
+  var keyArgs []any
+  after := opts.After
+  if opts.CommunityID != nil {
+    keyColumns, keyValues, order = "(p.pinned_at is not null), ", "?::boolean, ", "(p.pinned_at is not null) desc, "
+    if after != nil {
+      keyArgs = append(keyArgs, after.Pinned)
+    }
+  }
+
+  switch opts.Sort {
+  case FeedSortTop:
+    if after != nil {
+      builder.Where("("+keyColumns+"p.score, p.created_at, p.id) < ("+keyValues+"?::integer, ?::timestamptz, ?::uuid)", append(keyArgs, after.Score, after.CreatedAt, after.ID)...)
+    }
+    builder.OrderBy(order + "p.score desc, p.created_at desc, p.id desc")
+  case FeedSortHot:
+    if after != nil {
+      builder.Where("("+keyColumns+"p.hot_rank, p.id) < ("+keyValues+"?::double precision, ?::uuid)", append(keyArgs, after.HotRank, after.ID)...)
+    }
+    builder.OrderBy(order + "p.hot_rank desc, p.id desc")
+  default:
+    if after != nil {
+      builder.Where("("+keyColumns+"p.created_at, p.id) < ("+keyValues+"?::timestamptz, ?::uuid)", append(keyArgs, after.CreatedAt, after.ID)...)
+    }
+    builder.OrderBy(order + "p.created_at desc, p.id desc")
+  }
 
+  query, args := builder.Limit(opts.Limit).Build()
   rows, err := s.db.QueryContext(ctx, query, args...)
   if err != nil {
     return nil, err
@@ -74,31 +149,98 @@ func (s *PostStore) ListFeed(ctx context.Context, limit int, userID *string) ([]
   return posts, nil
 }
 
+func (s *PostStore) GetPostWithStats(ctx context.Context, postID string, viewerID *string) (models.PostWithStats, error) {
+  query, args := selectPostsWithStats(viewerID).
+    Where("p.id = ?", postID).
+    Build()
+  post, err := scanPostWithStats(s.db.QueryRowContext(ctx, query, args...))
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.PostWithStats{}, ErrNotFound
+  }
+  if err != nil {
+    return models.PostWithStats{}, err
+  }
+  return post, nil
+}
+
+func selectPostsWithStats(viewerID *string, extraColumns ...string) *qb.SelectBuilder {
+  columns := append(append([]string{}, feedColumns...), extraColumns...)
+  return qb.Select(columns...).
+    From("posts p").
+    Join("join users u on u.id = p.user_id").
+    Join("left join post_votes mv on mv.post_id = p.id and mv.user_id = ?", viewerID).
+    Join("left join communities cm on cm.id = p.community_id").
+    Where("(cm.visibility is null or cm.visibility <> 'private' or exists (select 1 from community_members m where m.community_id = p.community_id and m.user_id = ?))", viewerID)
+}
+
 func scanPost(row rowScanner) (models.Post, error) {
   var post models.Post
-  err := row.Scan(&post.ID, &post.UserID, &post.Title, &post.Body, &post.CreatedAt)
+  var communityID sql.NullString
+  var editedAt, deletedAt, removedAt, lockedAt, pinnedAt sql.NullTime
+  err := row.Scan(
+    &post.ID,
+    &post.UserID,
+    &communityID,
+    &post.Title,
+    &post.Body,
+    &post.CreatedAt,
+    &editedAt,
+    &deletedAt,
+    &removedAt,
+    &lockedAt,
+    &pinnedAt,
+  )
   if err != nil {
     return models.Post{}, err
   }
+  post.CommunityID = nullStringPtr(communityID)
+  post.EditedAt = nullTimePtr(editedAt)
+  post.DeletedAt = nullTimePtr(deletedAt)
+  post.RemovedAt = nullTimePtr(removedAt)
+  post.LockedAt = nullTimePtr(lockedAt)
+  post.PinnedAt = nullTimePtr(pinnedAt)
   return post, nil
 }
 
-func scanPostWithStats(row rowScanner) (models.PostWithStats, error) {
+// scanPostWithStats reads feedColumns followed by any extra columns, which
+// are scanned into extra.
+func scanPostWithStats(row rowScanner, extra ...any) (models.PostWithStats, error) {
   var post models.PostWithStats
-  err := row.Scan(
+  var communityID, communitySlug, communityName sql.NullString
+  var editedAt, deletedAt, removedAt, lockedAt, pinnedAt sql.NullTime
+  dest := []any{
     &post.ID,
     &post.UserID,
+    &communityID,
     &post.Title,
     &post.Body,
     &post.CreatedAt,
-    &post.AuthorEmail,
+    &editedAt,
+    &deletedAt,
+    &removedAt,
+    &lockedAt,
+    &pinnedAt,
     &post.AuthorUsername,
     &post.Score,
+    &post.Upvotes,
+    &post.Downvotes,
     &post.MyVote,
-  )
-  if err != nil {
+    &post.CommentCount,
+    &post.HotRank,
+    &communitySlug,
+    &communityName,
+  }
+  if err := row.Scan(append(dest, extra...)...); err != nil {
     return models.PostWithStats{}, err
   }
+  post.CommunityID = nullStringPtr(communityID)
+  post.CommunitySlug = nullStringPtr(communitySlug)
+  post.CommunityName = nullStringPtr(communityName)
+  post.EditedAt = nullTimePtr(editedAt)
+  post.DeletedAt = nullTimePtr(deletedAt)
+  post.RemovedAt = nullTimePtr(removedAt)
+  post.LockedAt = nullTimePtr(lockedAt)
+  post.PinnedAt = nullTimePtr(pinnedAt)
   return post, nil
 }
 
@@ -117,3 +259,111 @@ func (s *PostStore) GetPostByID(ctx context.Context, postID string) (models.Post
   }
   return post, nil
 }
+
+// UpdatePost stores the current title and body as a revision before
+// overwriting them, so the history always holds every prior version.
+func (s *PostStore) UpdatePost(ctx context.Context, postID string, title string, body string) (models.Post, error) {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return models.Post{}, err
+  }
+  defer tx.Rollback()
+
+  query, args := qb.Select(postColumns...).
+    From("posts").
+    WhereEq("id", postID).
+    Where("deleted_at is null").
+    Build()
+  current, err := scanPost(tx.QueryRowContext(ctx, query+" for update", args...))
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.Post{}, ErrNotFound
+  }
+  if err != nil {
+    return models.Post{}, err
+  }
+
+  query, args = qb.Insert("post_revisions").
+    Columns("post_id", "title", "body").
+    Values(current.ID, current.Title, current.Body).
+    Build()
+  if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+    return models.Post{}, err
+  }
+
+  query, args = qb.Update("posts").
+    Set("title", title).
+    Set("body", body).
+    Set("edited_at", time.Now()).
+    WhereEq("id", postID).
+    Returning(postColumns...).
+    Build()
+  post, err := scanPost(tx.QueryRowContext(ctx, query, args...))
+  if err != nil {
+    return models.Post{}, err
+  }
+
+  if err := tx.Commit(); err != nil {
+    return models.Post{}, err
+  }
+  return post, nil
+}
+
+func (s *PostStore) SoftDeletePost(ctx context.Context, postID string) error {
+  query, args := qb.Update("posts").
+    Set("deleted_at", time.Now()).
+    WhereEq("id", postID).
+    Where("deleted_at is null").
+    Build()
+  result, err := s.db.ExecContext(ctx, query, args...)
+  if err != nil {
+    return err
+  }
+  affected, err := result.RowsAffected()
+  if err != nil {
+    return err
+  }
+  if affected == 0 {
+    return ErrNotFound
+  }
+  return nil
+}
+
+func (s *PostStore) ListRevisions(ctx context.Context, postID string) ([]models.PostRevision, error) {
+  query, args := qb.Select(revisionColumns...).
+    From("post_revisions").
+    WhereEq("post_id", postID).
+    OrderBy("created_at desc, id desc").
+    Build()
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var revisions []models.PostRevision
+  for rows.Next() {
+    var revision models.PostRevision
+    if err := rows.Scan(&revision.ID, &revision.PostID, &revision.Title, &revision.Body, &revision.CreatedAt); err != nil {
+      return nil, err
+    }
+    revisions = append(revisions, revision)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return revisions, nil
+}
+
+func nullStringPtr(value sql.NullString) *string {
+  if !value.Valid {
+    return nil
+  }
+  return &value.String
+}
+
+func nullTimePtr(value sql.NullTime) *time.Time {
+  if !value.Valid {
+    return nil
+  }
+  return &value.Time
+}
@@ -0,0 +1,220 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "time"
+
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+// ProfileCursor is the keyset position of the last item on a page of a
+// user's history.
+type ProfileCursor struct {
+  ID        string
+  CreatedAt time.Time
+}
+
+// GetProfile returns the public profile of a user. The placeholder that
+// holds deleted users' content has no profile.
+func (s *UserStore) GetProfile(ctx context.Context, username string) (models.UserProfile, error) {
+  query, args := qb.Select(
+    "u.id",
+    "u.username",
+    "u.display_name",
+    "u.bio",
+    "u.avatar_url",
+    "u.created_at",
+    "u.post_karma",
+    "u.comment_karma",
+  ).
+    From("users u").
+    Where("u.username = ?", username).
+    Where("u.id <> ?", DeletedUserID).
+    Build()
+
+  var profile models.UserProfile
+  err := s.db.QueryRowContext(ctx, query, args...).Scan(
+    &profile.ID,
+    &profile.Username,
+    &profile.DisplayName,
+    &profile.Bio,
+    &profile.AvatarURL,
+    &profile.CreatedAt,
+    &profile.PostKarma,
+    &profile.CommentKarma,
+  )
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.UserProfile{}, ErrNotFound
+  }
+  if err != nil {
+    return models.UserProfile{}, err
+  }
+  return profile, nil
+}
+
+// UpdateProfile replaces the display name, bio and avatar URL.
+func (s *UserStore) UpdateProfile(ctx context.Context, userID string, displayName string, bio string, avatarURL string) (models.User, error) {
+  query, args := qb.Update("users").
+    Set("display_name", displayName).
+    Set("bio", bio).
+    Set("avatar_url", avatarURL).
+    WhereEq("id", userID).
+    Returning(userColumns...).
+    Build()
+  user, err := scanUser(s.db.QueryRowContext(ctx, query, args...))
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.User{}, ErrNotFound
+  }
+  if err != nil {
+    return models.User{}, err
+  }
+  return user, nil
+}
+
+// UpdateProfileAndUsername renames the user and replaces their profile in
+// one statement, so that neither change is kept without the other. Like a
+// rename on its own, it returns ErrNotFound if the user already renamed
+// after notBefore.
+func (s *UserStore) UpdateProfileAndUsername(ctx context.Context, userID string, displayName string, bio string, avatarURL string, username string, notBefore time.Time) (models.User, error) {
+  query, args := qb.Update("users").
+    Set("display_name", displayName).
+    Set("bio", bio).
+    Set("avatar_url", avatarURL).
+    Set("username", username).
+    Set("username_changed_at", time.Now()).
+    WhereEq("id", userID).
+    Where("(username_changed_at is null or username_changed_at <= ?)", notBefore).
+    Returning(userColumns...).
+    Build()
+  user, err := scanUser(s.db.QueryRowContext(ctx, query, args...))
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.User{}, ErrNotFound
+  }
+  if err != nil {
+    return models.User{}, err
+  }
+  return user, nil
+}
+
+// ListUserPosts pages through the posts a user wrote, newest first.
+// Deleted and removed posts are left out, as are posts in private
+// communities the viewer is not a member of.
+func (s *UserStore) ListUserPosts(ctx context.Context, userID string, viewerID *string, after *ProfileCursor, limit int) ([]models.PostWithStats, error) {
+  builder := selectPostsWithStats(viewerID).
+    Where("p.user_id = ?", userID).
+    Where("p.deleted_at is null and p.removed_at is null")
+  if after != nil {
+    builder.Where("(p.created_at, p.id) < (?::timestamptz, ?::uuid)", after.CreatedAt, after.ID)
+  }
+
+  query, args := builder.OrderBy("p.created_at desc, p.id desc").Limit(limit).Build()
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  posts := make([]models.PostWithStats, 0)
+  for rows.Next() {
+    post, err := scanPostWithStats(rows)
+    if err != nil {
+      return nil, err
+    }
+    posts = append(posts, post)
+  }
+  return posts, rows.Err()
+}
+
+// ListUserComments pages through the comments a user wrote, newest first,
+// skipping those in private communities the viewer is not a member of.
+func (s *UserStore) ListUserComments(ctx context.Context, userID string, viewerID *string, after *ProfileCursor, limit int) ([]models.ProfileComment, error) {
+  builder := qb.Select(
+    "c.id",
+    "c.post_id",
+    "c.parent_id",
+    "c.user_id",
+    "c.body",
+    "c.created_at",
+    "p.title",
+    "p.deleted_at is not null",
+    "p.removed_at is not null",
+    "p.community_id",
+    "cm.slug",
+    "cm.name",
+  ).
+    From("comments c").
+    Join("join posts p on p.id = c.post_id").
+    Join("left join communities cm on cm.id = p.community_id").
+    Where("c.user_id = ?", userID).
+    Where("(cm.visibility is null or cm.visibility <> 'private' or exists (select 1 from community_members m where m.community_id = p.community_id and m.user_id = ?))", viewerID)
+  if after != nil {
+    builder.Where("(c.created_at, c.id) < (?::timestamptz, ?::uuid)", after.CreatedAt, after.ID)
+  }
+
+  query, args := builder.OrderBy("c.created_at desc, c.id desc").Limit(limit).Build()
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  comments := make([]models.ProfileComment, 0)
+  for rows.Next() {
+    var comment models.ProfileComment
+    var parentID, communityID, communitySlug, communityName sql.NullString
+    err := rows.Scan(
+      &comment.ID,
+      &comment.PostID,
+      &parentID,
+      &comment.UserID,
+      &comment.Body,
+      &comment.CreatedAt,
+      &comment.PostTitle,
+      &comment.PostDeleted,
+      &comment.PostRemoved,
+      &communityID,
+      &communitySlug,
+      &communityName,
+    )
+    if err != nil {
+      return nil, err
+    }
+    comment.ParentID = nullStringPtr(parentID)
+    comment.CommunityID = nullStringPtr(communityID)
+    comment.CommunitySlug = nullStringPtr(communitySlug)
+    comment.CommunityName = nullStringPtr(communityName)
+    comments = append(comments, comment)
+  }
+  return comments, rows.Err()
+}
+
+// ListVotedPosts pages through the posts a user voted on, most recent vote
+// first. MyVote holds the user's vote.
+func (s *UserStore) ListVotedPosts(ctx context.Context, userID string, after *ProfileCursor, limit int) ([]models.VotedPost, error) {
+  builder := selectPostsWithStats(&userID, "mv.created_at").
+    Where("mv.user_id is not null")
+  if after != nil {
+    builder.Where("(mv.created_at, p.id) < (?::timestamptz, ?::uuid)", after.CreatedAt, after.ID)
+  }
+
+  query, args := builder.OrderBy("mv.created_at desc, p.id desc").Limit(limit).Build()
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  posts := make([]models.VotedPost, 0)
+  for rows.Next() {
+    var votedAt time.Time
+    post, err := scanPostWithStats(rows, &votedAt)
+    if err != nil {
+      return nil, err
+    }
+    posts = append(posts, models.VotedPost{PostWithStats: post, VotedAt: votedAt})
+  }
+  return posts, rows.Err()
+}
@@ -8,8 +8,10 @@ import (
 type SelectBuilder struct {
   columns []string
   table   string
+  joins   []string
   where   []string
   args    []any
+  groupBy string
   orderBy string
   limit   int
   hasLimit bool
@@ -24,6 +26,13 @@ func (b *SelectBuilder) From(table string) *SelectBuilder {
   return b
 }
 
+func (b *SelectBuilder) Join(clause string, args ...any) *SelectBuilder {
+  clause, nextArgs := replacePlaceholders(clause, b.args, args)
+  b.joins = append(b.joins, clause)
+  b.args = append(b.args, nextArgs...)
+  return b
+}
+
 func (b *SelectBuilder) Where(condition string, args ...any) *SelectBuilder {
   clause, nextArgs := replacePlaceholders(condition, b.args, args)
   b.where = append(b.where, clause)
@@ -35,6 +44,11 @@ func (b *SelectBuilder) WhereEq(column string, value any) *SelectBuilder {
   return b.Where(column+" = ?", value)
 }
 
+func (b *SelectBuilder) GroupBy(group string) *SelectBuilder {
+  b.groupBy = group
+  return b
+}
+
 func (b *SelectBuilder) OrderBy(order string) *SelectBuilder {
   b.orderBy = order
   return b
@@ -48,9 +62,15 @@ func (b *SelectBuilder) Limit(limit int) *SelectBuilder {
 
 func (b *SelectBuilder) Build() (string, []any) {
   query := "select " + strings.Join(b.columns, ", ") + " from " + b.table
+  if len(b.joins) > 0 {
+    query += " " + strings.Join(b.joins, " ")
+  }
   if len(b.where) > 0 {
     query += " where " + strings.Join(b.where, " and ")
   }
+  if b.groupBy != "" {
+    query += " group by " + b.groupBy
+  }
   if b.orderBy != "" {
     query += " order by " + b.orderBy
   }
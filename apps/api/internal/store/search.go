@@ -0,0 +1,187 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "fmt"
+  "strings"
+  "time"
+
+  "jabber_v3/apps/api/internal/models"
+)
+
+type SearchStore struct {
+  db *sql.DB
+}
+
+const (
+  SearchTypeAll      = "all"
+  SearchTypePosts    = "posts"
+  SearchTypeComments = "comments"
+)
+
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2"
+
+// escapeHTML wraps a SQL text expression so that it can be used as HTML.
+// Titles and snippets are escaped before ts_headline adds its <mark> tags
+// (the parser treats entities like &lt; as single tokens, so they are never
+// split), which leaves the highlighting as the only markup in a result.
+func escapeHTML(expr string) string {
+  return "replace(replace(replace(replace(" + expr + ", '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '\"', '&quot;')"
+}
+
+// SearchCursor is the (rank, id) position of the last result on a page.
+type SearchCursor struct {
+  Rank float64
+  ID   string
+}
+
+type SearchOptions struct {
+  Query       string
+  Type        string
+  AuthorID    *string
+  CommunityID *string
+  Since       *time.Time
+  Until       *time.Time
+  After       *SearchCursor
+  Limit       int
+  ViewerID    *string
+}
+
+// Search matches posts and comments against a websearch-style query using
+// the generated search_vector columns. Results are ranked with ts_rank_cd
+// and snippets are only highlighted for the rows on the returned page.
+func (s *SearchStore) Search(ctx context.Context, opts SearchOptions) ([]models.SearchResult, error) {
+  var args []any
+  bind := func(value any) string {
+    args = append(args, value)
+    return fmt.Sprintf("$%d", len(args))
+  }
+
+  query := bind(opts.Query)
+  viewer := bind(opts.ViewerID)
+
+  var filters []string
+  if opts.AuthorID != nil {
+    filters = append(filters, "r.user_id = "+bind(*opts.AuthorID)+"::uuid")
+  }
+  if opts.CommunityID != nil {
+    filters = append(filters, "r.community_id = "+bind(*opts.CommunityID)+"::uuid")
+  }
+  if opts.Since != nil {
+    filters = append(filters, "r.created_at >= "+bind(*opts.Since)+"::timestamptz")
+  }
+  if opts.Until != nil {
+    filters = append(filters, "r.created_at < "+bind(*opts.Until)+"::timestamptz")
+  }
+  if opts.After != nil {
+    filters = append(filters, fmt.Sprintf("(r.rank, r.id) < (%s::double precision, %s::uuid)", bind(opts.After.Rank), bind(opts.After.ID)))
+  }
+
+  visible := `(cm.visibility is null or cm.visibility <> 'private' or exists (
+        select 1 from community_members m where m.community_id = p.community_id and m.user_id = ` + viewer + `::uuid
+      ))`
+
+  var sources []string
+  if opts.Type != SearchTypeComments {
+    sources = append(sources, `
+      select 'post' as kind, p.id, p.id as post_id, p.title, p.body as content,
+        ts_rank_cd(p.search_vector, q.query)::double precision as rank,
+        p.created_at, p.user_id, p.community_id
+      from posts p
+      cross join q
+      left join communities cm on cm.id = p.community_id
+      where p.search_vector @@ q.query
+        and p.deleted_at is null
+        and p.removed_at is null
+        and `+visible)
+  }
+  if opts.Type != SearchTypePosts {
+    sources = append(sources, `
+      select 'comment' as kind, c.id, c.post_id, p.title, c.body as content,
+        ts_rank_cd(c.search_vector, q.query)::double precision as rank,
+        c.created_at, c.user_id, p.community_id
+      from comments c
+      cross join q
+      join posts p on p.id = c.post_id
+      left join communities cm on cm.id = p.community_id
+      where c.search_vector @@ q.query
+        and p.deleted_at is null
+        and p.removed_at is null
+        and `+visible)
+  }
+
+  where := ""
+  if len(filters) > 0 {
+    where = "where " + strings.Join(filters, " and ")
+  }
+
+  sqlText := `
+    with q as (select websearch_to_tsquery('english', ` + query + `) as query),
+    page as (
+      select r.*
+      from (` + strings.Join(sources, "\n      union all") + `
+      ) r
+      ` + where + `
+      order by r.rank desc, r.id desc
+      limit ` + bind(opts.Limit) + `
+    )
+    select
+      page.kind,
+      page.id,
+      page.post_id,
+      case when page.kind = 'post'
+        then ts_headline('english', ` + escapeHTML("page.title") + `, q.query, 'HighlightAll=true, StartSel=<mark>, StopSel=</mark>')
+        else ` + escapeHTML("page.title") + `
+      end as title,
+      ts_headline('english', ` + escapeHTML("page.content") + `, q.query, '` + headlineOptions + `') as snippet,
+      page.rank,
+      page.created_at,
+      page.user_id,
+      u.username,
+      page.community_id,
+      cm.slug,
+      cm.name
+    from page
+    cross join q
+    join users u on u.id = page.user_id
+    left join communities cm on cm.id = page.community_id
+    order by page.rank desc, page.id desc`
+
+  rows, err := s.db.QueryContext(ctx, sqlText, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var results []models.SearchResult
+  for rows.Next() {
+    var result models.SearchResult
+    var communityID, communitySlug, communityName sql.NullString
+    err := rows.Scan(
+      &result.Kind,
+      &result.ID,
+      &result.PostID,
+      &result.Title,
+      &result.Snippet,
+      &result.Rank,
+      &result.CreatedAt,
+      &result.UserID,
+      &result.AuthorUsername,
+      &communityID,
+      &communitySlug,
+      &communityName,
+    )
+    if err != nil {
+      return nil, err
+    }
+    result.CommunityID = nullStringPtr(communityID)
+    result.CommunitySlug = nullStringPtr(communitySlug)
+    result.CommunityName = nullStringPtr(communityName)
+    results = append(results, result)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return results, nil
+}
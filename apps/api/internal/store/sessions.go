@@ -0,0 +1,217 @@
+package store
+
+import (
+  "context"
+  "database/sql"
+  "errors"
+  "time"
+
+  "jabber_v3/apps/api/internal/models"
+  "jabber_v3/apps/api/internal/store/qb"
+)
+
+// ErrRefreshTokenReused is returned when a refresh token that was already
+// rotated out is presented again. The session it belonged to is revoked.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+type SessionStore struct {
+  db *sql.DB
+}
+
+var sessionColumns = []string{"id", "user_id", "user_agent", "ip", "created_at", "last_seen_at", "expires_at"}
+
+const activeSessionCondition = "revoked_at is null and expires_at > now()"
+
+// CreateSession opens a session together with its first refresh token.
+func (s *SessionStore) CreateSession(ctx context.Context, userID string, userAgent string, ip string, refreshHash string, expiresAt time.Time) (models.Session, error) {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return models.Session{}, err
+  }
+  defer tx.Rollback()
+
+  query, args := qb.Insert("sessions").
+    Columns("user_id", "user_agent", "ip", "expires_at").
+    Values(userID, userAgent, ip, expiresAt).
+    Returning(sessionColumns...).
+    Build()
+  session, err := scanSession(tx.QueryRowContext(ctx, query, args...))
+  if err != nil {
+    return models.Session{}, err
+  }
+
+  if err := insertRefreshToken(ctx, tx, session.ID, refreshHash); err != nil {
+    return models.Session{}, err
+  }
+
+  if err := tx.Commit(); err != nil {
+    return models.Session{}, err
+  }
+  return session, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one and extends the
+// session. ErrNotFound means the token is unknown or its session has ended;
+// ErrRefreshTokenReused means it was already used, and the session is
+// revoked before returning.
+func (s *SessionStore) RotateRefreshToken(ctx context.Context, refreshHash string, newRefreshHash string, userAgent string, ip string, expiresAt time.Time) (models.Session, error) {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return models.Session{}, err
+  }
+  defer tx.Rollback()
+
+  query, args := qb.Select("t.id", "t.session_id", "t.used_at is not null").
+    From("refresh_tokens t").
+    Join("join sessions s on s.id = t.session_id").
+    WhereEq("t.token_hash", refreshHash).
+    Where("s.revoked_at is null and s.expires_at > now()").
+    Build()
+  query += " for update of t, s"
+
+  var tokenID, sessionID string
+  var used bool
+  err = tx.QueryRowContext(ctx, query, args...).Scan(&tokenID, &sessionID, &used)
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.Session{}, ErrNotFound
+  }
+  if err != nil {
+    return models.Session{}, err
+  }
+
+  if used {
+    revoke, revokeArgs := qb.Update("sessions").
+      Set("revoked_at", time.Now()).
+      WhereEq("id", sessionID).
+      Build()
+    if _, err := tx.ExecContext(ctx, revoke, revokeArgs...); err != nil {
+      return models.Session{}, err
+    }
+    if err := tx.Commit(); err != nil {
+      return models.Session{}, err
+    }
+    return models.Session{}, ErrRefreshTokenReused
+  }
+
+  markUsed, markArgs := qb.Update("refresh_tokens").
+    Set("used_at", time.Now()).
+    WhereEq("id", tokenID).
+    Build()
+  if _, err := tx.ExecContext(ctx, markUsed, markArgs...); err != nil {
+    return models.Session{}, err
+  }
+
+  if err := insertRefreshToken(ctx, tx, sessionID, newRefreshHash); err != nil {
+    return models.Session{}, err
+  }
+
+  update, updateArgs := qb.Update("sessions").
+    Set("user_agent", userAgent).
+    Set("ip", ip).
+    Set("last_seen_at", time.Now()).
+    Set("expires_at", expiresAt).
+    WhereEq("id", sessionID).
+    Returning(sessionColumns...).
+    Build()
+  session, err := scanSession(tx.QueryRowContext(ctx, update, updateArgs...))
+  if err != nil {
+    return models.Session{}, err
+  }
+
+  if err := tx.Commit(); err != nil {
+    return models.Session{}, err
+  }
+  return session, nil
+}
+
+func (s *SessionStore) ListActiveSessions(ctx context.Context, userID string) ([]models.Session, error) {
+  query, args := qb.Select(sessionColumns...).
+    From("sessions").
+    WhereEq("user_id", userID).
+    Where(activeSessionCondition).
+    OrderBy("last_seen_at desc").
+    Build()
+
+  rows, err := s.db.QueryContext(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  var sessions []models.Session
+  for rows.Next() {
+    session, err := scanSession(rows)
+    if err != nil {
+      return nil, err
+    }
+    sessions = append(sessions, session)
+  }
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+  return sessions, nil
+}
+
+// RevokeSession ends one of the user's active sessions.
+func (s *SessionStore) RevokeSession(ctx context.Context, userID string, sessionID string) error {
+  query, args := qb.Update("sessions").
+    Set("revoked_at", time.Now()).
+    WhereEq("id", sessionID).
+    WhereEq("user_id", userID).
+    Where(activeSessionCondition).
+    Build()
+  result, err := s.db.ExecContext(ctx, query, args...)
+  if err != nil {
+    return err
+  }
+  affected, err := result.RowsAffected()
+  if err != nil {
+    return err
+  }
+  if affected == 0 {
+    return ErrNotFound
+  }
+  return nil
+}
+
+// RevokeOtherSessions ends every active session of the user except keepID
+// and reports how many were ended.
+func (s *SessionStore) RevokeOtherSessions(ctx context.Context, userID string, keepID string) (int64, error) {
+  query, args := qb.Update("sessions").
+    Set("revoked_at", time.Now()).
+    WhereEq("user_id", userID).
+    Where("id <> ?", keepID).
+    Where(activeSessionCondition).
+    Build()
+  result, err := s.db.ExecContext(ctx, query, args...)
+  if err != nil {
+    return 0, err
+  }
+  return result.RowsAffected()
+}
+
+func insertRefreshToken(ctx context.Context, tx *sql.Tx, sessionID string, refreshHash string) error {
+  query, args := qb.Insert("refresh_tokens").
+    Columns("session_id", "token_hash").
+    Values(sessionID, refreshHash).
+    Build()
+  _, err := tx.ExecContext(ctx, query, args...)
+  return err
+}
+
+func scanSession(row rowScanner) (models.Session, error) {
+  var session models.Session
+  err := row.Scan(
+    &session.ID,
+    &session.UserID,
+    &session.UserAgent,
+    &session.IP,
+    &session.CreatedAt,
+    &session.LastSeenAt,
+    &session.ExpiresAt,
+  )
+  if err != nil {
+    return models.Session{}, err
+  }
+  return session, nil
+}
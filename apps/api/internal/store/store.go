@@ -8,15 +8,39 @@ import (
 var ErrNotFound = errors.New("not found")
 
 type Store struct {
-  Users *UserStore
-  Posts *PostStore
-  Votes *VoteStore
+  Users         *UserStore
+  Posts         *PostStore
+  Votes         *VoteStore
+  Comments      *CommentStore
+  Communities   *CommunityStore
+  Search        *SearchStore
+  Moderation    *ModerationStore
+  Bans          *BanStore
+  Sessions      *SessionStore
+  AccountTokens *AccountTokenStore
+  MFA           *MFAStore
+  AccessTokens  *AccessTokenStore
+  Identities    *IdentityStore
+  LoginAttempts *LoginAttemptStore
+  Exports       *ExportStore
 }
 
 func New(db *sql.DB) *Store {
   return &Store{
-    Users: &UserStore{db: db},
-    Posts: &PostStore{db: db},
-    Votes: &VoteStore{db: db},
+    Users:         &UserStore{db: db},
+    Posts:         &PostStore{db: db},
+    Votes:         &VoteStore{db: db},
+    Comments:      &CommentStore{db: db},
+    Communities:   &CommunityStore{db: db},
+    Search:        &SearchStore{db: db},
+    Moderation:    &ModerationStore{db: db},
+    Bans:          &BanStore{db: db},
+    Sessions:      &SessionStore{db: db},
+    AccountTokens: &AccountTokenStore{db: db},
+    MFA:           &MFAStore{db: db},
+    AccessTokens:  &AccessTokenStore{db: db},
+    Identities:    &IdentityStore{db: db},
+    LoginAttempts: &LoginAttemptStore{db: db},
+    Exports:       &ExportStore{db: db},
   }
 }
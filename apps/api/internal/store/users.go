@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"jabber_v3/apps/api/internal/models"
 	"jabber_v3/apps/api/internal/store/qb"
@@ -13,7 +14,7 @@ type UserStore struct {
   db *sql.DB
 }
 
-var userColumns = []string{"id", "email", "username", "password_hash", "created_at"}
+var userColumns = []string{"id", "email", "username", "password_hash", "role", "email_verified_at", "totp_enabled_at", "username_changed_at", "display_name", "bio", "avatar_url", "delete_after", "created_at", "updated_at"}
 
 type rowScanner interface {
   Scan(dest ...any) error
@@ -21,10 +22,15 @@ type rowScanner interface {
 
 func scanUser(row rowScanner) (models.User, error) {
   var user models.User
-  err := row.Scan(&user.ID, &user.Email, &user.Username, &user.PasswordHash, &user.CreatedAt)
+  var emailVerifiedAt, totpEnabledAt, usernameChangedAt, deleteAfter sql.NullTime
+  err := row.Scan(&user.ID, &user.Email, &user.Username, &user.PasswordHash, &user.Role, &emailVerifiedAt, &totpEnabledAt, &usernameChangedAt, &user.DisplayName, &user.Bio, &user.AvatarURL, &deleteAfter, &user.CreatedAt, &user.UpdatedAt)
   if err != nil {
     return models.User{}, err
   }
+  user.EmailVerifiedAt = nullTimePtr(emailVerifiedAt)
+  user.TOTPEnabledAt = nullTimePtr(totpEnabledAt)
+  user.UsernameChangedAt = nullTimePtr(usernameChangedAt)
+  user.DeleteAfter = nullTimePtr(deleteAfter)
   return user, nil
 }
 
@@ -89,3 +95,137 @@ func (s *UserStore) GetUserByUsername(ctx context.Context, username string) (mod
   }
   return user, nil
 }
+
+func (s *UserStore) SetRole(ctx context.Context, userID string, role string) error {
+  query, args := qb.Update("users").
+    Set("role", role).
+    WhereEq("id", userID).
+    Build()
+  _, err := s.db.ExecContext(ctx, query, args...)
+  return err
+}
+
+// ChangePassword sets a new password hash and revokes every session except
+// keepSessionID, which may be empty to revoke them all.
+func (s *UserStore) ChangePassword(ctx context.Context, userID string, passwordHash string, keepSessionID string) error {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback()
+
+  query, args := qb.Update("users").
+    Set("password_hash", passwordHash).
+    WhereEq("id", userID).
+    Build()
+  if err := execAffectingOne(ctx, tx, query, args); err != nil {
+    return err
+  }
+
+  revoke := qb.Update("sessions").
+    Set("revoked_at", time.Now()).
+    WhereEq("user_id", userID).
+    Where("revoked_at is null")
+  if keepSessionID != "" {
+    revoke = revoke.Where("id <> ?", keepSessionID)
+  }
+  revokeQuery, revokeArgs := revoke.Build()
+  if _, err := tx.ExecContext(ctx, revokeQuery, revokeArgs...); err != nil {
+    return err
+  }
+
+  return tx.Commit()
+}
+
+// ReplacePasswordHash swaps in an upgraded hash of the same password. It is
+// a no-op when the password was changed since oldHash was read.
+func (s *UserStore) ReplacePasswordHash(ctx context.Context, userID string, oldHash string, newHash string) error {
+  query, args := qb.Update("users").
+    Set("password_hash", newHash).
+    WhereEq("id", userID).
+    WhereEq("password_hash", oldHash).
+    Build()
+  _, err := s.db.ExecContext(ctx, query, args...)
+  return err
+}
+
+// GetAccountStatus loads the user's role and active site-wide ban in a
+// single round trip for the auth middleware. It returns ErrNotFound when the
+// user no longer exists or the session has been revoked or has expired.
+func (s *UserStore) GetAccountStatus(ctx context.Context, userID string, sessionID string) (models.AccountStatus, error) {
+  query := `
+    select ` + accountStatusColumns + `
+    from ` + accountStatusFrom + `
+    where u.id = $1
+      and exists (
+        select 1
+        from sessions s
+        where s.id = $2
+          and s.user_id = u.id
+          and s.revoked_at is null
+          and s.expires_at > now()
+      )`
+
+  status, err := scanAccountStatus(s.db.QueryRowContext(ctx, query, userID, sessionID))
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.AccountStatus{}, ErrNotFound
+  }
+  if err != nil {
+    return models.AccountStatus{}, err
+  }
+  return status, nil
+}
+
+// accountStatusColumns and accountStatusFrom select what authentication
+// needs to know about a user (aliased u), including their longest-lasting
+// active site ban.
+const accountStatusColumns = `
+      u.id,
+      u.role,
+      u.email_verified_at is not null,
+      b.id,
+      b.reason,
+      b.created_at,
+      b.expires_at`
+
+const accountStatusFrom = `users u
+    left join lateral (
+      select id, reason, created_at, expires_at
+      from bans
+      where user_id = u.id
+        and community_id is null
+        and revoked_at is null
+        and (expires_at is null or expires_at > now())
+      order by expires_at desc nulls first
+      limit 1
+    ) b on true`
+
+// scanAccountStatus reads accountStatusColumns followed by any extra
+// columns the caller selected.
+func scanAccountStatus(row rowScanner, extra ...any) (models.AccountStatus, error) {
+  var status models.AccountStatus
+  var banID, banReason sql.NullString
+  var banCreatedAt, banExpiresAt sql.NullTime
+  dest := []any{
+    &status.UserID,
+    &status.Role,
+    &status.EmailVerified,
+    &banID,
+    &banReason,
+    &banCreatedAt,
+    &banExpiresAt,
+  }
+  if err := row.Scan(append(dest, extra...)...); err != nil {
+    return models.AccountStatus{}, err
+  }
+  if banID.Valid {
+    status.SiteBan = &models.Ban{
+      ID:        banID.String,
+      UserID:    status.UserID,
+      Reason:    banReason.String,
+      CreatedAt: banCreatedAt.Time,
+      ExpiresAt: nullTimePtr(banExpiresAt),
+    }
+  }
+  return status, nil
+}
@@ -3,7 +3,9 @@ package store
 import (
   "context"
   "database/sql"
+  "errors"
 
+  "jabber_v3/apps/api/internal/models"
   "jabber_v3/apps/api/internal/store/qb"
 )
 
@@ -11,21 +13,64 @@ type VoteStore struct {
   db *sql.DB
 }
 
-func (s *VoteStore) UpsertVote(ctx context.Context, postID string, userID string, value int) error {
+// UpsertVote and DeleteVote leave the post's score and its author's karma
+// to the post_votes triggers, which apply them in the same transaction.
+// Both return the post's tally as of that transaction.
+func (s *VoteStore) UpsertVote(ctx context.Context, postID string, userID string, value int) (models.VoteTally, error) {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return models.VoteTally{}, err
+  }
+  defer tx.Rollback()
+
   query := `
     insert into post_votes (post_id, user_id, value)
     values ($1, $2, $3)
     on conflict (post_id, user_id)
     do update set value = excluded.value`
-  _, err := s.db.ExecContext(ctx, query, postID, userID, value)
-  return err
+  if _, err := tx.ExecContext(ctx, query, postID, userID, value); err != nil {
+    return models.VoteTally{}, err
+  }
+
+  tally, err := readTally(ctx, tx, postID)
+  if err != nil {
+    return models.VoteTally{}, err
+  }
+  tally.MyVote = value
+  return tally, tx.Commit()
 }
 
-func (s *VoteStore) DeleteVote(ctx context.Context, postID string, userID string) error {
+func (s *VoteStore) DeleteVote(ctx context.Context, postID string, userID string) (models.VoteTally, error) {
+  tx, err := s.db.BeginTx(ctx, nil)
+  if err != nil {
+    return models.VoteTally{}, err
+  }
+  defer tx.Rollback()
+
   query, args := qb.Delete("post_votes").
     WhereEq("post_id", postID).
     WhereEq("user_id", userID).
     Build()
-  _, err := s.db.ExecContext(ctx, query, args...)
-  return err
+  if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+    return models.VoteTally{}, err
+  }
+
+  tally, err := readTally(ctx, tx, postID)
+  if err != nil {
+    return models.VoteTally{}, err
+  }
+  return tally, tx.Commit()
+}
+
+func readTally(ctx context.Context, tx *sql.Tx, postID string) (models.VoteTally, error) {
+  query, args := qb.Select("score", "upvotes", "downvotes").
+    From("posts").
+    WhereEq("id", postID).
+    Build()
+  var tally models.VoteTally
+  err := tx.QueryRowContext(ctx, query, args...).Scan(&tally.Score, &tally.Upvotes, &tally.Downvotes)
+  if errors.Is(err, sql.ErrNoRows) {
+    return models.VoteTally{}, ErrNotFound
+  }
+  return tally, err
 }
@@ -0,0 +1,59 @@
+import React from "react";
+
+import { Button } from "../ui/button";
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "../ui/card";
+import { Input } from "../ui/input";
+
+type TwoFactorFormProps = {
+  onSubmit: (code: string) => Promise<void>;
+};
+
+export function TwoFactorForm({ onSubmit }: TwoFactorFormProps) {
+  const [code, setCode] = React.useState("");
+  const [error, setError] = React.useState<string | null>(null);
+  const [pending, setPending] = React.useState(false);
+
+  async function handleSubmit(event: React.FormEvent) {
+    event.preventDefault();
+    setError(null);
+    setPending(true);
+    try {
+      await onSubmit(code);
+    } catch (err) {
+      setError((err as Error).message);
+    } finally {
+      setPending(false);
+    }
+  }
+
+  return (
+    <section className="mx-auto max-w-md">
+      <Card className="rounded-3xl border-border/70 bg-card/90">
+        <CardHeader>
+          <CardTitle className="text-2xl">Two-factor authentication</CardTitle>
+          <CardDescription>Enter the 6-digit code from your authenticator app.</CardDescription>
+        </CardHeader>
+        <CardContent>
+          <form className="space-y-4" onSubmit={handleSubmit}>
+            <label className="block text-sm text-muted-foreground">
+              Code
+              <Input
+                type="text"
+                inputMode="numeric"
+                autoComplete="one-time-code"
+                value={code}
+                onChange={(event) => setCode(event.target.value)}
+                className="mt-2"
+                required
+              />
+            </label>
+            <Button type="submit" disabled={pending} className="w-full">
+              {pending ? "Working..." : "Verify"}
+            </Button>
+            {error && <p className="text-xs text-destructive">{error}</p>}
+          </form>
+        </CardContent>
+      </Card>
+    </section>
+  );
+}
@@ -2,7 +2,40 @@ export type User = {
   id: string;
   email: string;
   username: string;
+  role: "user" | "admin";
+  emailVerified: boolean;
+  twoFactorEnabled: boolean;
+  displayName: string;
+  bio: string;
+  avatarUrl: string;
   createdAt: string;
+  updatedAt: string;
+};
+
+export type AuthTokens = {
+  token: string;
+  refreshToken: string;
+  expiresAt: string;
+};
+
+export type AuthResponse = AuthTokens & {
+  user: User;
+};
+
+export type MFAChallenge = {
+  mfaRequired: true;
+  challengeToken: string;
+  expiresAt: string;
+};
+
+export type Session = {
+  id: string;
+  userAgent: string;
+  ip: string;
+  createdAt: string;
+  lastSeenAt: string;
+  expiresAt: string;
+  current: boolean;
 };
 
 export type Post = {
@@ -12,15 +45,100 @@ export type Post = {
   createdAt: string;
   author: {
     id: string;
-    email: string;
     username: string;
   };
   score: number;
+  upvotes: number;
+  downvotes: number;
+  myVote: number;
+  commentCount: number;
+  community: {
+    id: string;
+    slug: string;
+    name: string;
+  } | null;
+  editedAt: string | null;
+  deleted: boolean;
+  removed: boolean;
+  locked: boolean;
+  pinned: boolean;
+  original?: {
+    title: string;
+    body: string;
+    author: {
+      id: string;
+      username: string;
+    };
+  };
+};
+
+export type Profile = {
+  id: string;
+  username: string;
+  displayName: string;
+  bio: string;
+  avatarUrl: string;
+  createdAt: string;
+  karma: number;
+  postKarma: number;
+  // Reserved until comments can be voted on; always 0.
+  commentKarma: number;
+};
+
+export type ProfileComment = {
+  id: string;
+  postId: string;
+  postTitle: string;
+  parentId: string | null;
+  body: string;
+  createdAt: string;
+  community: {
+    id: string;
+    slug: string;
+    name: string;
+  } | null;
+};
+
+export type VotedPost = {
+  post: Post;
+  value: number;
+  votedAt: string;
+};
+
+export type VoteTally = {
+  score: number;
+  upvotes: number;
+  downvotes: number;
   myVote: number;
 };
 
+export type DataExport = {
+  id: string;
+  status: "pending" | "ready" | "failed";
+  createdAt: string;
+  completedAt: string | null;
+  expiresAt: string | null;
+};
+
+export type FeedPage = {
+  posts: Post[];
+  nextCursor: string | null;
+};
+
 const baseUrl = import.meta.env.VITE_API_URL ?? "http://localhost:8080";
 
+// describeError turns field-level validation errors such as
+// { error: "invalid_fields", fields: { password: ["too_short"] } } into
+// "password: too_short"; other errors are reported by their code.
+function describeError(body: { error?: string; fields?: Record<string, string[]> }) {
+  if (body.fields) {
+    return Object.entries(body.fields)
+      .map(([field, problems]) => `${field}: ${problems.join(", ")}`)
+      .join("; ");
+  }
+  return body.error ?? "request_failed";
+}
+
 async function request<T>(path: string, options: RequestInit = {}): Promise<T> {
   const response = await fetch(`${baseUrl}${path}`, {
     headers: {
@@ -32,7 +150,7 @@ async function request<T>(path: string, options: RequestInit = {}): Promise<T> {
 
   if (!response.ok) {
     const body = await response.json().catch(() => ({}));
-    const error = new Error(body.error ?? "request_failed");
+    const error = new Error(describeError(body));
     throw error;
   }
 
@@ -40,19 +158,226 @@ async function request<T>(path: string, options: RequestInit = {}): Promise<T> {
 }
 
 export async function register(email: string, username: string, password: string) {
-  return request<{ token: string; user: User }>("/api/v1/auth/register", {
+  return request<AuthResponse>("/api/v1/auth/register", {
     method: "POST",
     body: JSON.stringify({ email, username, password })
   });
 }
 
 export async function login(identifier: string, password: string) {
-  return request<{ token: string; user: User }>("/api/v1/auth/login", {
+  return request<AuthResponse | MFAChallenge>("/api/v1/auth/login", {
     method: "POST",
     body: JSON.stringify({ email: identifier, password })
   });
 }
 
+export async function verifyMFA(challengeToken: string, code: string) {
+  return request<AuthResponse>("/api/v1/auth/2fa/verify", {
+    method: "POST",
+    body: JSON.stringify({ challengeToken, code })
+  });
+}
+
+export type LinkedIdentity = {
+  identity: {
+    id: string;
+    provider: string;
+    email: string;
+    createdAt: string;
+    lastLoginAt: string | null;
+  };
+};
+
+// The OIDC calls send credentials so that the API's state cookie, set by
+// start, comes back with the callback from the same browser.
+export async function startOIDCLogin(provider: string) {
+  return request<{ authorizationUrl: string }>(
+    `/api/v1/auth/oidc/${encodeURIComponent(provider)}/start`,
+    { method: "POST", credentials: "include" }
+  );
+}
+
+export async function completeOIDCLogin(provider: string, code: string, state: string) {
+  return request<AuthResponse | MFAChallenge>(
+    `/api/v1/auth/oidc/${encodeURIComponent(provider)}/callback`,
+    {
+      method: "POST",
+      credentials: "include",
+      body: JSON.stringify({ code, state })
+    }
+  );
+}
+
+export async function startIdentityLink(token: string, provider: string) {
+  return request<{ authorizationUrl: string }>(
+    `/api/v1/me/identities/${encodeURIComponent(provider)}/start`,
+    {
+      method: "POST",
+      credentials: "include",
+      headers: {
+        Authorization: `Bearer ${token}`
+      }
+    }
+  );
+}
+
+export async function completeIdentityLink(token: string, provider: string, code: string, state: string) {
+  return request<LinkedIdentity>(
+    `/api/v1/me/identities/${encodeURIComponent(provider)}/callback`,
+    {
+      method: "POST",
+      credentials: "include",
+      headers: {
+        Authorization: `Bearer ${token}`
+      },
+      body: JSON.stringify({ code, state })
+    }
+  );
+}
+
+export async function refresh(refreshToken: string) {
+  return request<AuthTokens>("/api/v1/auth/refresh", {
+    method: "POST",
+    body: JSON.stringify({ refreshToken })
+  });
+}
+
+export async function logout(token: string) {
+  return request<{ status: string }>("/api/v1/auth/logout", {
+    method: "POST",
+    headers: {
+      Authorization: `Bearer ${token}`
+    }
+  });
+}
+
+export async function fetchSessions(token: string) {
+  return request<Session[]>("/api/v1/me/sessions", {
+    headers: {
+      Authorization: `Bearer ${token}`
+    }
+  });
+}
+
+export async function revokeSession(token: string, sessionID: string) {
+  return request<{ status: string }>(`/api/v1/me/sessions/${sessionID}`, {
+    method: "DELETE",
+    headers: {
+      Authorization: `Bearer ${token}`
+    }
+  });
+}
+
+export async function revokeOtherSessions(token: string) {
+  return request<{ revoked: number }>("/api/v1/me/sessions", {
+    method: "DELETE",
+    headers: {
+      Authorization: `Bearer ${token}`
+    }
+  });
+}
+
+export async function forgotPassword(email: string) {
+  return request<{ status: string }>("/api/v1/auth/password/forgot", {
+    method: "POST",
+    body: JSON.stringify({ email })
+  });
+}
+
+export async function resetPassword(token: string, password: string) {
+  return request<{ status: string }>("/api/v1/auth/password/reset", {
+    method: "POST",
+    body: JSON.stringify({ token, password })
+  });
+}
+
+export async function verifyEmail(token: string) {
+  return request<{ status: string }>("/api/v1/auth/email/verify", {
+    method: "POST",
+    body: JSON.stringify({ token })
+  });
+}
+
+export async function updateMe(
+  token: string,
+  changes: { username?: string; displayName?: string; bio?: string; avatarUrl?: string }
+) {
+  return request<User>("/api/v1/me", {
+    method: "PATCH",
+    headers: {
+      Authorization: `Bearer ${token}`
+    },
+    body: JSON.stringify(changes)
+  });
+}
+
+export async function changePassword(token: string, currentPassword: string, newPassword: string) {
+  return request<{ status: string }>("/api/v1/me/password", {
+    method: "POST",
+    headers: {
+      Authorization: `Bearer ${token}`
+    },
+    body: JSON.stringify({ currentPassword, newPassword })
+  });
+}
+
+export async function changeEmail(token: string, email: string, password: string) {
+  return request<{ status: string }>("/api/v1/me/email", {
+    method: "POST",
+    headers: {
+      Authorization: `Bearer ${token}`
+    },
+    body: JSON.stringify({ email, password })
+  });
+}
+
+export async function confirmEmailChange(token: string) {
+  return request<{ status: string }>("/api/v1/auth/email/change/confirm", {
+    method: "POST",
+    body: JSON.stringify({ token })
+  });
+}
+
+export async function deleteAccount(token: string, password: string) {
+  return request<{ deleteAfter: string }>("/api/v1/me", {
+    method: "DELETE",
+    headers: {
+      Authorization: `Bearer ${token}`
+    },
+    body: JSON.stringify({ password })
+  });
+}
+
+export async function requestExport(token: string) {
+  return request<DataExport>("/api/v1/me/export", {
+    method: "POST",
+    headers: {
+      Authorization: `Bearer ${token}`
+    }
+  });
+}
+
+export async function fetchExport(token: string, exportID: string) {
+  return request<DataExport>(`/api/v1/me/exports/${exportID}`, {
+    headers: {
+      Authorization: `Bearer ${token}`
+    }
+  });
+}
+
+export async function downloadExport(token: string, exportID: string) {
+  const response = await fetch(`${baseUrl}/api/v1/me/exports/${exportID}/download`, {
+    headers: {
+      Authorization: `Bearer ${token}`
+    }
+  });
+  if (!response.ok) {
+    const body = await response.json().catch(() => ({}));
+    throw new Error(describeError(body));
+  }
+  return response.blob();
+}
+
 export async function fetchMe(token: string) {
   return request<User>("/api/v1/me", {
     headers: {
@@ -62,7 +387,49 @@ export async function fetchMe(token: string) {
 }
 
 export async function fetchFeed(token?: string) {
-  return request<Post[]>("/api/v1/posts", {
+  const page = await request<FeedPage>("/api/v1/posts", {
+    headers: token ? { Authorization: `Bearer ${token}` } : {}
+  });
+  return page.posts;
+}
+
+export async function fetchProfile(username: string, token?: string) {
+  return request<Profile>(`/api/v1/users/${encodeURIComponent(username)}`, {
+    headers: token ? { Authorization: `Bearer ${token}` } : {}
+  });
+}
+
+export async function fetchUserPosts(username: string, token?: string, after?: string) {
+  const query = after ? `?after=${encodeURIComponent(after)}` : "";
+  return request<FeedPage>(`/api/v1/users/${encodeURIComponent(username)}/posts${query}`, {
+    headers: token ? { Authorization: `Bearer ${token}` } : {}
+  });
+}
+
+export async function fetchUserComments(username: string, token?: string, after?: string) {
+  const query = after ? `?after=${encodeURIComponent(after)}` : "";
+  return request<{ comments: ProfileComment[]; nextCursor: string | null }>(
+    `/api/v1/users/${encodeURIComponent(username)}/comments${query}`,
+    {
+      headers: token ? { Authorization: `Bearer ${token}` } : {}
+    }
+  );
+}
+
+export async function fetchMyVotes(token: string, username: string, after?: string) {
+  const query = after ? `?after=${encodeURIComponent(after)}` : "";
+  return request<{ votes: VotedPost[]; nextCursor: string | null }>(
+    `/api/v1/users/${encodeURIComponent(username)}/votes${query}`,
+    {
+      headers: {
+        Authorization: `Bearer ${token}`
+      }
+    }
+  );
+}
+
+export async function fetchPost(postID: string, token?: string) {
+  return request<Post>(`/api/v1/posts/${postID}`, {
     headers: token ? { Authorization: `Bearer ${token}` } : {}
   });
 }
@@ -82,7 +449,7 @@ export async function createPost(
 }
 
 export async function votePost(token: string, postID: string, value: number) {
-  return request<{ status: string }>(`/api/v1/posts/${postID}/vote`, {
+  return request<VoteTally>(`/api/v1/posts/${postID}/vote`, {
     method: "POST",
     headers: {
       Authorization: `Bearer ${token}`
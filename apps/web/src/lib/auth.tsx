@@ -9,22 +9,52 @@ export type AuthState = {
   loading: boolean;
   error: string | null;
   authError: string | null;
+  mfaPending: boolean;
 };
 
 type AuthContextValue = AuthState & {
-  login: (identifier: string, password: string) => Promise<void>;
+  // login resolves to false when a second factor is still required; finish
+  // with verifyMFA.
+  login: (identifier: string, password: string) => Promise<boolean>;
+  verifyMFA: (code: string) => Promise<void>;
+  // completeOIDC finishes a provider login; like login it resolves to false
+  // when a second factor is still required.
+  completeOIDC: (provider: string, code: string, state: string) => Promise<boolean>;
   register: (email: string, username: string, password: string) => Promise<void>;
   logout: () => void;
 };
 
 const AuthContext = React.createContext<AuthContextValue | null>(null);
 
+const tokenKey = "jabber_token";
+const refreshTokenKey = "jabber_refresh_token";
+const expiresAtKey = "jabber_token_expires_at";
+
+// Refresh this long before the access token expires.
+const refreshLeewayMs = 60_000;
+
+function storeTokens(tokens: api.AuthTokens) {
+  localStorage.setItem(tokenKey, tokens.token);
+  localStorage.setItem(refreshTokenKey, tokens.refreshToken);
+  localStorage.setItem(expiresAtKey, tokens.expiresAt);
+}
+
+function clearTokens() {
+  localStorage.removeItem(tokenKey);
+  localStorage.removeItem(refreshTokenKey);
+  localStorage.removeItem(expiresAtKey);
+}
+
 export function AuthProvider({ children }: { children: React.ReactNode }) {
   const [token, setToken] = React.useState<string | null>(
-    () => localStorage.getItem("jabber_token")
+    () => localStorage.getItem(tokenKey)
+  );
+  const [expiresAt, setExpiresAt] = React.useState<string | null>(
+    () => localStorage.getItem(expiresAtKey)
   );
   const [user, setUser] = React.useState<api.User | null>(null);
   const [authError, setAuthError] = React.useState<string | null>(null);
+  const [mfaChallenge, setMfaChallenge] = React.useState<string | null>(null);
   const meQuery = useMe(token);
   const loginMutation = useLogin();
   const registerMutation = useRegister();
@@ -37,21 +67,91 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     }
   }, [meQuery.data, token]);
 
+  const signOut = React.useCallback(() => {
+    clearTokens();
+    setToken(null);
+    setExpiresAt(null);
+    setUser(null);
+  }, []);
+
+  const refreshSession = React.useCallback(async () => {
+    const refreshToken = localStorage.getItem(refreshTokenKey);
+    if (!refreshToken) {
+      signOut();
+      return;
+    }
+    try {
+      const tokens = await api.refresh(refreshToken);
+      storeTokens(tokens);
+      setToken(tokens.token);
+      setExpiresAt(tokens.expiresAt);
+    } catch {
+      signOut();
+    }
+  }, [signOut]);
+
   React.useEffect(() => {
     if (meQuery.isError && token) {
-      localStorage.removeItem("jabber_token");
-      setToken(null);
-      setUser(null);
+      void refreshSession();
     }
-  }, [meQuery.isError, token]);
+  }, [meQuery.isError, token, refreshSession]);
+
+  React.useEffect(() => {
+    if (!token || !expiresAt) {
+      return;
+    }
+    const delay = Math.max(new Date(expiresAt).getTime() - Date.now() - refreshLeewayMs, 0);
+    const timer = window.setTimeout(() => void refreshSession(), delay);
+    return () => window.clearTimeout(timer);
+  }, [token, expiresAt, refreshSession]);
+
+  function signIn(result: api.AuthResponse) {
+    storeTokens(result);
+    setToken(result.token);
+    setExpiresAt(result.expiresAt);
+    setUser(result.user);
+    setMfaChallenge(null);
+    setAuthError(null);
+  }
 
   async function handleLogin(identifier: string, password: string) {
     try {
       const result = await loginMutation.mutateAsync({ identifier, password });
-      setToken(result.token);
-      setUser(result.user);
-      localStorage.setItem("jabber_token", result.token);
-      setAuthError(null);
+      if ("mfaRequired" in result) {
+        setMfaChallenge(result.challengeToken);
+        setAuthError(null);
+        return false;
+      }
+      signIn(result);
+      return true;
+    } catch (err) {
+      setAuthError((err as Error).message);
+      throw err;
+    }
+  }
+
+  async function handleCompleteOIDC(provider: string, code: string, state: string) {
+    try {
+      const result = await api.completeOIDCLogin(provider, code, state);
+      if ("mfaRequired" in result) {
+        setMfaChallenge(result.challengeToken);
+        setAuthError(null);
+        return false;
+      }
+      signIn(result);
+      return true;
+    } catch (err) {
+      setAuthError((err as Error).message);
+      throw err;
+    }
+  }
+
+  async function handleVerifyMFA(code: string) {
+    if (!mfaChallenge) {
+      throw new Error("invalid_challenge");
+    }
+    try {
+      signIn(await api.verifyMFA(mfaChallenge, code));
     } catch (err) {
       setAuthError((err as Error).message);
       throw err;
@@ -60,11 +160,7 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
 
   async function handleRegister(email: string, username: string, password: string) {
     try {
-      const result = await registerMutation.mutateAsync({ email, username, password });
-      setToken(result.token);
-      setUser(result.user);
-      localStorage.setItem("jabber_token", result.token);
-      setAuthError(null);
+      signIn(await registerMutation.mutateAsync({ email, username, password }));
     } catch (err) {
       setAuthError((err as Error).message);
       throw err;
@@ -72,9 +168,10 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
   }
 
   function handleLogout() {
-    localStorage.removeItem("jabber_token");
-    setToken(null);
-    setUser(null);
+    if (token) {
+      api.logout(token).catch(() => undefined);
+    }
+    signOut();
   }
 
   const value: AuthContextValue = {
@@ -83,7 +180,10 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     loading: meQuery.isLoading || loginMutation.isPending || registerMutation.isPending,
     error: (meQuery.error as Error | null)?.message ?? null,
     authError,
+    mfaPending: mfaChallenge !== null,
     login: handleLogin,
+    verifyMFA: handleVerifyMFA,
+    completeOIDC: handleCompleteOIDC,
     register: handleRegister,
     logout: handleLogout
   };
@@ -13,6 +13,13 @@ export function useFeed(token?: string) {
   });
 }
 
+export function usePost(postID: string, token?: string) {
+  return useQuery({
+    queryKey: ["post", postID, token ?? "anon"] as const,
+    queryFn: () => api.fetchPost(postID, token),
+  });
+}
+
 export function useCreatePost(token?: string | null) {
   const queryClient = useQueryClient();
   return useMutation({
@@ -133,7 +133,7 @@ export function HomePage() {
                   <CardHeader className="pb-2">
                     <CardTitle className="text-lg">{post.title}</CardTitle>
                     <CardDescription>
-                      {post.author.username || post.author.email} ·{" "}
+                      {post.author.username} ·{" "}
                       {new Date(post.createdAt).toLocaleString()}
                     </CardDescription>
                   </CardHeader>
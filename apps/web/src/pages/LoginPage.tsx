@@ -2,10 +2,23 @@ import { Link, useNavigate } from "@tanstack/react-router";
 
 import { useAuth } from "../lib/auth";
 import { AuthForm } from "../components/auth/AuthForm";
+import { TwoFactorForm } from "../components/auth/TwoFactorForm";
 
 export function LoginPage() {
   const auth = useAuth();
   const navigate = useNavigate();
+
+  if (auth.mfaPending) {
+    return (
+      <TwoFactorForm
+        onSubmit={async (code) => {
+          await auth.verifyMFA(code);
+          await navigate({ to: "/" });
+        }}
+      />
+    );
+  }
+
   return (
     <AuthForm
       title="Welcome back"
@@ -14,8 +27,9 @@ export function LoginPage() {
       emailType="text"
       externalError={auth.authError}
       onSubmit={async (identifier, password) => {
-        await auth.login(identifier, password);
-        await navigate({ to: "/" });
+        if (await auth.login(identifier, password)) {
+          await navigate({ to: "/" });
+        }
       }}
       footer={
         <>
@@ -0,0 +1,64 @@
+import React from "react";
+import { Link, useNavigate, useParams } from "@tanstack/react-router";
+
+import { useAuth } from "../lib/auth";
+import { TwoFactorForm } from "../components/auth/TwoFactorForm";
+
+export function OIDCCallbackPage() {
+  const auth = useAuth();
+  const navigate = useNavigate();
+  const { provider } = useParams({ strict: false }) as { provider: string };
+  const [error, setError] = React.useState<string | null>(null);
+  const started = React.useRef(false);
+
+  React.useEffect(() => {
+    // The provider's code is single use, so guard against a second run.
+    if (started.current) {
+      return;
+    }
+    started.current = true;
+
+    const params = new URLSearchParams(window.location.search);
+    const code = params.get("code");
+    const state = params.get("state");
+    if (!code || !state) {
+      setError(params.get("error") ?? "invalid_callback");
+      return;
+    }
+
+    auth
+      .completeOIDC(provider, code, state)
+      .then(async (signedIn) => {
+        if (signedIn) {
+          await navigate({ to: "/" });
+        }
+      })
+      .catch((err) => setError((err as Error).message));
+  }, [auth, navigate, provider]);
+
+  if (auth.mfaPending) {
+    return (
+      <TwoFactorForm
+        onSubmit={async (code) => {
+          await auth.verifyMFA(code);
+          await navigate({ to: "/" });
+        }}
+      />
+    );
+  }
+
+  return (
+    <section className="mx-auto max-w-md text-sm text-muted-foreground">
+      {error ? (
+        <p>
+          Sign-in failed: <span className="text-destructive">{error}</span>.{" "}
+          <Link to="/login" className="text-primary hover:underline">
+            Back to log in
+          </Link>
+        </p>
+      ) : (
+        <p>Signing you in...</p>
+      )}
+    </section>
+  );
+}
@@ -7,6 +7,7 @@ import {
 import { AppShell } from "./components/layout/AppShell";
 import { HomePage } from "./pages/HomePage";
 import { LoginPage } from "./pages/LoginPage";
+import { OIDCCallbackPage } from "./pages/OIDCCallbackPage";
 import { RegisterPage } from "./pages/RegisterPage";
 import { SpacesPage } from "./pages/SpacesPage";
 
@@ -32,6 +33,12 @@ const registerRoute = createRoute({
   component: RegisterPage,
 });
 
+export const oidcCallbackRoute = createRoute({
+  getParentRoute: () => rootRoute,
+  path: "/auth/oidc/$provider/callback",
+  component: OIDCCallbackPage,
+});
+
 const spacesRoute = createRoute({
   getParentRoute: () => rootRoute,
   path: "/spaces",
@@ -42,6 +49,7 @@ const routeTree = rootRoute.addChildren([
   indexRoute,
   loginRoute,
   registerRoute,
+  oidcCallbackRoute,
   spacesRoute,
 ]);
 